@@ -0,0 +1,192 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	QualifierNamePrefix   = "qualifier"
+	EnvVarQualifierPrefix = "LAMBDA_QUALIFIER"
+	LambdaAliasesName     = "lambda-aliases"
+	EnvVarLambdaAliases   = "LAMBDA_ALIASES"
+	qualifierQueryParam   = "Qualifier"
+)
+
+func QualifierNameForFunction(functionName string) string {
+	if functionName == "" || functionName == FunctionNamePrefix {
+		return QualifierNamePrefix
+	}
+
+	return fmt.Sprintf("%s-%s", QualifierNamePrefix, functionName)
+}
+
+func EnvVarQualifierForFunction(functionName string) string {
+	if functionName == "" || functionName == FunctionNamePrefix {
+		return EnvVarQualifierPrefix
+	}
+
+	return fmt.Sprintf("%s_%s", EnvVarQualifierPrefix, strings.ToUpper(functionName))
+}
+
+// withQualifier adds the version or alias to invoke to the invoke endpoint.
+func withQualifier(invokeEndpoint, qualifier string) (string, error) {
+	if qualifier == "" {
+		return invokeEndpoint, nil
+	}
+
+	u, err := url.Parse(invokeEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid invoke endpoint %q: %w", invokeEndpoint, err)
+	}
+
+	query := u.Query()
+	query.Set(qualifierQueryParam, qualifier)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// AliasRoute routes a share of the invocations of a function alias to the endpoint serving one of
+// its versions.
+type AliasRoute struct {
+	// Name of the function the alias belongs to
+	FunctionName string
+	// Name of the alias
+	Alias string
+	// Version of the function served by the endpoint, reported as the executed version
+	Version string
+	// Relative share of the invocations of the alias routed to the endpoint
+	Weight float64
+	// Endpoint to invoke the version of the lambda function
+	Endpoint string
+}
+
+// ParseAliasRoute parses an alias route of the form
+// function=name;alias=live;version=2;weight=10;endpoint=http://host:8080/2015-03-31/functions/function/invocations
+// where the version and weight are optional.
+func ParseAliasRoute(value string) (AliasRoute, error) {
+	route := AliasRoute{Weight: 1}
+	for _, field := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return route, fmt.Errorf("invalid alias route field %q", field)
+		}
+
+		switch key {
+		case "function":
+			route.FunctionName = val
+		case "alias":
+			route.Alias = val
+		case "version":
+			route.Version = val
+		case "weight":
+			weight, err := strconv.ParseFloat(val, 64)
+			if err != nil || weight < 0 {
+				return route, fmt.Errorf("invalid alias route weight %q", val)
+			}
+			route.Weight = weight
+		case "endpoint":
+			route.Endpoint = val
+		default:
+			return route, fmt.Errorf("unknown alias route field %q", key)
+		}
+	}
+
+	if route.FunctionName == "" || route.Alias == "" || route.Endpoint == "" {
+		return route, fmt.Errorf("alias route %q requires a function, alias and endpoint", value)
+	}
+
+	return route, nil
+}
+
+type weightedRoute struct {
+	version string
+	weight  float64
+	invoker Invoker
+}
+
+// WeightedInvoker emulates an alias with weighted traffic shifting, sending each invocation to one
+// of the versions the alias points to in proportion to their weights.
+type WeightedInvoker struct {
+	routes []weightedRoute
+	total  float64
+}
+
+func NewWeightedInvoker() *WeightedInvoker {
+	return &WeightedInvoker{}
+}
+
+// AddRoute routes a share of the invocations to the invoker of a version.
+func (w *WeightedInvoker) AddRoute(version string, weight float64, invoker Invoker) {
+	w.routes = append(w.routes, weightedRoute{version: version, weight: weight, invoker: invoker})
+	w.total += weight
+}
+
+func (w *WeightedInvoker) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	if len(w.routes) == 0 {
+		return nil, fmt.Errorf("alias has no routes")
+	}
+
+	route := w.routes[len(w.routes)-1]
+	//nolint:gosec
+	pick := rand.Float64() * w.total
+	for _, candidate := range w.routes {
+		if pick < candidate.weight {
+			route = candidate
+			break
+		}
+		pick -= candidate.weight
+	}
+
+	result, err := route.invoker.Invoke(ctx, payload)
+	if result != nil && result.ExecutedVersion == "" {
+		result.ExecutedVersion = route.version
+	}
+
+	return result, err
+}
+
+// aliasInvokerFromCLI builds a weighted invoker from the routes of the function alias configured by
+// the aliases flag, it returns nil when the alias has no routes.
+func aliasInvokerFromCLI(
+	cliCtx *cli.Context,
+	funcName, alias string,
+	newInvoker func(invokeEndpoint string) Invoker,
+) (Invoker, error) {
+	if alias == "" {
+		return nil, nil
+	}
+
+	var invoker *WeightedInvoker
+	for _, value := range DefinitionsFromCLI(cliCtx, LambdaAliasesName) {
+		route, err := ParseAliasRoute(value)
+		if err != nil {
+			return nil, err
+		}
+		if route.FunctionName != funcName || route.Alias != alias {
+			continue
+		}
+
+		if invoker == nil {
+			invoker = NewWeightedInvoker()
+		}
+		invokeEndpoint, err := withQualifier(route.Endpoint, route.Version)
+		if err != nil {
+			return nil, err
+		}
+		invoker.AddRoute(route.Version, route.Weight, newInvoker(invokeEndpoint))
+	}
+
+	if invoker == nil {
+		return nil, nil
+	}
+
+	return invoker, nil
+}
@@ -0,0 +1,163 @@
+package offline
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseAliasRoute(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    AliasRoute
+		wantErr bool
+	}{
+		{
+			name:  "all fields",
+			value: "function=hello;alias=live;version=2;weight=10;endpoint=http://hello-v2:8080/2015-03-31/functions/function/invocations",
+			want: AliasRoute{
+				FunctionName: "hello",
+				Alias:        "live",
+				Version:      "2",
+				Weight:       10,
+				Endpoint:     "http://hello-v2:8080/2015-03-31/functions/function/invocations",
+			},
+		},
+		{
+			name:  "default weight",
+			value: "function=hello;alias=live;endpoint=http://hello:8080",
+			want:  AliasRoute{FunctionName: "hello", Alias: "live", Weight: 1, Endpoint: "http://hello:8080"},
+		},
+		{
+			name:  "spaces around fields",
+			value: " function=hello ; alias=live ; weight=0.5 ; endpoint=http://hello:8080 ",
+			want:  AliasRoute{FunctionName: "hello", Alias: "live", Weight: 0.5, Endpoint: "http://hello:8080"},
+		},
+		{
+			name:  "endpoint with commas and equal signs",
+			value: "function=hello;alias=live;endpoint=http://hello:8080/invocations?a=b,c",
+			want:  AliasRoute{FunctionName: "hello", Alias: "live", Weight: 1, Endpoint: "http://hello:8080/invocations?a=b,c"},
+		},
+		{
+			name:    "invalid weight",
+			value:   "function=hello;alias=live;weight=x;endpoint=http://hello:8080",
+			wantErr: true,
+		},
+		{
+			name:    "negative weight",
+			value:   "function=hello;alias=live;weight=-1;endpoint=http://hello:8080",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			value:   "function=hello;alias=live;endpoint=http://hello:8080;region=us-east-1",
+			wantErr: true,
+		},
+		{
+			name:    "field without value",
+			value:   "function=hello;alias;endpoint=http://hello:8080",
+			wantErr: true,
+		},
+		{
+			name:    "missing endpoint",
+			value:   "function=hello;alias=live",
+			wantErr: true,
+		},
+		{
+			name:    "missing alias",
+			value:   "function=hello;endpoint=http://hello:8080",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAliasRoute(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAliasRoute(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseAliasRoute(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// versionInvoker succeeds with the executed version it reports, if any.
+func versionInvoker(executedVersion string) Invoker {
+	return InvokeFunc(func(context.Context, []byte) (*InvokeResult, error) {
+		return &InvokeResult{StatusCode: 200, ExecutedVersion: executedVersion}, nil
+	})
+}
+
+func TestWeightedInvoker(t *testing.T) {
+	type route struct {
+		version         string
+		weight          float64
+		executedVersion string
+	}
+
+	tests := []struct {
+		name string
+		// routes of the alias
+		routes []route
+		// executed versions reported by the invocations, sorted
+		want []string
+	}{
+		{
+			name:   "single route",
+			routes: []route{{version: "1", weight: 1}},
+			want:   []string{"1"},
+		},
+		{
+			name:   "routes without weight are never invoked",
+			routes: []route{{version: "1", weight: 0}, {version: "2", weight: 1}, {version: "3", weight: 0}},
+			want:   []string{"2"},
+		},
+		{
+			name:   "every weighted route is invoked",
+			routes: []route{{version: "1", weight: 1}, {version: "2", weight: 1}},
+			want:   []string{"1", "2"},
+		},
+		{
+			name:   "executed version of the endpoint wins",
+			routes: []route{{version: "1", weight: 1, executedVersion: "$LATEST"}},
+			want:   []string{"$LATEST"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := NewWeightedInvoker()
+			for _, r := range tt.routes {
+				invoker.AddRoute(r.version, r.weight, versionInvoker(r.executedVersion))
+			}
+
+			seen := make(map[string]bool)
+			for i := 0; i < 200; i++ {
+				result, err := invoker.Invoke(context.Background(), []byte("{}"))
+				if err != nil {
+					t.Fatalf("Invoke() error = %v", err)
+				}
+				seen[result.ExecutedVersion] = true
+			}
+
+			var got []string
+			for version := range seen {
+				got = append(got, version)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("executed versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightedInvokerWithoutRoutes(t *testing.T) {
+	if _, err := NewWeightedInvoker().Invoke(context.Background(), []byte("{}")); err == nil {
+		t.Error("Invoke() of an alias without routes succeeded")
+	}
+}
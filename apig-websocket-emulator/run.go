@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -13,10 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	"github.com/gorilla/mux"
 	"github.com/urfave/cli/v2"
@@ -27,14 +21,19 @@ import (
 )
 
 const (
-	AwsRegion          = "aws-region"
+	AwsRegion          = offline.AwsRegionName
 	WebsocketAPIPort   = "websocket-api-port"
 	WebsocketAPIStage  = "websocket-api-stage"
+	WebsocketAPIID     = "websocket-api-id"
 	ManagementAPIPort  = "mgmt-api-port"
-	KinesisEndpoint    = "kinesis-endpoint"
+	KinesisEndpoint    = offline.KinesisEndpointName
 	KinesisStream      = "kinesis-stream"
 	FunctionConnect    = "connect"
 	FunctionDisconnect = "disconnect"
+	FunctionAuthorizer = "authorizer"
+
+	RouteSelectionExpression = "route-selection-expression"
+	Routes                   = "routes"
 )
 
 var (
@@ -50,82 +49,101 @@ func init() {
 	zap.ReplaceGlobals(logger)
 }
 
-func registerConnectLambda(cliCtx *cli.Context, hub *websocket.Hub) {
-	var onConnect func(websocket.Connection)
-	var onDisconnect func(websocket.Connection)
+func registerConnectLambda(ctx context.Context, cliCtx *cli.Context, hub *websocket.Hub) error {
+	var authorizer, connect, disconnect offline.Invoker
+
+	if cliCtx.IsSet(offline.FunctionNameForFunction(FunctionAuthorizer)) {
+		invoker, err := offline.InvokerFromCLI(cliCtx, FunctionAuthorizer)
+		if err != nil {
+			return err
+		}
+		authorizer = invoker
+	}
 
 	if cliCtx.IsSet(offline.FunctionNameForFunction(FunctionConnect)) {
-		onConnect = func(connection websocket.Connection) {
-			zap.L().Info("invoking connect lambda",
-				zap.String("connection.id", connection.ID),
-			)
+		invoker, err := offline.InvokerFromCLI(cliCtx, FunctionConnect)
+		if err != nil {
+			return err
+		}
+		connect = invoker
+	}
 
-			payload := events.APIGatewayWebsocketProxyRequest{
-				RequestContext: events.APIGatewayWebsocketProxyRequestContext{
-					ConnectionID: connection.ID,
-				},
-			}
+	if cliCtx.IsSet(offline.FunctionNameForFunction(FunctionDisconnect)) {
+		invoker, err := offline.InvokerFromCLI(cliCtx, FunctionDisconnect)
+		if err != nil {
+			return err
+		}
+		disconnect = invoker
+	}
 
-			payloadBytes, err := json.Marshal(payload)
-			if err != nil {
-				zap.L().Error("failed to marshal payload", zap.Error(err))
-				return
-			}
+	// the authorizer runs before the $connect route, which sees the authorizer context
+	if authorizer != nil {
+		hub.AddConnectHook(websocket.NewLambdaAuthorizerHook(authorizer, cliCtx.String(AwsRegion)))
+	}
+	if connect != nil {
+		hub.AddConnectHook(websocket.NewLambdaConnectHook(connect))
+	}
+	if disconnect != nil {
+		hub.RegisterListener(websocket.NewLambdaListener(ctx, "disconnect-lambda", disconnect))
+	}
 
-			_, err = offline.LambdaInvokeFromCLI(cliCtx, FunctionConnect, payloadBytes)
-			if err != nil {
-				zap.L().Error("failed to invoke connect lambda", zap.Error(err))
-			}
-		}
+	return nil
+}
+
+// routeTableFromCLI builds the route table of the routes flag, or routes every message to the
+// kinesis stream when no route is declared.
+func routeTableFromCLI(cliCtx *cli.Context, client *kinesis.Client) (*websocket.RouteTable, error) {
+	expression, err := websocket.ParseRouteSelectionExpression(cliCtx.String(RouteSelectionExpression))
+	if err != nil {
+		return nil, err
 	}
+	routes := websocket.NewRouteTable(expression)
 
-	if cliCtx.IsSet(offline.FunctionNameForFunction(FunctionDisconnect)) {
-		onDisconnect = func(connection websocket.Connection) {
-			zap.L().Info("invoking disconnect lambda",
-				zap.String("connection.id", connection.ID),
-			)
+	values := offline.DefinitionsFromCLI(cliCtx, Routes)
+	if len(values) == 0 {
+		routes.AddRoute(websocket.RouteDefault, websocket.Route{
+			Integration: websocket.NewKinesisIntegration(client, cliCtx.String(KinesisStream)),
+		})
+		return routes, nil
+	}
 
-			payload := events.APIGatewayWebsocketProxyRequest{
-				RequestContext: events.APIGatewayWebsocketProxyRequestContext{
-					ConnectionID: connection.ID,
-				},
-			}
+	for _, value := range values {
+		definition, err := websocket.ParseRouteDefinition(value)
+		if err != nil {
+			return nil, err
+		}
 
-			payloadBytes, err := json.Marshal(payload)
+		var integration websocket.Integration
+		switch definition.Integration {
+		case websocket.IntegrationLambda:
+			invoker, err := offline.FunctionInvokerFromCLI(cliCtx, definition.Function)
 			if err != nil {
-				zap.L().Error("failed to marshal payload", zap.Error(err))
-				return
+				return nil, err
 			}
-
-			_, err = offline.LambdaInvokeFromCLI(cliCtx, FunctionDisconnect, payloadBytes)
-			if err != nil {
-				zap.L().Error("failed to invoke disconnect lambda", zap.Error(err))
+			integration = websocket.NewLambdaIntegration(invoker)
+		case websocket.IntegrationKinesis:
+			streamName := definition.Stream
+			if streamName == "" {
+				streamName = cliCtx.String(KinesisStream)
 			}
+			integration = websocket.NewKinesisIntegration(client, streamName)
+		case websocket.IntegrationMock:
+			integration = websocket.NewMockIntegration([]byte(definition.Response))
 		}
-	}
 
-	if onConnect != nil || onDisconnect != nil {
-		hub.RegisterListener(&websocket.Listener{
-			ID:           "connection-lambdas",
-			OnConnect:    onConnect,
-			OnDisconnect: onDisconnect,
-		})
+		zap.L().Info("registering websocket route",
+			zap.String("route.key", definition.RouteKey),
+			zap.String("route.integration", definition.Integration),
+			zap.Bool("route.reply", definition.Reply),
+		)
+		routes.AddRoute(definition.RouteKey, websocket.Route{Integration: integration, RouteResponse: definition.Reply})
 	}
+
+	return routes, nil
 }
 
 func main() {
 	flags := []cli.Flag{
-		&cli.StringFlag{
-			Name:    AwsRegion,
-			EnvVars: []string{"AWS_REGION"},
-			Value:   "us-east-1",
-			Usage:   "AWS region to use",
-		},
-		&cli.StringFlag{
-			Name:    KinesisEndpoint,
-			EnvVars: []string{"KINESIS_ENDPOINT"},
-			Usage:   "Endpoint to use for kinesis. i.e. http://localhost:4566",
-		},
 		&cli.StringFlag{
 			Name:    KinesisStream,
 			EnvVars: []string{"KINESIS_STREAM"},
@@ -143,22 +161,50 @@ func main() {
 			Value:   "/ws",
 			Usage:   "Emulated API gateway stage for websocket connections",
 		},
+		&cli.StringFlag{
+			Name:    WebsocketAPIID,
+			EnvVars: []string{"WEBSOCKET_API_ID"},
+			Value:   "local",
+			Usage:   "Emulated API gateway API ID, reported to the route integrations as the apiId",
+		},
 		&cli.IntFlag{
 			Name:    ManagementAPIPort,
 			EnvVars: []string{"MANAGEMENT_API_PORT"},
 			Value:   8081,
 			Usage:   "Port to listen on for API gateway management requests",
 		},
+		&cli.StringFlag{
+			Name:    RouteSelectionExpression,
+			EnvVars: []string{"ROUTE_SELECTION_EXPRESSION"},
+			Value:   websocket.DefaultRouteSelectionExpression,
+			Usage:   "Field of the JSON body of messages which selects their route, i.e. $request.body.action",
+		},
+		&cli.GenericFlag{
+			Name:    Routes,
+			EnvVars: []string{"WEBSOCKET_ROUTES"},
+			Value:   &offline.DefinitionsValue{},
+			Usage: "Route of the form route=sendMessage;integration=lambda;function=send-message, where the " +
+				"integration is lambda, kinesis with an optional stream, or mock with a response, which comes last, " +
+				"and reply=true sends the integration response back to the client. Messages without a route go to the " +
+				"$default route, or to the kinesis stream when no route is declared. Routes are separated by newlines " +
+				"in the environment",
+		},
 	}
 
+	flags = append(flags, offline.KinesisFlags()...)
 	flags = append(flags, offline.LambdaFlags()...)
 	flags = append(flags, offline.LambdaInvokeFlags(FunctionConnect)...)
+	flags = append(flags, offline.LambdaConcurrencyFlags(FunctionConnect)...)
 	flags = append(flags, offline.LambdaInvokeFlags(FunctionDisconnect)...)
+	flags = append(flags, offline.LambdaConcurrencyFlags(FunctionDisconnect)...)
+	flags = append(flags, offline.LambdaInvokeFlags(FunctionAuthorizer)...)
+	flags = append(flags, offline.LambdaConcurrencyFlags(FunctionAuthorizer)...)
 
 	app := &cli.App{
-		Name:  "api-gateway-websocket-emulator",
-		Usage: "Websocket server that emulates API Gateway websocket capabilities",
-		Flags: flags,
+		Name:   "api-gateway-websocket-emulator",
+		Usage:  "Websocket server that emulates API Gateway websocket capabilities",
+		Flags:  flags,
+		Before: offline.LoadRegistryFile,
 		Action: func(cliCtx *cli.Context) error {
 			//nolint:errcheck
 			defer logger.Sync()
@@ -176,75 +222,27 @@ func main() {
 				zap.Int("management.api.port", cliCtx.Int(ManagementAPIPort)),
 			)
 
-			resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...any) (aws.Endpoint, error) {
-				if service != kinesis.ServiceID {
-					return aws.Endpoint{}, fmt.Errorf("unsupported service %s", service)
-				}
-				if region != awsRegion {
-					return aws.Endpoint{}, fmt.Errorf("unsupported region %s", region)
-				}
-				return aws.Endpoint{
-					PartitionID:   "aws",
-					URL:           kinesisEndpoint,
-					SigningRegion: awsRegion,
-				}, nil
-			})
-
-			cfg, err := config.LoadDefaultConfig(
-				context.Background(),
-				config.WithRegion(awsRegion),
-				config.WithEndpointResolverWithOptions(resolver),
-				config.WithCredentialsProvider(
-					credentials.NewStaticCredentialsProvider("canned", "canned", "api-gateway-websocket-emulator"),
-				),
-			)
+			client, err := offline.KinesisClientFromCLI(cliCtx, "api-gateway-websocket-emulator")
 			if err != nil {
 				return err
 			}
 
-			var client = kinesis.NewFromConfig(cfg)
+			websocketPath := strings.TrimPrefix(cliCtx.String(WebsocketAPIStage), "/")
 			hub := websocket.NewHub()
+			hub.APIID = cliCtx.String(WebsocketAPIID)
+			hub.Stage = websocketPath
 			ctx := offline.TrapProcess()
 
 			go hub.Run(ctx)
-			hub.RegisterListener(&websocket.Listener{
-				ID: fmt.Sprintf("kinesis-listener-%s", streamName),
-				OnMessage: func(msg websocket.Msg) {
-					zap.L().Info("receive message from websocket connection for kinesis",
-						zap.String("connection.id", msg.ConnectionID),
-						zap.String("kinesis.stream", streamName),
-					)
-
-					// TODO: generate the following from the api gateway request template
-					templatedData := struct {
-						ConnectionID string `json:"connection_id"`
-						SentAtMillis int64  `json:"sent_at_millis"`
-						Data         []byte `json:"data"`
-					}{
-						ConnectionID: msg.ConnectionID,
-						SentAtMillis: time.Now().UnixNano() / int64(time.Millisecond),
-						Data:         msg.Data,
-					}
-
-					templatedDataBytes, err := json.Marshal(templatedData)
-					if err != nil {
-						zap.L().Error("failed to marshal templated data", zap.Error(err))
-						return
-					}
-
-					_, err = client.PutRecord(context.Background(), &kinesis.PutRecordInput{
-						Data:         []byte(base64.StdEncoding.EncodeToString(templatedDataBytes)),
-						StreamName:   aws.String(streamName),
-						PartitionKey: aws.String(msg.ConnectionID),
-					})
-					if err != nil {
-						zap.L().Error("failed to put record to kinesis", zap.Error(err))
-					}
-				},
-			})
-			registerConnectLambda(cliCtx, hub)
+			routes, err := routeTableFromCLI(cliCtx, client)
+			if err != nil {
+				return err
+			}
+			hub.RegisterListener(routes.Listener(ctx, "routes", hub))
+			if err := registerConnectLambda(ctx, cliCtx, hub); err != nil {
+				return err
+			}
 
-			websocketPath := strings.TrimPrefix(cliCtx.String(WebsocketAPIStage), "/")
 			mgmtRouter := mux.NewRouter()
 			mgmtRouter.HandleFunc(
 				fmt.Sprintf("/%s/@connections/{connectionID}", websocketPath),
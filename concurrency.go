@@ -0,0 +1,206 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	ReservedConcurrencyNamePrefix   = "reserved-concurrency"
+	EnvVarReservedConcurrencyPrefix = "LAMBDA_RESERVED_CONCURRENCY"
+	ErrorCodeTooManyRequests        = "TooManyRequestsException"
+	throttleReason                  = "ReservedFunctionConcurrentInvocationLimitExceeded"
+	throttleMessage                 = "Rate Exceeded."
+)
+
+// concurrencyLimiterKey is the app metadata key of the limiter returned by ConcurrencyLimiterFromCLI.
+const concurrencyLimiterKey = "offline.concurrencyLimiter"
+
+var concurrencyLimiterMu sync.Mutex
+
+// ConcurrencyLimiterFromCLI returns the limiter shared by the invokers built for the command, so that
+// every invoker of a function draws from the same reserved concurrency.
+func ConcurrencyLimiterFromCLI(cliCtx *cli.Context) *ConcurrencyLimiter {
+	concurrencyLimiterMu.Lock()
+	defer concurrencyLimiterMu.Unlock()
+
+	if limiter, ok := cliCtx.App.Metadata[concurrencyLimiterKey].(*ConcurrencyLimiter); ok {
+		return limiter
+	}
+	limiter := NewConcurrencyLimiter()
+	if cliCtx.App.Metadata == nil {
+		cliCtx.App.Metadata = make(map[string]interface{})
+	}
+	cliCtx.App.Metadata[concurrencyLimiterKey] = limiter
+
+	return limiter
+}
+
+// reservedConcurrencyFromCLI sets the reserved concurrency of the function configured by
+// LambdaConcurrencyFlags on the limiter of the command, and returns the limiter and the name the
+// function is limited by.
+func reservedConcurrencyFromCLI(cliCtx *cli.Context, functionName string) (*ConcurrencyLimiter, string) {
+	funcName, _ := SplitFunctionName(cliCtx.String(FunctionNameForFunction(functionName)))
+	limiter := ConcurrencyLimiterFromCLI(cliCtx)
+	if concurrencyName := ReservedConcurrencyNameForFunction(functionName); cliCtx.IsSet(concurrencyName) {
+		limiter.SetReservedConcurrency(funcName, cliCtx.Int(concurrencyName))
+	}
+
+	return limiter, funcName
+}
+
+// ConcurrencyLimiter emulates the reserved concurrency of lambda functions, throttling invocations
+// of a function while all of its reserved concurrency is in use.
+type ConcurrencyLimiter struct {
+	mu sync.Mutex
+	// Reserved concurrency by function name.
+	limits map[string]int
+	// Invocations in flight by function name.
+	inFlight map[string]int
+	// Closed and replaced whenever an invocation releases its concurrency.
+	released chan struct{}
+}
+
+func NewConcurrencyLimiter() *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		limits:   make(map[string]int),
+		inFlight: make(map[string]int),
+		released: make(chan struct{}),
+	}
+}
+
+// SetReservedConcurrency limits the concurrent invocations of the function, a negative limit removes
+// the reservation.
+func (l *ConcurrencyLimiter) SetReservedConcurrency(functionName string, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit < 0 {
+		delete(l.limits, functionName)
+		return
+	}
+	l.limits[functionName] = limit
+}
+
+// Limit wraps the invoker of the function so that it is throttled once the function's reserved
+// concurrency is exhausted.
+func (l *ConcurrencyLimiter) Limit(functionName string, invoker Invoker) Invoker {
+	return InvokeFunc(func(ctx context.Context, payload []byte) (*InvokeResult, error) {
+		// the caller already acquired the concurrency of the invocation, i.e. the async invoker
+		if held, ok := ctx.Value(concurrencyHolderKey{}).(acquiredConcurrency); ok &&
+			held.limiter == l && held.functionName == functionName {
+			return invoker.Invoke(ctx, payload)
+		}
+		if !l.acquire(functionName) {
+			return newThrottleResult()
+		}
+		defer l.release(functionName)
+
+		return invoker.Invoke(ctx, payload)
+	})
+}
+
+func (l *ConcurrencyLimiter) acquire(functionName string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit, ok := l.limits[functionName]; ok && l.inFlight[functionName] >= limit {
+		return false
+	}
+	l.inFlight[functionName]++
+	return true
+}
+
+// withAcquiredConcurrency marks the context of an invocation whose concurrency was acquired from the
+// limiter for the function, so that invokers of the function limited by it do not acquire it a second
+// time. Invocations of other functions made with the context still acquire their own concurrency.
+func withAcquiredConcurrency(ctx context.Context, l *ConcurrencyLimiter, functionName string) context.Context {
+	return context.WithValue(ctx, concurrencyHolderKey{}, acquiredConcurrency{limiter: l, functionName: functionName})
+}
+
+type concurrencyHolderKey struct{}
+
+// acquiredConcurrency is the concurrency an invocation holds.
+type acquiredConcurrency struct {
+	limiter      *ConcurrencyLimiter
+	functionName string
+}
+
+func (l *ConcurrencyLimiter) release(functionName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight[functionName]--
+	if l.inFlight[functionName] <= 0 {
+		delete(l.inFlight, functionName)
+	}
+
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// waitRelease returns a channel which is closed the next time an invocation releases its concurrency,
+// so that callers throttled by the limiter can try to acquire it again.
+func (l *ConcurrencyLimiter) waitRelease() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.released
+}
+
+// newThrottleResult reports a throttled invocation the way lambda does.
+func newThrottleResult() (*InvokeResult, error) {
+	payload, err := json.Marshal(map[string]string{
+		"Reason":  throttleReason,
+		"Type":    "User",
+		"message": throttleMessage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal throttle error: %w", err)
+	}
+
+	svcErr := &ServiceError{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       ErrorCodeTooManyRequests,
+		Message:    throttleMessage,
+		Result: &InvokeResult{
+			StatusCode: http.StatusTooManyRequests,
+			Payload:    payload,
+		},
+	}
+
+	return svcErr.Result, svcErr
+}
+
+func ReservedConcurrencyNameForFunction(functionName string) string {
+	if functionName == "" || functionName == FunctionNamePrefix {
+		return ReservedConcurrencyNamePrefix
+	}
+
+	return fmt.Sprintf("%s-%s", ReservedConcurrencyNamePrefix, functionName)
+}
+
+func EnvVarReservedConcurrencyForFunction(functionName string) string {
+	if functionName == "" || functionName == FunctionNamePrefix {
+		return EnvVarReservedConcurrencyPrefix
+	}
+
+	return fmt.Sprintf("%s_%s", EnvVarReservedConcurrencyPrefix, strings.ToUpper(functionName))
+}
+
+func LambdaConcurrencyFlags(functionName string) []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    ReservedConcurrencyNameForFunction(functionName),
+			EnvVars: []string{EnvVarReservedConcurrencyForFunction(functionName)},
+			Value:   -1,
+			Usage:   "Reserved concurrency of the lambda function, invocations beyond it are throttled. -1 for unreserved",
+		},
+	}
+}
@@ -0,0 +1,308 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// blockingInvoker invokes until released, reporting every started invocation.
+type blockingInvoker struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingInvoker() *blockingInvoker {
+	return &blockingInvoker{
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (i *blockingInvoker) Invoke(ctx context.Context, _ []byte) (*InvokeResult, error) {
+	i.started <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-i.release:
+		return &InvokeResult{StatusCode: http.StatusOK}, nil
+	}
+}
+
+// assertThrottled checks that the invocation was throttled the way lambda throttles it.
+func assertThrottled(t *testing.T, result *InvokeResult, err error) {
+	t.Helper()
+
+	var svcErr *ServiceError
+	if !errors.As(err, &svcErr) {
+		t.Fatalf("Invoke() error = %v, want a service error", err)
+	}
+	if !svcErr.Throttled() || svcErr.StatusCode != http.StatusTooManyRequests || svcErr.Code != ErrorCodeTooManyRequests {
+		t.Errorf("Invoke() error = %v, want a throttle", svcErr)
+	}
+	if result == nil || result.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Invoke() result = %v, want a 429 result", result)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(result.Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["Reason"] != throttleReason {
+		t.Errorf("throttle reason = %q, want %q", payload["Reason"], throttleReason)
+	}
+}
+
+func TestConcurrencyLimiterLimit(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetReservedConcurrency("hello", 1)
+
+	blocking := newBlockingInvoker()
+	invoker := limiter.Limit("hello", blocking)
+
+	done := make(chan error)
+	go func() {
+		_, err := invoker.Invoke(context.Background(), nil)
+		done <- err
+	}()
+	<-blocking.started
+
+	result, err := invoker.Invoke(context.Background(), nil)
+	assertThrottled(t, result, err)
+
+	// other functions do not draw from the reserved concurrency of the function
+	other := limiter.Limit("other", InvokeFunc(func(context.Context, []byte) (*InvokeResult, error) {
+		return &InvokeResult{StatusCode: http.StatusOK}, nil
+	}))
+	if _, err := other.Invoke(context.Background(), nil); err != nil {
+		t.Errorf("Invoke() of another function error = %v", err)
+	}
+
+	close(blocking.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoker.Invoke(context.Background(), nil); err != nil {
+		t.Errorf("Invoke() after the invocation completed error = %v", err)
+	}
+}
+
+func TestConcurrencyLimiterAcquiredConcurrency(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetReservedConcurrency("hello", 0)
+	limiter.SetReservedConcurrency("other", 0)
+
+	ok := InvokeFunc(func(context.Context, []byte) (*InvokeResult, error) {
+		return &InvokeResult{StatusCode: http.StatusOK}, nil
+	})
+	ctx := withAcquiredConcurrency(context.Background(), limiter, "hello")
+
+	// the invocation already holds the concurrency of the function
+	if _, err := limiter.Limit("hello", ok).Invoke(ctx, nil); err != nil {
+		t.Errorf("Invoke() with acquired concurrency error = %v", err)
+	}
+
+	// but not the concurrency of other functions invoked with its context
+	result, err := limiter.Limit("other", ok).Invoke(ctx, nil)
+	assertThrottled(t, result, err)
+
+	// nor the concurrency of another limiter
+	other := NewConcurrencyLimiter()
+	other.SetReservedConcurrency("hello", 0)
+	result, err = other.Limit("hello", ok).Invoke(ctx, nil)
+	assertThrottled(t, result, err)
+}
+
+func TestConcurrencyLimiterReservations(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		wantThrottled bool
+	}{
+		{name: "unreserved", limit: -1},
+		{name: "reserved", limit: 1},
+		{name: "zero", limit: 0, wantThrottled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewConcurrencyLimiter()
+			limiter.SetReservedConcurrency("hello", 2)
+			limiter.SetReservedConcurrency("hello", tt.limit)
+
+			invoker := limiter.Limit("hello", InvokeFunc(func(context.Context, []byte) (*InvokeResult, error) {
+				return &InvokeResult{StatusCode: http.StatusOK}, nil
+			}))
+			result, err := invoker.Invoke(context.Background(), nil)
+			if tt.wantThrottled {
+				assertThrottled(t, result, err)
+				return
+			}
+			if err != nil {
+				t.Errorf("Invoke() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestInvokerFromCLIReservedConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer server.Close()
+
+	flags := append(LambdaFlags(), LambdaInvokeFlags(FunctionNamePrefix)...)
+	flags = append(flags, LambdaConcurrencyFlags(FunctionNamePrefix)...)
+	cliCtx := newTestCLIContext(t, flags, "--lambda-endpoint", server.URL, "--reserved-concurrency", "1")
+
+	// invokers of the same function built for the command share its reserved concurrency
+	first, err := InvokerFromCLI(cliCtx, FunctionNamePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InvokerFromCLI(cliCtx, FunctionNamePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := first.Invoke(context.Background(), nil)
+		done <- err
+	}()
+	<-started
+
+	result, err := second.Invoke(context.Background(), nil)
+	assertThrottled(t, result, err)
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncInvokerReservedConcurrency(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetReservedConcurrency("hello", 1)
+
+	blocking := newBlockingInvoker()
+	invoker := limiter.Limit("hello", blocking)
+	asyncInvoker := NewAsyncInvoker(invoker, AsyncInvokerConfig{
+		MaximumEventAge: minAsyncEventAge,
+		FunctionArn:     LambdaFunctionArn("us-east-1", "hello"),
+		Concurrency:     limiter,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go asyncInvoker.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		if _, err := asyncInvoker.Invoke(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-blocking.started
+
+	// the event holds the reserved concurrency of the function, which throttles other invocations
+	// while the second event waits for it
+	result, err := invoker.Invoke(ctx, nil)
+	assertThrottled(t, result, err)
+	if depth := asyncInvoker.QueueDepth(); depth != 2 {
+		t.Errorf("QueueDepth() = %d, want 2", depth)
+	}
+
+	close(blocking.release)
+	if err := asyncInvoker.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if started := len(blocking.started); started != 1 {
+		t.Errorf("%d more invocations started, want 1", started)
+	}
+}
+
+func TestAsyncInvokerReservedConcurrencyReleasedBySync(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetReservedConcurrency("hello", 1)
+
+	blocking := newBlockingInvoker()
+	invoker := limiter.Limit("hello", blocking)
+	asyncInvoker := NewAsyncInvoker(invoker, AsyncInvokerConfig{
+		MaximumEventAge: minAsyncEventAge,
+		FunctionArn:     LambdaFunctionArn("us-east-1", "hello"),
+		Concurrency:     limiter,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a synchronous invocation holds the only reserved concurrency of the function
+	done := make(chan error)
+	go func() {
+		_, err := invoker.Invoke(ctx, nil)
+		done <- err
+	}()
+	<-blocking.started
+
+	if _, err := asyncInvoker.Invoke(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	go asyncInvoker.Run(ctx)
+	// the run loop takes the signal of the event once it failed to acquire the concurrency
+	for len(asyncInvoker.ready) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the queued event is invoked once the synchronous invocation releases the concurrency
+	close(blocking.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := asyncInvoker.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v, want the queued event invoked", err)
+	}
+	if started := len(blocking.started); started != 1 {
+		t.Errorf("%d more invocations started, want 1", started)
+	}
+}
+
+func TestAsyncInvokerReservedConcurrencyEventAge(t *testing.T) {
+	limiter := NewConcurrencyLimiter()
+	limiter.SetReservedConcurrency("hello", 0)
+
+	blocking := newBlockingInvoker()
+	onFailure := &recordingDestination{}
+	asyncInvoker := NewAsyncInvoker(limiter.Limit("hello", blocking), AsyncInvokerConfig{
+		MaximumEventAge: 20 * time.Millisecond,
+		FunctionArn:     LambdaFunctionArn("us-east-1", "hello"),
+		Concurrency:     limiter,
+		OnFailure:       onFailure,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go asyncInvoker.Run(ctx)
+
+	if _, err := asyncInvoker.Invoke(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the event expires while the function is throttled, rather than waiting for its concurrency
+	if err := asyncInvoker.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v, want the event discarded", err)
+	}
+	if conditions := onFailure.conditions(); !reflect.DeepEqual(conditions, []DestinationCondition{DestinationConditionEventAgeExceeded}) {
+		t.Errorf("on-failure conditions = %v, want the event age exceeded", conditions)
+	}
+	if started := len(blocking.started); started != 0 {
+		t.Errorf("%d invocations started, want none", started)
+	}
+}
@@ -0,0 +1,385 @@
+package offline
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+const (
+	templateAPIID          = "canned-api"
+	templateStage          = "local"
+	templateSourceIP       = "127.0.0.1"
+	templateUserAgent      = "aws-emulators"
+	templateRequestLayout  = "02/Jan/2006:15:04:05 -0700"
+	templateResourceName   = "canned-resource"
+	templateConnectionID   = "Y2FubmVkLWNvbm5lY3Rpb24="
+	templateDefaultMessage = `{"message":"hello"}`
+)
+
+// eventTemplate builds a sample event, placing the body where the event source would put the
+// payload of the event.
+type eventTemplate func(region string, body []byte, now time.Time) (interface{}, error)
+
+var eventTemplates = map[string]eventTemplate{
+	"apigw-v1":          apiGatewayV1Event,
+	"apigw-v2":          apiGatewayV2Event,
+	"websocket-connect": websocketConnectEvent,
+	"websocket-default": websocketDefaultEvent,
+	"kinesis":           kinesisTemplateEvent,
+	"sqs":               sqsEvent,
+	"sns":               snsEvent,
+	"s3":                s3Event,
+	"eventbridge":       eventBridgeEvent,
+	"dynamodb":          dynamoDBEvent,
+}
+
+// EventTemplateNames returns the names of the sample events of NewTemplateEvent.
+func EventTemplateNames() []string {
+	names := make([]string, 0, len(eventTemplates))
+	for name := range eventTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewTemplateEvent generates a sample event of the named event source with the shape of the
+// aws-lambda-go events, i.e. an SQS event with the body as the body of its message. The body may be
+// empty to use a placeholder, the s3 and dynamodb events do not carry one.
+func NewTemplateEvent(name, region string, body []byte) ([]byte, error) {
+	template, ok := eventTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event template %q, expected one of %s",
+			name, strings.Join(EventTemplateNames(), ", "))
+	}
+
+	event, err := template(region, body, time.Now().UTC().Truncate(time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(event)
+}
+
+func apiGatewayV1Event(region string, body []byte, now time.Time) (interface{}, error) {
+	return events.APIGatewayProxyRequest{
+		Resource:   "/{proxy+}",
+		Path:       "/hello",
+		HTTPMethod: "POST",
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Host":         templateDomainName(region),
+			"User-Agent":   templateUserAgent,
+		},
+		MultiValueHeaders: map[string][]string{
+			"Content-Type": {"application/json"},
+			"Host":         {templateDomainName(region)},
+			"User-Agent":   {templateUserAgent},
+		},
+		PathParameters: map[string]string{"proxy": "hello"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			AccountID:         cannedAccountID,
+			ResourceID:        templateResourceName,
+			Stage:             templateStage,
+			DomainName:        templateDomainName(region),
+			DomainPrefix:      templateAPIID,
+			RequestID:         uuid.New().String(),
+			ExtendedRequestID: uuid.New().String(),
+			Protocol:          "HTTP/1.1",
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  templateSourceIP,
+				UserAgent: templateUserAgent,
+			},
+			ResourcePath:     "/{proxy+}",
+			Path:             "/" + templateStage + "/hello",
+			HTTPMethod:       "POST",
+			RequestTime:      now.Format(templateRequestLayout),
+			RequestTimeEpoch: now.UnixMilli(),
+			APIID:            templateAPIID,
+		},
+		Body: templateBody(body),
+	}, nil
+}
+
+func apiGatewayV2Event(region string, body []byte, now time.Time) (interface{}, error) {
+	return events.APIGatewayV2HTTPRequest{
+		Version:  "2.0",
+		RouteKey: "POST /hello",
+		RawPath:  "/hello",
+		Headers: map[string]string{
+			"content-type": "application/json",
+			"host":         templateDomainName(region),
+			"user-agent":   templateUserAgent,
+		},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:     "POST /hello",
+			AccountID:    cannedAccountID,
+			Stage:        "$default",
+			RequestID:    uuid.New().String(),
+			APIID:        templateAPIID,
+			DomainName:   templateDomainName(region),
+			DomainPrefix: templateAPIID,
+			Time:         now.Format(templateRequestLayout),
+			TimeEpoch:    now.UnixMilli(),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    "POST",
+				Path:      "/hello",
+				Protocol:  "HTTP/1.1",
+				SourceIP:  templateSourceIP,
+				UserAgent: templateUserAgent,
+			},
+		},
+		Body: templateBody(body),
+	}, nil
+}
+
+func websocketConnectEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	if len(body) > 0 {
+		return nil, fmt.Errorf("the websocket-connect event does not carry a body")
+	}
+
+	event := websocketEvent(region, now, "$connect", "CONNECT")
+	event.Headers = map[string]string{
+		"Host":                  templateDomainName(region),
+		"Sec-WebSocket-Key":     "Y2FubmVkLXdlYnNvY2tldC1rZXk=",
+		"Sec-WebSocket-Version": "13",
+		"User-Agent":            templateUserAgent,
+	}
+	event.MultiValueHeaders = make(map[string][]string, len(event.Headers))
+	for key, value := range event.Headers {
+		event.MultiValueHeaders[key] = []string{value}
+	}
+
+	return event, nil
+}
+
+func websocketDefaultEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	event := websocketEvent(region, now, "$default", "MESSAGE")
+	event.RequestContext.MessageID = uuid.New().String()
+	event.Body = templateBody(body)
+
+	return event, nil
+}
+
+func websocketEvent(region string, now time.Time, routeKey, eventType string) events.APIGatewayWebsocketProxyRequest {
+	return events.APIGatewayWebsocketProxyRequest{
+		RequestContext: events.APIGatewayWebsocketProxyRequestContext{
+			AccountID:         cannedAccountID,
+			Stage:             templateStage,
+			RequestID:         uuid.New().String(),
+			ExtendedRequestID: uuid.New().String(),
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  templateSourceIP,
+				UserAgent: templateUserAgent,
+			},
+			APIID:            templateAPIID,
+			ConnectedAt:      now.UnixMilli(),
+			ConnectionID:     templateConnectionID,
+			DomainName:       templateDomainName(region),
+			EventType:        eventType,
+			MessageDirection: "IN",
+			RequestTime:      now.Format(templateRequestLayout),
+			RequestTimeEpoch: now.UnixMilli(),
+			RouteKey:         routeKey,
+		},
+	}
+}
+
+func kinesisTemplateEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	sequenceNumber := strconv.FormatInt(now.UnixNano(), 10)
+	return events.KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			{
+				AwsRegion:         region,
+				EventSource:       "aws:kinesis",
+				EventVersion:      "1.0",
+				EventID:           "shardId-000000000000:" + sequenceNumber,
+				EventName:         "aws:kinesis:record",
+				EventSourceArn:    fmt.Sprintf("arn:aws:kinesis:%s:%s:stream/canned-stream", region, cannedAccountID),
+				InvokeIdentityArn: fmt.Sprintf("arn:aws:iam::%s:role/canned-role", cannedAccountID),
+				Kinesis: events.KinesisRecord{
+					ApproximateArrivalTimestamp: events.SecondsEpochTime{Time: now},
+					Data:                        []byte(templateBody(body)),
+					PartitionKey:                "canned-partition-key",
+					SequenceNumber:              sequenceNumber,
+					KinesisSchemaVersion:        "1.0",
+				},
+			},
+		},
+	}, nil
+}
+
+func sqsEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	message := templateBody(body)
+	return events.SQSEvent{
+		Records: []events.SQSMessage{
+			{
+				MessageId:     uuid.New().String(),
+				ReceiptHandle: uuid.New().String(),
+				Body:          message,
+				Md5OfBody:     md5Hex(message),
+				Attributes: map[string]string{
+					"ApproximateReceiveCount":          "1",
+					"SentTimestamp":                    strconv.FormatInt(now.UnixMilli(), 10),
+					"SenderId":                         cannedAccountID,
+					"ApproximateFirstReceiveTimestamp": strconv.FormatInt(now.UnixMilli(), 10),
+				},
+				MessageAttributes: map[string]events.SQSMessageAttribute{},
+				EventSourceARN:    fmt.Sprintf("arn:aws:sqs:%s:%s:canned-queue", region, cannedAccountID),
+				EventSource:       "aws:sqs",
+				AWSRegion:         region,
+			},
+		},
+	}, nil
+}
+
+func snsEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:canned-topic", region, cannedAccountID)
+	return events.SNSEvent{
+		Records: []events.SNSEventRecord{
+			{
+				EventVersion:         "1.0",
+				EventSubscriptionArn: topicArn + ":" + uuid.New().String(),
+				EventSource:          "aws:sns",
+				SNS: events.SNSEntity{
+					Signature:         "EXAMPLE",
+					MessageID:         uuid.New().String(),
+					Type:              "Notification",
+					TopicArn:          topicArn,
+					MessageAttributes: map[string]interface{}{},
+					SignatureVersion:  "1",
+					Timestamp:         now,
+					SigningCertURL:    "https://sns." + region + ".amazonaws.com/SimpleNotificationService.pem",
+					Message:           templateBody(body),
+					UnsubscribeURL:    "https://sns." + region + ".amazonaws.com/?Action=Unsubscribe",
+				},
+			},
+		},
+	}, nil
+}
+
+func s3Event(region string, body []byte, now time.Time) (interface{}, error) {
+	if len(body) > 0 {
+		return nil, fmt.Errorf("the s3 event does not carry a body")
+	}
+
+	return events.S3Event{
+		Records: []events.S3EventRecord{
+			{
+				EventVersion: "2.1",
+				EventSource:  "aws:s3",
+				AWSRegion:    region,
+				EventTime:    now,
+				EventName:    "ObjectCreated:Put",
+				PrincipalID:  events.S3UserIdentity{PrincipalID: cannedAccountID},
+				RequestParameters: events.S3RequestParameters{
+					SourceIPAddress: templateSourceIP,
+				},
+				ResponseElements: map[string]string{
+					"x-amz-request-id": strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", ""))[:16],
+					"x-amz-id-2":       uuid.New().String(),
+				},
+				S3: events.S3Entity{
+					SchemaVersion:   "1.0",
+					ConfigurationID: "canned-notification",
+					Bucket: events.S3Bucket{
+						Name:          "canned-bucket",
+						OwnerIdentity: events.S3UserIdentity{PrincipalID: cannedAccountID},
+						Arn:           "arn:aws:s3:::canned-bucket",
+					},
+					Object: events.S3Object{
+						Key:           "canned-key.json",
+						Size:          int64(len(templateDefaultMessage)),
+						URLDecodedKey: "canned-key.json",
+						ETag:          md5Hex(templateDefaultMessage),
+						Sequencer:     fmt.Sprintf("%016X", now.UnixNano()),
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func eventBridgeEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	detail := json.RawMessage(templateBody(body))
+	if !json.Valid(detail) {
+		return nil, fmt.Errorf("the detail of an eventbridge event must be JSON")
+	}
+
+	return events.EventBridgeEvent{
+		Version:    "0",
+		ID:         uuid.New().String(),
+		DetailType: "Canned Event",
+		Source:     "aws-emulators",
+		AccountID:  cannedAccountID,
+		Time:       now,
+		Region:     region,
+		Resources:  []string{},
+		Detail:     detail,
+	}, nil
+}
+
+func dynamoDBEvent(region string, body []byte, now time.Time) (interface{}, error) {
+	if len(body) > 0 {
+		return nil, fmt.Errorf("the dynamodb event does not carry a body")
+	}
+
+	keys := map[string]events.DynamoDBAttributeValue{
+		"id": events.NewStringAttribute("canned-id"),
+	}
+	image := map[string]events.DynamoDBAttributeValue{
+		"id":      events.NewStringAttribute("canned-id"),
+		"message": events.NewStringAttribute("hello"),
+		"count":   events.NewNumberAttribute("1"),
+	}
+	sequenceNumber := strconv.FormatInt(now.UnixNano(), 10)
+
+	return events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			{
+				AWSRegion:    region,
+				EventID:      strings.ReplaceAll(uuid.New().String(), "-", ""),
+				EventName:    "INSERT",
+				EventSource:  "aws:dynamodb",
+				EventVersion: "1.1",
+				EventSourceArn: fmt.Sprintf("arn:aws:dynamodb:%s:%s:table/canned-table/stream/%s",
+					region, cannedAccountID, now.Format("2006-01-02T15:04:05.000")),
+				Change: events.DynamoDBStreamRecord{
+					ApproximateCreationDateTime: events.SecondsEpochTime{Time: now},
+					Keys:                        keys,
+					NewImage:                    image,
+					SequenceNumber:              sequenceNumber,
+					SizeBytes:                   int64(len(templateDefaultMessage)),
+					StreamViewType:              "NEW_AND_OLD_IMAGES",
+				},
+			},
+		},
+	}, nil
+}
+
+func templateDomainName(region string) string {
+	return fmt.Sprintf("%s.execute-api.%s.amazonaws.com", templateAPIID, region)
+}
+
+func templateBody(body []byte) string {
+	if len(body) == 0 {
+		return templateDefaultMessage
+	}
+
+	return string(body)
+}
+
+func md5Hex(value string) string {
+	sum := md5.Sum([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
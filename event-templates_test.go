@@ -0,0 +1,202 @@
+package offline
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// decodeTemplateEvent decodes a template event into its aws-lambda-go type, returning its region and
+// the field the event source puts the payload in, if any.
+type decodeTemplateEvent func(payload []byte) (region, body string, err error)
+
+func TestNewTemplateEvent(t *testing.T) {
+	const body = `{"id":1}`
+
+	tests := []struct {
+		name string
+		// Whether the event carries a body, the others refuse one
+		carriesBody bool
+		decode      decodeTemplateEvent
+	}{
+		{
+			name:        "apigw-v1",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.APIGatewayProxyRequest
+				err := json.Unmarshal(payload, &event)
+				return regionOfDomain(event.RequestContext.DomainName), event.Body, err
+			},
+		},
+		{
+			name:        "apigw-v2",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.APIGatewayV2HTTPRequest
+				err := json.Unmarshal(payload, &event)
+				return regionOfDomain(event.RequestContext.DomainName), event.Body, err
+			},
+		},
+		{
+			name: "websocket-connect",
+			decode: func(payload []byte) (string, string, error) {
+				var event events.APIGatewayWebsocketProxyRequest
+				err := json.Unmarshal(payload, &event)
+				if event.RequestContext.RouteKey != "$connect" {
+					t.Errorf("route key = %q, want $connect", event.RequestContext.RouteKey)
+				}
+				return regionOfDomain(event.RequestContext.DomainName), event.Body, err
+			},
+		},
+		{
+			name:        "websocket-default",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.APIGatewayWebsocketProxyRequest
+				err := json.Unmarshal(payload, &event)
+				if event.RequestContext.RouteKey != "$default" {
+					t.Errorf("route key = %q, want $default", event.RequestContext.RouteKey)
+				}
+				return regionOfDomain(event.RequestContext.DomainName), event.Body, err
+			},
+		},
+		{
+			name:        "kinesis",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.KinesisEvent
+				if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) != 1 {
+					return "", "", err
+				}
+				record := event.Records[0]
+				return record.AwsRegion, string(record.Kinesis.Data), nil
+			},
+		},
+		{
+			name:        "sqs",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.SQSEvent
+				if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) != 1 {
+					return "", "", err
+				}
+				record := event.Records[0]
+				if record.Md5OfBody != md5Hex(record.Body) {
+					t.Errorf("md5 of body = %s, want %s", record.Md5OfBody, md5Hex(record.Body))
+				}
+				return record.AWSRegion, record.Body, nil
+			},
+		},
+		{
+			name:        "sns",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.SNSEvent
+				if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) != 1 {
+					return "", "", err
+				}
+				// arn:aws:sns:region:account:topic
+				entity := event.Records[0].SNS
+				parts := strings.Split(entity.TopicArn, ":")
+				if len(parts) != 6 {
+					t.Fatalf("invalid topic ARN %q", entity.TopicArn)
+				}
+				return parts[3], entity.Message, nil
+			},
+		},
+		{
+			name: "s3",
+			decode: func(payload []byte) (string, string, error) {
+				var event events.S3Event
+				if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) != 1 {
+					return "", "", err
+				}
+				return event.Records[0].AWSRegion, "", nil
+			},
+		},
+		{
+			name:        "eventbridge",
+			carriesBody: true,
+			decode: func(payload []byte) (string, string, error) {
+				var event events.EventBridgeEvent
+				err := json.Unmarshal(payload, &event)
+				return event.Region, string(event.Detail), err
+			},
+		},
+		{
+			name: "dynamodb",
+			decode: func(payload []byte) (string, string, error) {
+				var event events.DynamoDBEvent
+				if err := json.Unmarshal(payload, &event); err != nil || len(event.Records) != 1 {
+					return "", "", err
+				}
+				return event.Records[0].AWSRegion, "", nil
+			},
+		},
+	}
+
+	if len(tests) != len(EventTemplateNames()) {
+		t.Errorf("%d templates tested, want every one of %v", len(tests), EventTemplateNames())
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := NewTemplateEvent(tt.name, "eu-west-1", []byte(body))
+			if !tt.carriesBody {
+				if err == nil {
+					t.Errorf("NewTemplateEvent() error = nil, want the body refused")
+				}
+				// the events without a body are generated from the placeholder alone
+				if payload, err = NewTemplateEvent(tt.name, "eu-west-1", nil); err != nil {
+					t.Fatalf("NewTemplateEvent() error = %v", err)
+				}
+				region, _, err := tt.decode(payload)
+				if err != nil || region != "eu-west-1" {
+					t.Errorf("decoded region = %q, %v, want eu-west-1", region, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTemplateEvent() error = %v", err)
+			}
+
+			region, got, err := tt.decode(payload)
+			if err != nil {
+				t.Fatalf("failed to decode %s: %v", payload, err)
+			}
+			if region != "eu-west-1" {
+				t.Errorf("region = %q, want eu-west-1", region)
+			}
+			if got != body {
+				t.Errorf("body = %q, want %q", got, body)
+			}
+
+			// an empty body is replaced by the placeholder
+			payload, err = NewTemplateEvent(tt.name, "eu-west-1", nil)
+			if err != nil {
+				t.Fatalf("NewTemplateEvent() error = %v", err)
+			}
+			if _, got, err = tt.decode(payload); err != nil || got != templateDefaultMessage {
+				t.Errorf("body = %q, %v, want the placeholder %q", got, err, templateDefaultMessage)
+			}
+		})
+	}
+}
+
+func TestNewTemplateEventUnknown(t *testing.T) {
+	if _, err := NewTemplateEvent("carrier-pigeon", "eu-west-1", nil); err == nil {
+		t.Error("NewTemplateEvent() error = nil, want the unknown template refused")
+	}
+}
+
+// regionOfDomain returns the region of an API gateway domain name.
+func regionOfDomain(domainName string) string {
+	// api.execute-api.region.amazonaws.com
+	parts := strings.Split(domainName, ".")
+	if len(parts) != 5 {
+		return ""
+	}
+	return parts[2]
+}
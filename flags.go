@@ -0,0 +1,38 @@
+package offline
+
+import (
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// DefinitionsValue collects the repeated key=value;key=value definitions of a flag. Unlike a string
+// slice flag it does not split values on commas, which the JSON and URLs of definitions may contain,
+// so several definitions in an environment variable are separated by newlines instead.
+type DefinitionsValue struct {
+	definitions []string
+}
+
+func (v *DefinitionsValue) Set(value string) error {
+	for _, definition := range strings.Split(value, "\n") {
+		if definition = strings.TrimSpace(definition); definition != "" {
+			v.definitions = append(v.definitions, definition)
+		}
+	}
+
+	return nil
+}
+
+func (v *DefinitionsValue) String() string {
+	return strings.Join(v.definitions, "\n")
+}
+
+// DefinitionsFromCLI returns the definitions of a flag whose value is a DefinitionsValue.
+func DefinitionsFromCLI(cliCtx *cli.Context, name string) []string {
+	value, ok := cliCtx.Generic(name).(*DefinitionsValue)
+	if !ok {
+		return nil
+	}
+
+	return value.definitions
+}
@@ -0,0 +1,190 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambda/messages"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/uuid"
+)
+
+// traceIDContextKey is the context key the aws-lambda-go runtime stores the X-Ray trace header
+// under, which the X-Ray SDK reads it from.
+const traceIDContextKey = "x-amzn-trace-id"
+
+// Maximum number of stack frames reported when a handler panics, like the go runtime.
+const maxPanicFrames = 32
+
+// HandlerInvoker invokes an aws-lambda-go handler in process, without a lambda runtime, so that
+// emulators can be wired directly to handler code in tests.
+type HandlerInvoker struct {
+	// Name of the function the handler implements
+	FunctionName string
+	// Region of the function, used to build its ARN
+	Region string
+	// Maximum duration of an invocation, no timeout is enforced when zero
+	Timeout time.Duration
+
+	handler lambda.Handler
+}
+
+// NewHandlerInvoker builds an invoker for a lambda.Handler or any handler function accepted by
+// lambda.Start.
+func NewHandlerInvoker(functionName string, handler interface{}) *HandlerInvoker {
+	region := os.Getenv(EnvVarAwsRegion)
+	if region == "" {
+		region = defaultAwsRegion
+	}
+
+	return &HandlerInvoker{
+		FunctionName: functionName,
+		Region:       region,
+		handler:      lambda.NewHandler(handler),
+	}
+}
+
+func (i *HandlerInvoker) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	if i.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, i.Timeout, errTaskTimedOut)
+		defer cancel()
+	}
+
+	requestID := uuid.New().String()
+	ctx = i.handlerContext(ctx, requestID)
+
+	// run the handler aside so that the invocation times out even when it ignores its context
+	done := make(chan *InvokeResult, 1)
+	go func() {
+		done <- i.invoke(ctx, requestID, payload)
+	}()
+
+	select {
+	case result := <-done:
+		if result.FunctionError != "" {
+			return result, newHandlerFunctionError(result)
+		}
+		return result, nil
+	case <-ctx.Done():
+		if errors.Is(context.Cause(ctx), errTaskTimedOut) {
+			return newTimeoutResult(i.Timeout)
+		}
+		return nil, fmt.Errorf("failed to invoke lambda: %w", ctx.Err())
+	}
+}
+
+// handlerContext populates the context the way the aws-lambda-go runtime does for each invocation.
+func (i *HandlerInvoker) handlerContext(ctx context.Context, requestID string) context.Context {
+	lc := &lambdacontext.LambdaContext{
+		AwsRequestID:       requestID,
+		InvokedFunctionArn: LambdaFunctionArn(i.Region, i.FunctionName),
+	}
+	if clientContext, ok := ClientContextFromContext(ctx); ok {
+		lc.ClientContext = *clientContext
+	}
+	ctx = lambdacontext.NewContext(ctx, lc)
+
+	traceID, ok := TraceIDFromContext(ctx)
+	if !ok {
+		traceID = NewTraceID()
+	}
+	//nolint:staticcheck
+	return context.WithValue(ctx, traceIDContextKey, traceID)
+}
+
+func (i *HandlerInvoker) invoke(ctx context.Context, requestID string, payload []byte) (result *InvokeResult) {
+	result = &InvokeResult{
+		StatusCode:      http.StatusOK,
+		RequestID:       requestID,
+		ExecutedVersion: latestVersion,
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.FunctionError = FunctionErrorUnhandled
+			result.Payload = marshalErrorPayload(ErrorPayload{
+				ErrorType:    errorTypeOf(r),
+				ErrorMessage: fmt.Sprintf("%v", r),
+				StackTrace:   panicStackTrace(),
+			})
+		}
+	}()
+
+	response, err := i.handler.Invoke(ctx, payload)
+	if err != nil {
+		errorPayload := ErrorPayload{
+			ErrorType:    errorTypeOf(err),
+			ErrorMessage: err.Error(),
+		}
+		var invokeErr messages.InvokeResponse_Error
+		if errors.As(err, &invokeErr) {
+			errorPayload.ErrorType = invokeErr.Type
+			errorPayload.ErrorMessage = invokeErr.Message
+		}
+
+		// the handler returned the error, unlike a panic which the runtime recovers
+		result.FunctionError = FunctionErrorHandled
+		result.Payload = marshalErrorPayload(errorPayload)
+		return result
+	}
+
+	result.Payload = response
+	return result
+}
+
+func newHandlerFunctionError(result *InvokeResult) *FunctionError {
+	fnErr := &FunctionError{
+		Kind:   result.FunctionError,
+		Result: result,
+	}
+	_ = json.Unmarshal(result.Payload, &fnErr.ErrorPayload)
+
+	return fnErr
+}
+
+// errorTypeOf names the type of an error or panic value, like the go runtime reports it.
+func errorTypeOf(value interface{}) string {
+	errorType := reflect.TypeOf(value)
+	if errorType.Kind() == reflect.Ptr {
+		return errorType.Elem().Name()
+	}
+
+	return errorType.Name()
+}
+
+func marshalErrorPayload(errorPayload ErrorPayload) []byte {
+	payload, err := json.Marshal(errorPayload)
+	if err != nil {
+		return []byte(fmt.Sprintf(`{"errorMessage":%q}`, errorPayload.ErrorMessage))
+	}
+
+	return payload
+}
+
+// panicStackTrace formats the stack of a recovered panic, skipping the recovery frames.
+func panicStackTrace() []string {
+	pcs := make([]uintptr, maxPanicFrames)
+	// runtime.Callers -> panicStackTrace -> deferred recover -> runtime.gopanic
+	n := runtime.Callers(4, pcs)
+
+	var stackTrace []string
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		stackTrace = append(stackTrace, fmt.Sprintf("%s:%d %s", frame.File, frame.Line, frame.Function))
+		if !more {
+			break
+		}
+	}
+
+	return stackTrace
+}
@@ -0,0 +1,175 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+func TestHandlerInvoker(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     interface{}
+		wantPayload string
+		wantError   ErrorPayload
+		wantKind    FunctionErrorKind
+	}{
+		{
+			name:        "response",
+			handler:     func(event map[string]string) (string, error) { return "hello " + event["name"], nil },
+			wantPayload: `"hello world"`,
+		},
+		{
+			name:      "error",
+			handler:   func() error { return errors.New("boom") },
+			wantError: ErrorPayload{ErrorType: "errorString", ErrorMessage: "boom"},
+			wantKind:  FunctionErrorHandled,
+		},
+		{
+			name:      "panic",
+			handler:   func() error { panic(errors.New("boom")) },
+			wantError: ErrorPayload{ErrorType: "errorString", ErrorMessage: "boom"},
+			wantKind:  FunctionErrorUnhandled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := NewHandlerInvoker("hello", tt.handler)
+
+			result, err := invoker.Invoke(context.Background(), []byte(`{"name":"world"}`))
+			if tt.wantError.ErrorMessage == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(result.Payload) != tt.wantPayload || result.RequestID == "" {
+					t.Errorf("Invoke() = %s with request ID %q, want %s", result.Payload, result.RequestID, tt.wantPayload)
+				}
+				return
+			}
+
+			var fnErr *FunctionError
+			if !errors.As(err, &fnErr) {
+				t.Fatalf("Invoke() error = %v, want a function error", err)
+			}
+			if fnErr.Kind != tt.wantKind || fnErr.ErrorType != tt.wantError.ErrorType || fnErr.ErrorMessage != tt.wantError.ErrorMessage {
+				t.Errorf("Invoke() error = %s %+v, want %s %+v", fnErr.Kind, fnErr.ErrorPayload, tt.wantKind, tt.wantError)
+			}
+			if fnErr.Result != result || result.FunctionError != tt.wantKind {
+				t.Errorf("function error result = %+v, want the %s result of the invocation", fnErr.Result, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestHandlerInvokerPanicStackTrace(t *testing.T) {
+	invoker := NewHandlerInvoker("hello", func() error { panic("boom") })
+
+	_, err := invoker.Invoke(context.Background(), []byte(`{}`))
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) {
+		t.Fatalf("Invoke() error = %v, want a function error", err)
+	}
+	if fnErr.ErrorType != "string" || fnErr.ErrorMessage != "boom" {
+		t.Errorf("Invoke() error = %+v, want the panic value", fnErr.ErrorPayload)
+	}
+	// the stack starts at the handler which panicked rather than at the recovery
+	if len(fnErr.StackTrace) == 0 || !strings.Contains(fnErr.StackTrace[0], "TestHandlerInvokerPanicStackTrace") {
+		t.Errorf("stack trace = %q, want the frames of the handler", fnErr.StackTrace)
+	}
+}
+
+func TestHandlerInvokerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	// the handler ignores its context, the invocation times out all the same
+	invoker := NewHandlerInvoker("hello", func() error {
+		<-release
+		return nil
+	})
+	invoker.Timeout = 10 * time.Millisecond
+
+	result, err := invoker.Invoke(context.Background(), []byte(`{}`))
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) || !fnErr.Timeout() {
+		t.Fatalf("Invoke() error = %v, want a timeout", err)
+	}
+	if result == nil || result.FunctionError != FunctionErrorUnhandled {
+		t.Errorf("Invoke() = %+v, want an unhandled error result", result)
+	}
+	if !strings.Contains(fnErr.ErrorMessage, "Task timed out after 0.01 seconds") {
+		t.Errorf("Invoke() error message = %q, want the timeout of the function", fnErr.ErrorMessage)
+	}
+}
+
+func TestHandlerInvokerCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	invoker := NewHandlerInvoker("hello", func(ctx context.Context) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	invoker.Timeout = time.Minute
+
+	// a cancelled invocation is not reported as a timeout of the function
+	_, err := invoker.Invoke(ctx, []byte(`{}`))
+	var fnErr *FunctionError
+	if err == nil || errors.As(err, &fnErr) && fnErr.Timeout() {
+		t.Errorf("Invoke() error = %v, want the cancellation of the invocation", err)
+	}
+}
+
+func TestHandlerInvokerContext(t *testing.T) {
+	const traceID = "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1"
+	clientContext := &lambdacontext.ClientContext{
+		Client: lambdacontext.ClientApplication{AppTitle: "app"},
+		Custom: map[string]string{"tenant": "acme"},
+	}
+
+	var (
+		lc     *lambdacontext.LambdaContext
+		traced interface{}
+	)
+	invoker := NewHandlerInvoker("hello", func(ctx context.Context) error {
+		lc, _ = lambdacontext.FromContext(ctx)
+		traced = ctx.Value(traceIDContextKey)
+		return nil
+	})
+	invoker.Region = "eu-west-1"
+
+	ctx := WithClientContext(WithTraceID(context.Background(), traceID), clientContext)
+	result, err := invoker.Invoke(ctx, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lc == nil {
+		t.Fatal("handler context has no lambda context")
+	}
+	if lc.AwsRequestID != result.RequestID {
+		t.Errorf("AwsRequestID = %q, want the request ID of the invocation %q", lc.AwsRequestID, result.RequestID)
+	}
+	if want := "arn:aws:lambda:eu-west-1:000000000000:function:hello"; lc.InvokedFunctionArn != want {
+		t.Errorf("InvokedFunctionArn = %q, want %q", lc.InvokedFunctionArn, want)
+	}
+	if !reflect.DeepEqual(lc.ClientContext, *clientContext) {
+		t.Errorf("ClientContext = %+v, want %+v", lc.ClientContext, *clientContext)
+	}
+	if traced != traceID {
+		t.Errorf("trace = %v, want the forwarded trace %q", traced, traceID)
+	}
+
+	// a new trace is started when none is forwarded
+	if _, err := invoker.Invoke(context.Background(), []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if trace, _ := traced.(string); trace == "" || trace == traceID {
+		t.Errorf("trace without a forwarded trace = %v, want a new trace", traced)
+	}
+}
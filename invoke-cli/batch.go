@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	Concurrency = "concurrency"
+	Rate        = "rate"
+	Results     = "results"
+)
+
+// maxPayloadLineSize fits the largest synchronous lambda payload on a single line.
+const maxPayloadLineSize = 6*1024*1024 + 1024
+
+func batchCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "batch",
+		Usage:     "Invoke the lambda function with each payload of a JSONL file and report the latencies",
+		ArgsUsage: "<file.jsonl | ->",
+		Description: "Each non-empty line of the file is a payload, wrapped in the event template and " +
+			"updated by the set flags of the invoke command. A JSON result is written for each line, in the " +
+			"order of the file, and a summary of the latencies and errors is written to stderr",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:    Concurrency,
+				Aliases: []string{"c"},
+				Value:   1,
+				Usage:   "Number of invocations in flight at once",
+			},
+			&cli.Float64Flag{
+				Name:  Rate,
+				Usage: "Maximum number of invocations started per second, 0 for no limit",
+			},
+			&cli.StringFlag{
+				Name:  Results,
+				Usage: "File to write the results to instead of stdout",
+			},
+		},
+		Action: runBatch,
+	}
+}
+
+// batchInvocation is a payload of the input file.
+type batchInvocation struct {
+	index   int
+	line    int
+	payload []byte
+}
+
+// batchResult is the result of a payload as written to the results.
+type batchResult struct {
+	Line int `json:"line"`
+	invocationOutput
+
+	index int
+}
+
+func runBatch(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.Exit("batch expects the JSONL file of payloads as its only argument", exitCodeUsage)
+	}
+	concurrency := ctx.Int(Concurrency)
+	if concurrency < 1 {
+		return cli.Exit(fmt.Sprintf("invalid concurrency %d", concurrency), exitCodeUsage)
+	}
+	interval, err := rateInterval(ctx, Rate)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	input := io.Reader(os.Stdin)
+	if path := ctx.Args().First(); path != stdinPayload {
+		file, err := os.Open(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to open payloads: %v", err), exitCodeUsage)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	results := ctx.App.Writer
+	if path := ctx.String(Results); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to create results: %v", err), exitCodeUsage)
+		}
+		defer file.Close()
+		results = file
+	}
+
+	invoker, err := offline.InvokerFromCLI(ctx, Function)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+	invokeCtx, err := invokeContext(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	invocations := make(chan batchInvocation)
+	outputs := make(chan batchResult)
+	stats := newInvocationStats()
+	start := time.Now()
+
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for invocation := range invocations {
+				outputs <- invokeBatch(invokeCtx, invoker, invocation, stats)
+			}
+		}()
+	}
+
+	writeErr := make(chan error, 1)
+	exitCodes := make(chan int, 1)
+	go func() {
+		code, err := writeBatchResults(results, outputs)
+		exitCodes <- code
+		writeErr <- err
+	}()
+
+	readErr := readBatch(ctx, input, invocations, interval)
+	close(invocations)
+	workers.Wait()
+	close(outputs)
+
+	code := <-exitCodes
+	if err := <-writeErr; err != nil {
+		return cli.Exit(fmt.Sprintf("failed to write results: %v", err), exitCodeUsage)
+	}
+	stats.writeSummary(ctx.App.ErrWriter, time.Since(start))
+
+	if readErr != nil {
+		return cli.Exit(readErr.Error(), exitCodeUsage)
+	}
+	if code != exitCodeSuccess {
+		return cli.Exit("", code)
+	}
+
+	return nil
+}
+
+// rateInterval returns the interval between invocations at the rate of the flag, 0 when no rate is
+// set. The invocations are paced by a ticker, which needs an interval of at least a nanosecond.
+func rateInterval(ctx *cli.Context, name string) (time.Duration, error) {
+	rate := ctx.Float64(name)
+	if rate <= 0 {
+		return 0, nil
+	}
+
+	interval := time.Duration(float64(time.Second) / rate)
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid %s %g, at most %d invocations per second", name, rate, time.Second)
+	}
+
+	return interval, nil
+}
+
+// readBatch sends the payloads of the input to the invocations one interval apart, stopping at the
+// first invalid payload.
+func readBatch(ctx *cli.Context, input io.Reader, invocations chan<- batchInvocation, interval time.Duration) error {
+	var throttle <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxPayloadLineSize)
+	index := 0
+	for line := 1; scanner.Scan(); line++ {
+		body := scanner.Bytes()
+		if len(body) == 0 {
+			continue
+		}
+
+		payload, err := newPayload(ctx, append([]byte(nil), body...))
+		if err != nil {
+			return fmt.Errorf("invalid payload on line %d: %w", line, err)
+		}
+
+		if throttle != nil && index > 0 {
+			select {
+			case <-ctx.Context.Done():
+				return ctx.Context.Err()
+			case <-throttle:
+			}
+		}
+
+		invocations <- batchInvocation{index: index, line: line, payload: payload}
+		index++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read payloads: %w", err)
+	}
+
+	return nil
+}
+
+func invokeBatch(
+	ctx context.Context,
+	invoker offline.Invoker,
+	invocation batchInvocation,
+	stats *invocationStats,
+) batchResult {
+	start := time.Now()
+	result, err := invoker.Invoke(ctx, invocation.payload)
+	latency := time.Since(start)
+	stats.add(latency, err)
+
+	return batchResult{
+		Line:             invocation.line,
+		invocationOutput: newInvocationOutput(result, err, latency),
+		index:            invocation.index,
+	}
+}
+
+// writeBatchResults writes the results in the order of the input, returning the exit code of the
+// first failed invocation.
+func writeBatchResults(w io.Writer, outputs <-chan batchResult) (int, error) {
+	encoder := json.NewEncoder(w)
+	code := exitCodeSuccess
+	var writeErr error
+
+	// results complete out of order with concurrent invocations, so they are held until their turn
+	pending := make(map[int]batchResult)
+	next := 0
+	for output := range outputs {
+		pending[output.index] = output
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if code == exitCodeSuccess {
+				code = result.ExitCode
+			}
+			if writeErr == nil {
+				writeErr = encoder.Encode(result)
+			}
+		}
+	}
+
+	return code, writeErr
+}
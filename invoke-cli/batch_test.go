@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+func TestWriteBatchResults(t *testing.T) {
+	outputs := make(chan batchResult, 3)
+	// results complete out of order, the second failing
+	outputs <- batchResult{Line: 3, index: 2, invocationOutput: invocationOutput{StatusCode: http.StatusOK, ExitCode: exitCodeTimeout}}
+	outputs <- batchResult{Line: 2, index: 1, invocationOutput: invocationOutput{StatusCode: http.StatusOK, ExitCode: exitCodeFunctionError}}
+	outputs <- batchResult{Line: 1, index: 0, invocationOutput: invocationOutput{StatusCode: http.StatusOK}}
+	close(outputs)
+
+	var results bytes.Buffer
+	code, err := writeBatchResults(&results, outputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != exitCodeFunctionError {
+		t.Errorf("exit code = %d, want the first failure %d", code, exitCodeFunctionError)
+	}
+
+	var lines []int
+	decoder := json.NewDecoder(&results)
+	for decoder.More() {
+		var result batchResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, result.Line)
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	// the lambda echoes the payload, failing for the payloads asking to
+	lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail") {
+			w.Header().Set(offline.HeaderFunctionError, "Unhandled")
+		}
+		// later lines complete first
+		if strings.Contains(string(body), `"id":1`) {
+			time.Sleep(20 * time.Millisecond)
+		}
+		_, _ = w.Write(body)
+	})
+
+	payloads := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := os.WriteFile(payloads, []byte("{\"id\":1}\n\n{\"id\":2,\"fail\":true}\n{\"id\":3}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL, "batch", "--concurrency", "3", payloads)
+	if code != exitCodeFunctionError {
+		t.Errorf("exit code = %d, want %d", code, exitCodeFunctionError)
+	}
+
+	var lines []int
+	var payloadsOut []string
+	decoder := json.NewDecoder(strings.NewReader(stdout))
+	for decoder.More() {
+		var result struct {
+			Line    int             `json:"line"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, result.Line)
+		payloadsOut = append(payloadsOut, string(result.Payload))
+	}
+	if want := []int{1, 3, 4}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+	if want := []string{`{"id":1}`, `{"id":2,"fail":true}`, `{"id":3}`}; !reflect.DeepEqual(payloadsOut, want) {
+		t.Errorf("payloads = %q, want %q", payloadsOut, want)
+	}
+	if !strings.Contains(stderr, "invocations: 3, succeeded: 2, failed: 1") || !strings.Contains(stderr, "errors: function error: 1") {
+		t.Errorf("summary = %q, want the counts of the invocations", stderr)
+	}
+}
+
+func TestBatchInvalidPayload(t *testing.T) {
+	lambda := newTestLambda(t, respond(http.StatusOK, nil, `"ok"`))
+
+	payloads := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := os.WriteFile(payloads, []byte("{}\nnot json\n{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// the set flags apply to JSON payloads alone
+	stdout, _, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL, "--set", "id=1", "batch", payloads)
+	if code != exitCodeUsage {
+		t.Errorf("exit code = %d, want %d", code, exitCodeUsage)
+	}
+	// the payloads before the invalid line are still invoked
+	if lines := strings.Count(stdout, "\n"); lines != 1 {
+		t.Errorf("results = %q, want the first line alone", stdout)
+	}
+}
+
+func TestBatchUsage(t *testing.T) {
+	payloads := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := os.WriteFile(payloads, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "missing payloads argument", args: []string{"batch"}},
+		{name: "invalid concurrency", args: []string{"batch", "--concurrency", "0", payloads}},
+		{name: "rate beyond the ticker resolution", args: []string{"batch", "--rate", "2e9", payloads}},
+		{name: "missing payloads", args: []string{"batch", filepath.Join(t.TempDir(), "missing.jsonl")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, code := runInvoke(t, "", tt.args...); code != exitCodeUsage {
+				t.Errorf("exit code = %d, want %d", code, exitCodeUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sort"
+)
+
+// jsonDifference is a value which differs between two JSON documents.
+type jsonDifference struct {
+	path     []jsonPathSegment
+	expected interface{}
+	actual   interface{}
+	// whether the value is only present in the expected or actual document
+	missing    bool
+	unexpected bool
+}
+
+func (d jsonDifference) String() string {
+	path := formatJSONPath(d.path)
+	if path == "" {
+		path = "."
+	}
+
+	switch {
+	case d.missing:
+		return fmt.Sprintf("%s: missing, expected %s", path, formatJSONValue(d.expected))
+	case d.unexpected:
+		return fmt.Sprintf("%s: unexpected %s", path, formatJSONValue(d.actual))
+	default:
+		return fmt.Sprintf("%s: expected %s, got %s", path, formatJSONValue(d.expected), formatJSONValue(d.actual))
+	}
+}
+
+// Change describes the difference as a change from the expected to the actual value.
+func (d jsonDifference) Change() string {
+	path := formatJSONPath(d.path)
+	if path == "" {
+		path = "."
+	}
+
+	switch {
+	case d.missing:
+		return fmt.Sprintf("%s: removed %s", path, formatJSONValue(d.expected))
+	case d.unexpected:
+		return fmt.Sprintf("%s: added %s", path, formatJSONValue(d.actual))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", path, formatJSONValue(d.expected), formatJSONValue(d.actual))
+	}
+}
+
+// diffJSON compares two payloads, as JSON documents when both are JSON so that formatting and the
+// order of keys do not matter, or byte for byte otherwise. Differences at or under the ignored paths
+// are left out.
+func diffJSON(expected, actual []byte, ignored [][]jsonPathSegment) []jsonDifference {
+	expectedDocument, expectedErr := decodeJSONDocument(expected)
+	actualDocument, actualErr := decodeJSONDocument(actual)
+	if expectedErr != nil || actualErr != nil {
+		if bytes.Equal(bytes.TrimSpace(expected), bytes.TrimSpace(actual)) {
+			return nil
+		}
+		return []jsonDifference{{expected: string(expected), actual: string(actual)}}
+	}
+
+	var differences []jsonDifference
+	diffJSONValues(nil, expectedDocument, actualDocument, ignored, &differences)
+	return differences
+}
+
+// decodeJSONDocument decodes a payload with its numbers kept as written, so that integers beyond the
+// precision of a float64 are compared exactly.
+func decodeJSONDocument(payload []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+
+	return document, nil
+}
+
+func diffJSONValues(
+	path []jsonPathSegment,
+	expected, actual interface{},
+	ignored [][]jsonPathSegment,
+	differences *[]jsonDifference,
+) {
+	if isIgnored(path, ignored) {
+		return
+	}
+
+	// the path is copied for each child so that differences do not share its backing array
+	child := func(segment jsonPathSegment) []jsonPathSegment {
+		return append(append([]jsonPathSegment(nil), path...), segment)
+	}
+
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(expectedValue)+len(actualValue))
+		for key := range expectedValue {
+			keys = append(keys, key)
+		}
+		for key := range actualValue {
+			if _, ok := expectedValue[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := child(jsonPathSegment{key: key})
+			expectedChild, inExpected := expectedValue[key]
+			actualChild, inActual := actualValue[key]
+			switch {
+			case !inActual:
+				if !isIgnored(keyPath, ignored) {
+					*differences = append(*differences, jsonDifference{path: keyPath, expected: expectedChild, missing: true})
+				}
+			case !inExpected:
+				if !isIgnored(keyPath, ignored) {
+					*differences = append(*differences, jsonDifference{path: keyPath, actual: actualChild, unexpected: true})
+				}
+			default:
+				diffJSONValues(keyPath, expectedChild, actualChild, ignored, differences)
+			}
+		}
+		return
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+
+		for i := 0; i < len(expectedValue) || i < len(actualValue); i++ {
+			indexPath := child(jsonPathSegment{index: i, array: true})
+			switch {
+			case i >= len(actualValue):
+				if !isIgnored(indexPath, ignored) {
+					*differences = append(*differences, jsonDifference{path: indexPath, expected: expectedValue[i], missing: true})
+				}
+			case i >= len(expectedValue):
+				if !isIgnored(indexPath, ignored) {
+					*differences = append(*differences, jsonDifference{path: indexPath, actual: actualValue[i], unexpected: true})
+				}
+			default:
+				diffJSONValues(indexPath, expectedValue[i], actualValue[i], ignored, differences)
+			}
+		}
+		return
+	}
+
+	if expectedNumber, ok := expected.(json.Number); ok {
+		if actualNumber, ok := actual.(json.Number); ok && equalJSONNumbers(expectedNumber, actualNumber) {
+			return
+		}
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		*differences = append(*differences, jsonDifference{path: path, expected: expected, actual: actual})
+	}
+}
+
+// equalJSONNumbers compares numbers by value, i.e. 1, 1.0 and 1e0 are equal, without rounding them.
+func equalJSONNumbers(a, b json.Number) bool {
+	if a == b {
+		return true
+	}
+
+	x, ok := new(big.Rat).SetString(string(a))
+	if !ok {
+		return false
+	}
+	y, ok := new(big.Rat).SetString(string(b))
+	if !ok {
+		return false
+	}
+
+	return x.Cmp(y) == 0
+}
+
+func isIgnored(path []jsonPathSegment, ignored [][]jsonPathSegment) bool {
+	for _, pattern := range ignored {
+		if matchJSONPath(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJSONPaths parses the paths of a flag.
+func parseJSONPaths(paths []string) ([][]jsonPathSegment, error) {
+	patterns := make([][]jsonPathSegment, 0, len(paths))
+	for _, path := range paths {
+		pattern, err := parseJSONPath(path)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func formatJSONValue(value interface{}) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encoded)
+}
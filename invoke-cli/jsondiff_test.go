@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		ignored  []string
+		// differences formatted by their String method
+		want []string
+	}{
+		{
+			name:     "equal documents",
+			expected: `{"a": 1, "b": [true, null]}`,
+			actual:   `{"b":[true,null],"a":1}`,
+		},
+		{
+			name:     "changed value",
+			expected: `{"status": "ok", "count": 1}`,
+			actual:   `{"status": "ok", "count": 2}`,
+			want:     []string{"count: expected 1, got 2"},
+		},
+		{
+			name:     "missing and unexpected keys",
+			expected: `{"a": 1, "b": 2}`,
+			actual:   `{"b": 2, "c": 3}`,
+			want:     []string{"a: missing, expected 1", "c: unexpected 3"},
+		},
+		{
+			name:     "nested arrays",
+			expected: `{"Records": [{"id": "1"}, {"id": "2"}]}`,
+			actual:   `{"Records": [{"id": "1"}, {"id": "3"}, {"id": "4"}]}`,
+			want:     []string{`Records[1].id: expected "2", got "3"`, `Records[2]: unexpected {"id":"4"}`},
+		},
+		{
+			name:     "changed type",
+			expected: `{"body": {"a": 1}}`,
+			actual:   `{"body": "{\"a\":1}"}`,
+			want:     []string{`body: expected {"a":1}, got "{\"a\":1}"`},
+		},
+		{
+			name:     "changed root",
+			expected: `[1]`,
+			actual:   `{}`,
+			want:     []string{".: expected [1], got {}"},
+		},
+		{
+			name:     "ignored paths",
+			expected: `{"requestId": "a", "Records": [{"eventID": "1", "body": "x"}]}`,
+			actual:   `{"requestId": "b", "Records": [{"eventID": "2", "body": "y"}], "extra": true}`,
+			ignored:  []string{"requestId", "Records[*].eventID", "extra"},
+			want:     []string{`Records[0].body: expected "x", got "y"`},
+		},
+		{
+			name:     "ignored subtree",
+			expected: `{"headers": {"date": "a", "etag": "b"}}`,
+			actual:   `{"headers": {"date": "c"}}`,
+			ignored:  []string{"headers"},
+		},
+		{
+			name:     "large integers",
+			expected: `{"id": 9007199254740993}`,
+			actual:   `{"id": 9007199254740992}`,
+			want:     []string{"id: expected 9007199254740993, got 9007199254740992"},
+		},
+		{
+			name:     "equal numbers written differently",
+			expected: `{"a": 1, "b": 2.50}`,
+			actual:   `{"a": 1.0, "b": 25e-1}`,
+		},
+		{
+			name:     "trailing data",
+			expected: `{"a": 1} x`,
+			actual:   `{"a": 1}`,
+			want:     []string{`.: expected "{\"a\": 1} x", got "{\"a\": 1}"`},
+		},
+		{
+			name:     "equal text payloads",
+			expected: "hello\n",
+			actual:   "hello",
+		},
+		{
+			name:     "different text payloads",
+			expected: "hello",
+			actual:   `{"a": 1}`,
+			want:     []string{`.: expected "hello", got "{\"a\": 1}"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ignored, err := parseJSONPaths(tt.ignored)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, difference := range diffJSON([]byte(tt.expected), []byte(tt.actual), ignored) {
+				got = append(got, difference.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONDifferenceChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		want     string
+	}{
+		{name: "changed", expected: `{"a": 1}`, actual: `{"a": 2}`, want: "a: 1 -> 2"},
+		{name: "removed", expected: `{"a": 1}`, actual: `{}`, want: "a: removed 1"},
+		{name: "added", expected: `[]`, actual: `["x"]`, want: `[0]: added "x"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			differences := diffJSON([]byte(tt.expected), []byte(tt.actual), nil)
+			if len(differences) != 1 {
+				t.Fatalf("diffJSON() = %v, want a single difference", differences)
+			}
+			if got := differences[0].Change(); got != tt.want {
+				t.Errorf("Change() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is a key of an object or an index of an array in a path like
+// Records[0].body or requestContext.http.method. A * key or index matches any key or index.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	array    bool
+	wildcard bool
+}
+
+func (s jsonPathSegment) matches(other jsonPathSegment) bool {
+	if s.array != other.array {
+		return false
+	}
+	if s.wildcard {
+		return true
+	}
+	if s.array {
+		return s.index == other.index
+	}
+
+	return s.key == other.key
+}
+
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	var segments []jsonPathSegment
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			segments = append(segments, jsonPathSegment{key: key, wildcard: key == "*"})
+		}
+		for rest != "" {
+			indexValue, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid path %q: unterminated index", path)
+			}
+			if indexValue == "*" {
+				segments = append(segments, jsonPathSegment{array: true, wildcard: true})
+			} else {
+				index, err := strconv.Atoi(indexValue)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path %q: invalid index %q", path, indexValue)
+				}
+				segments = append(segments, jsonPathSegment{index: index, array: true})
+			}
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid path %q: unexpected %q after index", path, after)
+			}
+			rest = strings.TrimPrefix(after, "[")
+		}
+		if key == "" && !strings.Contains(part, "[") {
+			return nil, fmt.Errorf("invalid path %q: empty key", path)
+		}
+	}
+
+	return segments, nil
+}
+
+// formatJSONPath formats the segments the way parseJSONPath reads them.
+func formatJSONPath(segments []jsonPathSegment) string {
+	var path strings.Builder
+	for _, segment := range segments {
+		switch {
+		case segment.array && segment.wildcard:
+			path.WriteString("[*]")
+		case segment.array:
+			fmt.Fprintf(&path, "[%d]", segment.index)
+		default:
+			if path.Len() > 0 {
+				path.WriteByte('.')
+			}
+			path.WriteString(segment.key)
+		}
+	}
+
+	return path.String()
+}
+
+// matchJSONPath reports whether the path is the pattern or is nested under it.
+func matchJSONPath(pattern, path []jsonPathSegment) bool {
+	if len(path) < len(pattern) {
+		return false
+	}
+	for i, segment := range pattern {
+		if !segment.matches(path[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setJSONPath sets the value at the path of a decoded JSON document, creating missing objects along
+// the way. An index may address an existing element or append one to the end of the array.
+func setJSONPath(document interface{}, path string, value interface{}) (interface{}, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		if segment.wildcard {
+			return nil, fmt.Errorf("cannot set %s: wildcards only match paths", path)
+		}
+	}
+
+	return setJSONPathSegments(document, segments, value, path)
+}
+
+func setJSONPathSegments(node interface{}, segments []jsonPathSegment, value interface{}, path string) (interface{}, error) {
+	if len(segments) == 0 {
+		return value, nil
+	}
+
+	segment := segments[0]
+	if segment.array {
+		array, ok := node.([]interface{})
+		if !ok && node != nil {
+			return nil, fmt.Errorf("cannot set %s: not an array at index %d", path, segment.index)
+		}
+		if segment.index > len(array) {
+			return nil, fmt.Errorf("cannot set %s: index %d out of range", path, segment.index)
+		}
+		if segment.index == len(array) {
+			array = append(array, nil)
+		}
+		child, err := setJSONPathSegments(array[segment.index], segments[1:], value, path)
+		if err != nil {
+			return nil, err
+		}
+		array[segment.index] = child
+		return array, nil
+	}
+
+	object, ok := node.(map[string]interface{})
+	if !ok {
+		if node != nil {
+			return nil, fmt.Errorf("cannot set %s: not an object at %s", path, segment.key)
+		}
+		object = make(map[string]interface{})
+	}
+	child, err := setJSONPathSegments(object[segment.key], segments[1:], value, path)
+	if err != nil {
+		return nil, err
+	}
+	object[segment.key] = child
+
+	return object, nil
+}
+
+// parseAssignment parses an assignment of the form path=value, where the value is decoded as JSON
+// when it is valid JSON and used as a string otherwise, i.e. count=1 sets a number while name=hello
+// sets a string.
+func parseAssignment(assignment string) (string, interface{}, error) {
+	path, raw, ok := strings.Cut(assignment, "=")
+	if !ok || path == "" {
+		return "", nil, fmt.Errorf("invalid assignment %q, expected path=value", assignment)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		value = raw
+	}
+
+	return path, value, nil
+}
+
+// applyAssignments sets the values of the assignments in the JSON payload.
+func applyAssignments(payload []byte, assignments []string) ([]byte, error) {
+	if len(assignments) == 0 {
+		return payload, nil
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return nil, fmt.Errorf("cannot set fields of a payload which is not JSON: %w", err)
+	}
+
+	for _, assignment := range assignments {
+		path, value, err := parseAssignment(assignment)
+		if err != nil {
+			return nil, err
+		}
+		if document, err = setJSONPath(document, path, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(document)
+}
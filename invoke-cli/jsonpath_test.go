@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []jsonPathSegment
+		wantErr bool
+	}{
+		{
+			path: "requestContext.http.method",
+			want: []jsonPathSegment{{key: "requestContext"}, {key: "http"}, {key: "method"}},
+		},
+		{
+			path: "Records[0].body",
+			want: []jsonPathSegment{{key: "Records"}, {index: 0, array: true}, {key: "body"}},
+		},
+		{
+			path: "matrix[1][2]",
+			want: []jsonPathSegment{{key: "matrix"}, {index: 1, array: true}, {index: 2, array: true}},
+		},
+		{
+			path: "[3]",
+			want: []jsonPathSegment{{index: 3, array: true}},
+		},
+		{
+			path: "Records[*].*",
+			want: []jsonPathSegment{{key: "Records"}, {array: true, wildcard: true}, {key: "*", wildcard: true}},
+		},
+		{path: "", wantErr: true},
+		{path: "a..b", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "Records[0", wantErr: true},
+		{path: "Records[x]", wantErr: true},
+		{path: "Records[-1]", wantErr: true},
+		{path: "Records[0]body", wantErr: true},
+		{path: "Records[*]body", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONPath(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+			if formatted := formatJSONPath(got); formatted != tt.path {
+				t.Errorf("formatJSONPath(parseJSONPath(%q)) = %q", tt.path, formatted)
+			}
+		})
+	}
+}
+
+func TestParseJSONPathErrors(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "Records[0", want: `invalid path "Records[0": unterminated index`},
+		{path: "Records[x]", want: `invalid path "Records[x]": invalid index "x"`},
+		{path: "Records[0]body", want: `invalid path "Records[0]body": unexpected "body" after index`},
+		{path: "Records[*]body", want: `invalid path "Records[*]body": unexpected "body" after index`},
+		{path: "Records[*]body]", want: `invalid path "Records[*]body]": unexpected "body]" after index`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if _, err := parseJSONPath(tt.path); err == nil || err.Error() != tt.want {
+				t.Errorf("parseJSONPath(%q) error = %v, want %s", tt.path, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchJSONPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "requestId", path: "requestId", want: true},
+		{pattern: "headers", path: "headers.date", want: true},
+		{pattern: "headers.date", path: "headers", want: false},
+		{pattern: "Records[*].eventID", path: "Records[3].eventID", want: true},
+		{pattern: "Records[0].eventID", path: "Records[1].eventID", want: false},
+		{pattern: "*.id", path: "user.id", want: true},
+		{pattern: "*", path: "[0]", want: false},
+		{pattern: "[*]", path: "items", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			pattern, err := parseJSONPath(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := parseJSONPath(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchJSONPath(pattern, path); got != tt.want {
+				t.Errorf("matchJSONPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyAssignments(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		assignments []string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "no assignments",
+			payload:     "not json",
+			assignments: nil,
+			want:        "not json",
+		},
+		{
+			name:        "string and JSON values",
+			payload:     `{"a": 1}`,
+			assignments: []string{"name=hello", "count=2", "enabled=true", `tags=["x","y"]`, `quoted="1"`},
+			want:        `{"a": 1, "name": "hello", "count": 2, "enabled": true, "tags": ["x", "y"], "quoted": "1"}`,
+		},
+		{
+			name:        "value with equal signs",
+			payload:     `{}`,
+			assignments: []string{"query=a=b"},
+			want:        `{"query": "a=b"}`,
+		},
+		{
+			name:        "nested objects are created",
+			payload:     `{}`,
+			assignments: []string{"requestContext.http.method=GET"},
+			want:        `{"requestContext": {"http": {"method": "GET"}}}`,
+		},
+		{
+			name:        "existing and appended array elements",
+			payload:     `{"Records": [{"body": "a"}]}`,
+			assignments: []string{"Records[0].body=b", "Records[1].body=c"},
+			want:        `{"Records": [{"body": "b"}, {"body": "c"}]}`,
+		},
+		{
+			name:        "index out of range",
+			payload:     `{"Records": []}`,
+			assignments: []string{"Records[1].body=b"},
+			wantErr:     true,
+		},
+		{
+			name:        "index of an object",
+			payload:     `{"Records": {}}`,
+			assignments: []string{"Records[0]=b"},
+			wantErr:     true,
+		},
+		{
+			name:        "key of a string",
+			payload:     `{"body": "text"}`,
+			assignments: []string{"body.id=1"},
+			wantErr:     true,
+		},
+		{
+			name:        "wildcard",
+			payload:     `{"Records": [{}]}`,
+			assignments: []string{"Records[*].body=b"},
+			wantErr:     true,
+		},
+		{
+			name:        "missing value",
+			payload:     `{}`,
+			assignments: []string{"name"},
+			wantErr:     true,
+		},
+		{
+			name:        "payload which is not JSON",
+			payload:     "text",
+			assignments: []string{"name=hello"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyAssignments([]byte(tt.payload), tt.assignments)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyAssignments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.assignments == nil {
+				if string(got) != tt.want {
+					t.Errorf("applyAssignments() = %s, want %s", got, tt.want)
+				}
+				return
+			}
+
+			var gotDocument, wantDocument interface{}
+			if err := json.Unmarshal(got, &gotDocument); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &wantDocument); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotDocument, wantDocument) {
+				t.Errorf("applyAssignments() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
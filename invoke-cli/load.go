@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	Duration        = "duration"
+	RPS             = "rps"
+	Payloads        = "payloads"
+	ColdStartFactor = "cold-start-factor"
+)
+
+const (
+	// maxReportedOutliers limits the cold start outliers listed by the report.
+	maxReportedOutliers = 10
+	// minColdStartLatency keeps the jitter of fast functions from being reported as cold starts.
+	minColdStartLatency = 10 * time.Millisecond
+)
+
+// latencyBuckets are the upper bounds of the buckets of the latency histogram.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+}
+
+func loadCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "load",
+		Usage: "Invoke the lambda function at a target rate or concurrency for a duration and report the latencies",
+		Description: "Workers invoke the function back to back, or at the target rate shared between them when " +
+			"--" + RPS + " is set, raise --" + Concurrency + " when the achieved rate falls short. Payloads are " +
+			"built from the payload flags of the invoke command, or taken in turn from the lines of a JSONL file. " +
+			"Invocations much slower than the median are reported as cold start outliers",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{
+				Name:    Duration,
+				Aliases: []string{"d"},
+				Value:   10 * time.Second,
+				Usage:   "Duration of the load test",
+			},
+			&cli.IntFlag{
+				Name:    Concurrency,
+				Aliases: []string{"c"},
+				Value:   1,
+				Usage:   "Number of workers invoking the function concurrently",
+			},
+			&cli.Float64Flag{
+				Name:  RPS,
+				Usage: "Target number of invocations per second, 0 to invoke as fast as the workers can",
+			},
+			&cli.StringFlag{
+				Name:  Payloads,
+				Usage: "JSONL file of payloads to send in turn, instead of the payload flags",
+			},
+			&cli.Float64Flag{
+				Name:  ColdStartFactor,
+				Value: 3,
+				Usage: "Report invocations slower than this many times the median latency as cold start outliers",
+			},
+		},
+		Action: runLoad,
+	}
+}
+
+// loadSample is an invocation of the load test.
+type loadSample struct {
+	offset  time.Duration
+	latency time.Duration
+	err     error
+}
+
+func runLoad(ctx *cli.Context) error {
+	concurrency := ctx.Int(Concurrency)
+	if concurrency < 1 {
+		return cli.Exit(fmt.Sprintf("invalid concurrency %d", concurrency), exitCodeUsage)
+	}
+	interval, err := rateInterval(ctx, RPS)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	payloads, err := loadPayloads(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	invoker, err := offline.InvokerFromCLI(ctx, Function)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	// invocations in flight when the duration is over or the process is interrupted are cancelled
+	// and left out of the report, so that the load test ends on time
+	runCtx, cancel := context.WithTimeout(offline.TrapProcess(), ctx.Duration(Duration))
+	defer cancel()
+	ctx.Context = runCtx
+	invokeCtx, err := invokeContext(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	var tokens <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	stats := newInvocationStats()
+	var (
+		mu      sync.Mutex
+		samples []loadSample
+		next    atomic.Int64
+		workers sync.WaitGroup
+	)
+	start := time.Now()
+	stopProgress := reportProgress(ctx.App.ErrWriter, stats, start)
+
+	for i := 0; i < concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				if tokens != nil {
+					select {
+					case <-runCtx.Done():
+						return
+					case <-tokens:
+					}
+				} else if runCtx.Err() != nil {
+					return
+				}
+
+				payload := payloads[int(next.Add(1)-1)%len(payloads)]
+				invocationStart := time.Now()
+				_, err := invoker.Invoke(invokeCtx, payload)
+				latency := time.Since(invocationStart)
+				if err != nil && runCtx.Err() != nil {
+					return
+				}
+
+				stats.add(latency, err)
+				mu.Lock()
+				samples = append(samples, loadSample{offset: invocationStart.Sub(start), latency: latency, err: err})
+				mu.Unlock()
+			}
+		}()
+	}
+
+	workers.Wait()
+	elapsed := time.Since(start)
+	stopProgress()
+
+	w := ctx.App.Writer
+	stats.writeSummary(w, elapsed)
+	writeHistogram(w, stats.sorted())
+	writeColdStarts(w, samples, stats.sorted(), ctx.Float64(ColdStartFactor))
+
+	return nil
+}
+
+// loadPayloads returns the lines of the payloads file, or the payload of the flags.
+func loadPayloads(ctx *cli.Context) ([][]byte, error) {
+	path := ctx.String(Payloads)
+	if path == "" {
+		payload, err := payloadFromCLI(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{payload}, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payloads: %w", err)
+	}
+	defer file.Close()
+
+	var payloads [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxPayloadLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		payload, err := newPayload(ctx, append([]byte(nil), scanner.Bytes()...))
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload on line %d: %w", line, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read payloads: %w", err)
+	}
+	if len(payloads) == 0 {
+		return nil, fmt.Errorf("no payloads in %s", path)
+	}
+
+	return payloads, nil
+}
+
+// reportProgress writes the progress of the load test every second until it is stopped.
+func reportProgress(w io.Writer, stats *invocationStats, start time.Time) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				elapsed := time.Since(start)
+				total, failed := stats.counts()
+				fmt.Fprintf(w, "%s: %d invocations, %.2f/s, %d failed\n",
+					elapsed.Round(time.Second), total, float64(total)/elapsed.Seconds(), failed)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// writeHistogram writes the distribution of the sorted latencies over the latency buckets.
+func writeHistogram(w io.Writer, latencies []time.Duration) {
+	if len(latencies) == 0 {
+		return
+	}
+
+	const barWidth = 40
+	counts := make([]int, len(latencyBuckets)+1)
+	for _, latency := range latencies {
+		bucket := sort.Search(len(latencyBuckets), func(i int) bool {
+			return latency < latencyBuckets[i]
+		})
+		counts[bucket]++
+	}
+	maxCount := 0
+	for _, count := range counts {
+		if count > maxCount {
+			maxCount = count
+		}
+	}
+
+	fmt.Fprintln(w, "latency histogram:")
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		label := "   >= " + latencyBuckets[len(latencyBuckets)-1].String()
+		if i < len(latencyBuckets) {
+			label = fmt.Sprintf("%8s", "< "+latencyBuckets[i].String())
+		}
+		fmt.Fprintf(w, "  %-10s %-*s %d (%.1f%%)\n",
+			label, barWidth, strings.Repeat("#", (count*barWidth+maxCount-1)/maxCount),
+			count, float64(count)*100/float64(len(latencies)))
+	}
+}
+
+// writeColdStarts writes the invocations much slower than the median latency, which are most
+// likely cold starts of new sandboxes of the function.
+func writeColdStarts(w io.Writer, samples []loadSample, latencies []time.Duration, factor float64) {
+	if len(latencies) == 0 || factor <= 0 {
+		return
+	}
+
+	threshold := time.Duration(float64(percentile(latencies, 50)) * factor)
+	if threshold < minColdStartLatency {
+		threshold = minColdStartLatency
+	}
+	var outliers []loadSample
+	for _, sample := range samples {
+		if sample.latency > threshold && sample.err == nil {
+			outliers = append(outliers, sample)
+		}
+	}
+	if len(outliers) == 0 {
+		fmt.Fprintf(w, "cold start outliers: none slower than %s\n", formatLatency(threshold))
+		return
+	}
+
+	sort.Slice(outliers, func(i, j int) bool {
+		return outliers[i].offset < outliers[j].offset
+	})
+	fmt.Fprintf(w, "cold start outliers: %d slower than %s\n", len(outliers), formatLatency(threshold))
+	for i, outlier := range outliers {
+		if i == maxReportedOutliers {
+			fmt.Fprintf(w, "  ... %d more\n", len(outliers)-maxReportedOutliers)
+			break
+		}
+		fmt.Fprintf(w, "  at %s: %s\n", outlier.offset.Round(time.Millisecond), formatLatency(outlier.latency))
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWriteHistogram(t *testing.T) {
+	var histogram bytes.Buffer
+	writeHistogram(&histogram, []time.Duration{
+		500 * time.Microsecond,
+		1500 * time.Microsecond,
+		1500 * time.Microsecond,
+		10 * time.Second,
+	})
+
+	want := "latency histogram:\n" +
+		"     < 1ms   " + strings.Repeat("#", 20) + strings.Repeat(" ", 20) + " 1 (25.0%)\n" +
+		"     < 2ms   " + strings.Repeat("#", 40) + " 2 (50.0%)\n" +
+		"     >= 5s   " + strings.Repeat("#", 20) + strings.Repeat(" ", 20) + " 1 (25.0%)\n"
+	if histogram.String() != want {
+		t.Errorf("histogram =\n%s\nwant\n%s", histogram.String(), want)
+	}
+
+	histogram.Reset()
+	writeHistogram(&histogram, nil)
+	if histogram.Len() != 0 {
+		t.Errorf("histogram of no latencies = %q, want none", histogram.String())
+	}
+}
+
+func TestWriteColdStarts(t *testing.T) {
+	samples := []loadSample{
+		{offset: 0, latency: 100 * time.Millisecond},
+		{offset: 150 * time.Millisecond, latency: 80 * time.Millisecond},
+		{offset: 100 * time.Millisecond, latency: 5 * time.Millisecond},
+		{offset: 110 * time.Millisecond, latency: 5 * time.Millisecond},
+		{offset: 120 * time.Millisecond, latency: 6 * time.Millisecond},
+		// failed invocations are not cold starts
+		{offset: 130 * time.Millisecond, latency: 200 * time.Millisecond, err: errors.New("connection reset")},
+	}
+	stats := newInvocationStats()
+	for _, sample := range samples {
+		stats.add(sample.latency, sample.err)
+	}
+
+	tests := []struct {
+		name   string
+		factor float64
+		want   string
+	}{
+		{
+			name:   "outliers",
+			factor: 3,
+			want:   "cold start outliers: 2 slower than 18.00ms\n  at 0s: 100.00ms\n  at 150ms: 80.00ms\n",
+		},
+		{name: "none", factor: 40, want: "cold start outliers: none slower than 240.00ms\n"},
+		{name: "disabled", factor: 0, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var report bytes.Buffer
+			writeColdStarts(&report, samples, stats.sorted(), tt.factor)
+			if report.String() != tt.want {
+				t.Errorf("report = %q, want %q", report.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	var invocations atomic.Int64
+	lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+		// the first invocation starts the function
+		if invocations.Add(1) == 1 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte(`"ok"`))
+	})
+
+	payloads := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := os.WriteFile(payloads, []byte("{\"id\":1}\n\n{\"id\":2}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL,
+		"load", "--duration", "200ms", "--concurrency", "2", "--rps", "100", "--payloads", payloads)
+	if code != exitCodeSuccess {
+		t.Fatalf("exit code = %d, want %d", code, exitCodeSuccess)
+	}
+	for _, want := range []string{"invocations: ", "failed: 0", "latency histogram:", "cold start outliers: 1 slower than"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("report = %q, want it to contain %q", stdout, want)
+		}
+	}
+}
+
+func TestLoadInFlightInvocations(t *testing.T) {
+	lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+		// the server notices the cancelled invocation once the payload was read
+		_, _ = io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	})
+
+	start := time.Now()
+	stdout, _, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL, "load", "--duration", "100ms")
+	if code != exitCodeSuccess {
+		t.Fatalf("exit code = %d, want %d", code, exitCodeSuccess)
+	}
+	// the hung invocation is cancelled when the duration is over rather than reported
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("load test took %s, want it to end after its duration", elapsed)
+	}
+	if !strings.HasPrefix(stdout, "invocations: 0, succeeded: 0, failed: 0") {
+		t.Errorf("report = %q, want the cancelled invocation left out", stdout)
+	}
+}
+
+func TestLoadUsage(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "invalid concurrency", args: []string{"load", "--concurrency", "0"}},
+		{name: "rps beyond the ticker resolution", args: []string{"load", "--rps", "2e9"}},
+		{name: "missing payloads", args: []string{"load", "--payloads", filepath.Join(t.TempDir(), "missing.jsonl")}},
+		{name: "no payloads", args: []string{"load", "--payloads", empty}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, code := runInvoke(t, "", tt.args...); code != exitCodeUsage {
+				t.Errorf("exit code = %d, want %d", code, exitCodeUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// Exit codes of an invocation, so that scripts can tell why it failed.
+const (
+	exitCodeSuccess = 0
+	// the flags were invalid or the invoker could not be configured
+	exitCodeUsage = 1
+	// the lambda endpoint could not be reached or did not return a response
+	exitCodeTransport = 2
+	// the lambda endpoint rejected the invocation, i.e. an unknown function or a throttle
+	exitCodeServiceError = 3
+	// the function returned an error or crashed
+	exitCodeFunctionError = 4
+	// the function exceeded its timeout
+	exitCodeTimeout = 5
+	// a response of the verify command did not match its golden file
+	exitCodeMismatch = 6
+)
+
+// OutputFormat is the format the result of an invocation is written in.
+type OutputFormat string
+
+const (
+	// OutputRaw writes the response payload alone, and the log tail to stderr.
+	OutputRaw OutputFormat = "raw"
+	// OutputJSON writes the result as a JSON document.
+	OutputJSON OutputFormat = "json"
+	// OutputPretty writes the result for humans, with an indented payload.
+	OutputPretty OutputFormat = "pretty"
+)
+
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(value); format {
+	case OutputRaw, OutputJSON, OutputPretty:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid output %q, expected one of raw, json or pretty", value)
+	}
+}
+
+// invocationOutput is the result of an invocation as written by OutputJSON.
+type invocationOutput struct {
+	StatusCode      int             `json:"statusCode,omitempty"`
+	RequestID       string          `json:"requestId,omitempty"`
+	FunctionError   string          `json:"functionError,omitempty"`
+	ExecutedVersion string          `json:"executedVersion,omitempty"`
+	DurationMs      float64         `json:"durationMs"`
+	Payload         json.RawMessage `json:"payload,omitempty"`
+	LogTail         string          `json:"logTail,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	ExitCode        int             `json:"exitCode"`
+}
+
+func newInvocationOutput(result *offline.InvokeResult, err error, duration time.Duration) invocationOutput {
+	output := invocationOutput{
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		ExitCode:   exitCode(err),
+	}
+	if err != nil {
+		output.Error = err.Error()
+	}
+	if result != nil {
+		output.StatusCode = result.StatusCode
+		output.RequestID = result.RequestID
+		output.FunctionError = string(result.FunctionError)
+		output.ExecutedVersion = result.ExecutedVersion
+		output.LogTail = result.LogResult
+		output.Payload = offline.RawJSON(result.Payload)
+	}
+
+	return output
+}
+
+// exitCode classifies an invocation error.
+func exitCode(err error) int {
+	if err == nil {
+		return exitCodeSuccess
+	}
+
+	var fnErr *offline.FunctionError
+	if errors.As(err, &fnErr) {
+		if fnErr.Timeout() {
+			return exitCodeTimeout
+		}
+		return exitCodeFunctionError
+	}
+
+	var svcErr *offline.ServiceError
+	if errors.As(err, &svcErr) {
+		return exitCodeServiceError
+	}
+
+	return exitCodeTransport
+}
+
+// Classes of invocation errors reported by the batch and load reports.
+const (
+	errorClassTransport     = "transport"
+	errorClassThrottle      = "throttle"
+	errorClassServiceError  = "service error"
+	errorClassFunctionError = "function error"
+	errorClassTimeout       = "timeout"
+)
+
+// errorClass classifies an invocation error for reports, empty when the invocation succeeded.
+func errorClass(err error) string {
+	var svcErr *offline.ServiceError
+	switch exitCode(err) {
+	case exitCodeSuccess:
+		return ""
+	case exitCodeTimeout:
+		return errorClassTimeout
+	case exitCodeFunctionError:
+		return errorClassFunctionError
+	case exitCodeServiceError:
+		if errors.As(err, &svcErr) && svcErr.Throttled() {
+			return errorClassThrottle
+		}
+		return errorClassServiceError
+	default:
+		return errorClassTransport
+	}
+}
+
+// writeResult writes the result of an invocation in the format, returning an error with the exit
+// code of the invocation when it failed.
+func writeResult(
+	ctx *cli.Context,
+	format OutputFormat,
+	result *offline.InvokeResult,
+	err error,
+	duration time.Duration,
+) error {
+	output := newInvocationOutput(result, err, duration)
+	if writeErr := writeOutput(ctx, format, output, result); writeErr != nil {
+		return cli.Exit(writeErr.Error(), exitCodeUsage)
+	}
+
+	if err != nil {
+		return cli.Exit(err.Error(), output.ExitCode)
+	}
+
+	return nil
+}
+
+// writeOutput writes the output of an invocation in the format.
+func writeOutput(ctx *cli.Context, format OutputFormat, output invocationOutput, result *offline.InvokeResult) error {
+	switch format {
+	case OutputJSON:
+		encoded, err := json.Marshal(output)
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+		fmt.Fprintln(ctx.App.Writer, string(encoded))
+	case OutputPretty:
+		writePretty(ctx.App.Writer, output, result)
+	default:
+		if result != nil {
+			if result.LogResult != "" {
+				fmt.Fprint(ctx.App.ErrWriter, result.LogResult)
+			}
+			_, _ = ctx.App.Writer.Write(result.Payload)
+			if len(result.Payload) > 0 && isTerminal(ctx.App.Writer) {
+				fmt.Fprintln(ctx.App.Writer)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writePretty(w io.Writer, output invocationOutput, result *offline.InvokeResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if output.StatusCode != 0 {
+		fmt.Fprintf(tw, "Status:\t%d\n", output.StatusCode)
+	}
+	if output.RequestID != "" {
+		fmt.Fprintf(tw, "Request ID:\t%s\n", output.RequestID)
+	}
+	if output.ExecutedVersion != "" {
+		fmt.Fprintf(tw, "Version:\t%s\n", output.ExecutedVersion)
+	}
+	if output.FunctionError != "" {
+		fmt.Fprintf(tw, "Function error:\t%s\n", output.FunctionError)
+	}
+	fmt.Fprintf(tw, "Duration:\t%.2f ms\n", output.DurationMs)
+	_ = tw.Flush()
+
+	if result != nil && len(result.Payload) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, prettyPayload(result.Payload))
+	}
+	if output.LogTail != "" {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Logs:")
+		fmt.Fprint(w, output.LogTail)
+		if !strings.HasSuffix(output.LogTail, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// prettyPayload indents JSON payloads, other payloads are returned as is.
+func prettyPayload(payload []byte) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, payload, "", "  "); err != nil {
+		return string(payload)
+	}
+
+	return buf.String()
+}
+
+// isTerminal reports whether the writer is an interactive terminal, where the payload is followed
+// by a newline so that the prompt does not continue it.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
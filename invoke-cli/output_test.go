@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, value := range []string{"raw", "json", "pretty"} {
+		if format, err := ParseOutputFormat(value); err != nil || string(format) != value {
+			t.Errorf("ParseOutputFormat(%q) = %q, %v", value, format, err)
+		}
+	}
+	if _, err := ParseOutputFormat("xml"); err == nil {
+		t.Error("ParseOutputFormat(xml) error = nil, want an invalid output")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCode  int
+		wantClass string
+	}{
+		{name: "success", wantCode: exitCodeSuccess},
+		{name: "transport error", err: errors.New("connection refused"), wantCode: exitCodeTransport, wantClass: errorClassTransport},
+		{
+			name:      "service error",
+			err:       &offline.ServiceError{StatusCode: http.StatusNotFound, Code: "ResourceNotFoundException"},
+			wantCode:  exitCodeServiceError,
+			wantClass: errorClassServiceError,
+		},
+		{
+			name:      "throttle",
+			err:       &offline.ServiceError{StatusCode: http.StatusTooManyRequests, Code: offline.ErrorCodeTooManyRequests},
+			wantCode:  exitCodeServiceError,
+			wantClass: errorClassThrottle,
+		},
+		{
+			name:      "function error",
+			err:       &offline.FunctionError{Kind: offline.FunctionErrorUnhandled},
+			wantCode:  exitCodeFunctionError,
+			wantClass: errorClassFunctionError,
+		},
+		{
+			name:      "timeout",
+			err:       &offline.FunctionError{ErrorPayload: offline.ErrorPayload{ErrorType: offline.ErrorTypeTimedOut}},
+			wantCode:  exitCodeTimeout,
+			wantClass: errorClassTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := exitCode(tt.err); code != tt.wantCode {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, code, tt.wantCode)
+			}
+			if class := errorClass(tt.err); class != tt.wantClass {
+				t.Errorf("errorClass(%v) = %q, want %q", tt.err, class, tt.wantClass)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// stdinPayload reads the payload from stdin when used as the payload or payload file.
+const stdinPayload = "-"
+
+func payloadFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    Payload,
+			Aliases: []string{"p"},
+			Usage:   "Payload to send to the lambda function, - to read it from stdin",
+		},
+		&cli.StringFlag{
+			Name:  PayloadFile,
+			Usage: "File to read the payload from, - to read it from stdin",
+		},
+		&cli.StringFlag{
+			Name: EventTemplate,
+			Usage: "Send a sample event of an event source, with the payload as its body. One of " +
+				strings.Join(offline.EventTemplateNames(), ", "),
+		},
+		&cli.GenericFlag{
+			Name:  Set,
+			Value: &offline.DefinitionsValue{},
+			Usage: "Set a field of the payload as path=value, the value is parsed as JSON when valid. " +
+				"i.e. Records[0].body=hello or requestContext.http.method=GET",
+		},
+	}
+}
+
+// payloadFromCLI reads the payload from the flags, wraps it in the event template if any and applies
+// the field assignments.
+func payloadFromCLI(ctx *cli.Context) ([]byte, error) {
+	body, err := readPayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPayload(ctx, body)
+}
+
+// newPayload wraps the body in the event template of the flags if any and applies the field
+// assignments.
+func newPayload(ctx *cli.Context, body []byte) ([]byte, error) {
+	var err error
+	payload := body
+	if template := ctx.String(EventTemplate); template != "" {
+		if payload, err = offline.NewTemplateEvent(template, ctx.String(offline.AwsRegionName), body); err != nil {
+			return nil, err
+		}
+	} else if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+
+	return applyAssignments(payload, offline.DefinitionsFromCLI(ctx, Set))
+}
+
+func readPayload(ctx *cli.Context) ([]byte, error) {
+	if ctx.IsSet(Payload) && ctx.IsSet(PayloadFile) {
+		return nil, fmt.Errorf("only one of --%s and --%s may be set", Payload, PayloadFile)
+	}
+
+	if path := ctx.String(PayloadFile); path != "" {
+		if path == stdinPayload {
+			return io.ReadAll(os.Stdin)
+		}
+		payload, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload file: %w", err)
+		}
+		return payload, nil
+	}
+
+	payload := ctx.String(Payload)
+	if payload == stdinPayload {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return []byte(payload), nil
+}
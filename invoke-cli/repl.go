@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const HistoryFile = "history-file"
+
+const (
+	defaultHistoryFile = ".invoke-cli_history"
+	maxHistory         = 100
+)
+
+const replHelp = `Commands:
+  {...}                   invoke the function with the JSON payload, which may span several lines
+  send <payload>          invoke the function with the payload
+  file <path>             invoke the function with the payload of the file
+  template <name> [body]  invoke the function with a sample event, i.e. template sqs {"id":1}
+  set <path=value>...     invoke the function with the last payload after setting the fields, values
+                          with spaces are quoted like JSON, i.e. set name="Jane Doe"
+  again                   invoke the function with the last payload
+  show                    print the last payload
+  history                 list the previous payloads
+  !<n>                    invoke the function with the payload n of the history
+  functions               list the registered functions
+  use <name>              invoke another function
+  help                    print this help
+  quit                    exit the repl
+`
+
+func replCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "repl",
+		Usage: "Interactively invoke lambda functions, editing and resending payloads",
+		Description: "Payloads are invoked with the flags of the invoke command and their responses are " +
+			"printed with the status, function error, duration and log tail. Type help for the commands",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  HistoryFile,
+				Usage: "File to keep the payload history in across sessions, defaults to ~/" + defaultHistoryFile,
+			},
+		},
+		Action: runREPL,
+	}
+}
+
+// repl is an interactive session of the repl command.
+type repl struct {
+	ctx         *cli.Context
+	in          *bufio.Scanner
+	out         io.Writer
+	history     [][]byte
+	historyPath string
+}
+
+func runREPL(ctx *cli.Context) error {
+	invokeCtx, err := invokeContext(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+	// LambdaInvokeFromCLI invokes with the context of the cli
+	ctx.Context = invokeCtx
+
+	r := &repl{
+		ctx:         ctx,
+		in:          bufio.NewScanner(ctx.App.Reader),
+		out:         ctx.App.Writer,
+		historyPath: ctx.String(HistoryFile),
+	}
+	r.in.Buffer(make([]byte, 64*1024), maxPayloadLineSize)
+	if r.historyPath == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			r.historyPath = filepath.Join(home, defaultHistoryFile)
+		}
+	}
+	r.loadHistory()
+
+	fmt.Fprintf(r.out, "Invoking %s, type help for the commands\n", r.functionName())
+	for {
+		fmt.Fprintf(r.out, "%s> ", r.functionName())
+		line, ok := r.readLine()
+		if !ok {
+			fmt.Fprintln(r.out)
+			return nil
+		}
+		if quit := r.eval(line); quit {
+			return nil
+		}
+	}
+}
+
+func (r *repl) readLine() (string, bool) {
+	if !r.in.Scan() {
+		return "", false
+	}
+
+	return strings.TrimSpace(r.in.Text()), true
+}
+
+// readPayload completes a JSON payload which spans several lines, until it is valid or an empty
+// line is entered.
+func (r *repl) readPayload(first string) string {
+	payload := first
+	for !json.Valid([]byte(payload)) {
+		fmt.Fprint(r.out, "... ")
+		line, ok := r.readLine()
+		if !ok || line == "" {
+			break
+		}
+		payload += "\n" + line
+	}
+
+	return payload
+}
+
+// eval runs a command, reporting whether the session is over.
+func (r *repl) eval(line string) bool {
+	command, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch {
+	case line == "":
+	case strings.HasPrefix(line, "{") || strings.HasPrefix(line, "["):
+		r.invoke([]byte(r.readPayload(line)))
+	case strings.HasPrefix(line, "!"):
+		index, err := strconv.Atoi(strings.TrimPrefix(line, "!"))
+		if err != nil || index < 1 || index > len(r.history) {
+			fmt.Fprintf(r.out, "no payload %s in the history\n", strings.TrimPrefix(line, "!"))
+			break
+		}
+		r.invoke(r.history[index-1])
+	case command == "send":
+		r.invoke([]byte(r.readPayload(args)))
+	case command == "file":
+		payload, err := os.ReadFile(args)
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		r.invoke(payload)
+	case command == "template":
+		name, body, _ := strings.Cut(args, " ")
+		payload, err := offline.NewTemplateEvent(name, r.ctx.String(offline.AwsRegionName), []byte(strings.TrimSpace(body)))
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		r.invoke(payload)
+	case command == "set":
+		last, ok := r.last()
+		if !ok {
+			break
+		}
+		payload, err := applyAssignments(last, splitAssignments(args))
+		if err != nil {
+			fmt.Fprintln(r.out, err)
+			break
+		}
+		r.invoke(payload)
+	case command == "again":
+		if last, ok := r.last(); ok {
+			r.invoke(last)
+		}
+	case command == "show":
+		if last, ok := r.last(); ok {
+			fmt.Fprintln(r.out, prettyPayload(last))
+		}
+	case command == "history":
+		for i, payload := range r.history {
+			fmt.Fprintf(r.out, "%3d  %s\n", i+1, payload)
+		}
+	case command == "functions":
+		r.listFunctions()
+	case command == "use":
+		if args == "" {
+			fmt.Fprintln(r.out, "use expects the name of a function")
+			break
+		}
+		// the invoke endpoint wins over the function name, which would invoke the same function again
+		if endpoint := offline.InvokeEndpointNameForFunction(Function); r.ctx.IsSet(endpoint) {
+			fmt.Fprintf(r.out, "use cannot switch functions while --%s is set\n", endpoint)
+			break
+		}
+		if err := r.ctx.Set(offline.FunctionNameForFunction(Function), args); err != nil {
+			fmt.Fprintln(r.out, err)
+		}
+	case command == "help":
+		fmt.Fprint(r.out, replHelp)
+	case command == "quit" || command == "exit":
+		return true
+	default:
+		fmt.Fprintf(r.out, "unknown command %q, type help for the commands\n", command)
+	}
+
+	return false
+}
+
+// splitAssignments splits the assignments of a set command on the spaces outside of their JSON
+// values, so that quoted strings, objects and arrays with spaces stay in one assignment.
+func splitAssignments(line string) []string {
+	var (
+		assignments []string
+		assignment  strings.Builder
+		depth       int
+		quoted      bool
+		escaped     bool
+	)
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{' || c == '[':
+			depth++
+		case (c == '}' || c == ']') && depth > 0:
+			depth--
+		case unicode.IsSpace(c) && depth == 0:
+			if assignment.Len() > 0 {
+				assignments = append(assignments, assignment.String())
+				assignment.Reset()
+			}
+			continue
+		}
+		assignment.WriteRune(c)
+	}
+	if assignment.Len() > 0 {
+		assignments = append(assignments, assignment.String())
+	}
+
+	return assignments
+}
+
+func (r *repl) invoke(payload []byte) {
+	if !json.Valid(payload) {
+		fmt.Fprintln(r.out, "the payload is not valid JSON")
+		return
+	}
+	r.remember(payload)
+
+	start := time.Now()
+	result, err := offline.LambdaInvokeFromCLI(r.ctx, Function, payload)
+	output := newInvocationOutput(result, err, time.Since(start))
+	writePretty(r.out, output, result)
+	if err != nil {
+		fmt.Fprintf(r.out, "\n%v\n", err)
+	}
+}
+
+// last returns the last payload, telling the user when there is none.
+func (r *repl) last() ([]byte, bool) {
+	last, ok := r.lastPayload()
+	if !ok {
+		fmt.Fprintln(r.out, "no payload was sent yet")
+	}
+
+	return last, ok
+}
+
+func (r *repl) lastPayload() ([]byte, bool) {
+	if len(r.history) == 0 {
+		return nil, false
+	}
+
+	return r.history[len(r.history)-1], true
+}
+
+func (r *repl) functionName() string {
+	return r.ctx.String(offline.FunctionNameForFunction(Function))
+}
+
+func (r *repl) listFunctions() {
+	registry, err := offline.FunctionRegistryFromCLI(r.ctx)
+	if err != nil {
+		fmt.Fprintln(r.out, err)
+		return
+	}
+
+	definitions := registry.List()
+	if len(definitions) == 0 {
+		fmt.Fprintln(r.out, "no registered functions, any function of the lambda endpoint can be used")
+		return
+	}
+	for _, definition := range definitions {
+		// the invocations time out after the timeout flag unless the function declares its own
+		timeout := definition.Timeout
+		if timeout == 0 || r.ctx.IsSet(offline.LambdaTimeoutName) {
+			timeout = r.ctx.Duration(offline.LambdaTimeoutName)
+		}
+		fmt.Fprintf(r.out, "%s  %s  %s\n", definition.Name, definition.Runtime, timeout)
+	}
+}
+
+// remember adds the payload to the history, compacted to a single line.
+func (r *repl) remember(payload []byte) {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, payload); err == nil {
+		payload = compacted.Bytes()
+	}
+	if last, ok := r.lastPayload(); ok && bytes.Equal(last, payload) {
+		return
+	}
+
+	r.history = append(r.history, payload)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+	r.saveHistory()
+}
+
+func (r *repl) loadHistory() {
+	if r.historyPath == "" {
+		return
+	}
+	file, err := os.Open(r.historyPath)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxPayloadLineSize)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); json.Valid(line) {
+			r.history = append(r.history, append([]byte(nil), line...))
+		}
+	}
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+}
+
+func (r *repl) saveHistory() {
+	if r.historyPath == "" {
+		return
+	}
+
+	var history bytes.Buffer
+	for _, payload := range r.history {
+		history.Write(payload)
+		history.WriteByte('\n')
+	}
+	if err := os.WriteFile(r.historyPath, history.Bytes(), 0o600); err != nil {
+		fmt.Fprintf(r.out, "failed to save history: %v\n", err)
+	}
+}
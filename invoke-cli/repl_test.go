@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordedInvocation is an invocation received by a recording lambda.
+type recordedInvocation struct {
+	path    string
+	payload string
+}
+
+// newRecordingLambda serves a lambda echoing the payloads, recording the invocations it received.
+func newRecordingLambda(t *testing.T) (string, func() []recordedInvocation) {
+	t.Helper()
+
+	var (
+		mu          sync.Mutex
+		invocations []recordedInvocation
+	)
+	lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		invocations = append(invocations, recordedInvocation{path: r.URL.Path, payload: string(body)})
+		mu.Unlock()
+		_, _ = w.Write(body)
+	})
+
+	return lambda.URL, func() []recordedInvocation {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedInvocation(nil), invocations...)
+	}
+}
+
+func TestREPL(t *testing.T) {
+	endpoint, invocations := newRecordingLambda(t)
+	historyPath := filepath.Join(t.TempDir(), "history")
+
+	session := strings.Join([]string{
+		`{"id":1}`,
+		`{`,
+		`  "id": 2`,
+		`}`,
+		`set id=3 name="Jane Doe"`,
+		`again`,
+		`history`,
+		`!1`,
+		`use world`,
+		`send {"id":4}`,
+		`unknown`,
+		`quit`,
+		`send {"id":5}`,
+	}, "\n")
+	stdout, _, code := runInvoke(t, session, "--lambda-endpoint", endpoint, "--function", "hello", "repl", "--history-file", historyPath)
+	if code != exitCodeSuccess {
+		t.Fatalf("exit code = %d, want %d", code, exitCodeSuccess)
+	}
+
+	var got []recordedInvocation
+	for _, invocation := range invocations() {
+		invocation.path = filepath.Base(filepath.Dir(invocation.path))
+		got = append(got, invocation)
+	}
+	want := []recordedInvocation{
+		{path: "hello", payload: `{"id":1}`},
+		{path: "hello", payload: "{\n\"id\": 2\n}"},
+		{path: "hello", payload: `{"id":3,"name":"Jane Doe"}`},
+		{path: "hello", payload: `{"id":3,"name":"Jane Doe"}`},
+		{path: "hello", payload: `{"id":1}`},
+		{path: "world", payload: `{"id":4}`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("invocations = %q, want %q", got, want)
+	}
+
+	for _, output := range []string{
+		"Invoking hello, type help for the commands",
+		"Status:",
+		`"name": "Jane Doe"`,
+		"  1  {\"id\":1}\n  2  {\"id\":2}\n  3  {\"id\":3,\"name\":\"Jane Doe\"}\n",
+		"world> ",
+		`unknown command "unknown"`,
+	} {
+		if !strings.Contains(stdout, output) {
+			t.Errorf("output = %q, want it to contain %q", stdout, output)
+		}
+	}
+
+	// the history is kept for the next session, the payload sent again from it is not repeated
+	history, err := os.ReadFile(historyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantHistory := "{\"id\":1}\n{\"id\":2}\n{\"id\":3,\"name\":\"Jane Doe\"}\n{\"id\":1}\n{\"id\":4}\n"
+	if string(history) != wantHistory {
+		t.Errorf("history = %q, want %q", history, wantHistory)
+	}
+
+	_, _, _ = runInvoke(t, "again\n", "--lambda-endpoint", endpoint, "repl", "--history-file", historyPath)
+	if all := invocations(); all[len(all)-1].payload != `{"id":4}` {
+		t.Errorf("again invoked %q, want the last payload of the previous session", all[len(all)-1].payload)
+	}
+}
+
+func TestREPLWithoutPayload(t *testing.T) {
+	endpoint, invocations := newRecordingLambda(t)
+
+	stdout, _, _ := runInvoke(t, "again\nset id=1\nshow\n", "--lambda-endpoint", endpoint, "repl", "--history-file", filepath.Join(t.TempDir(), "history"))
+	if count := strings.Count(stdout, "no payload was sent yet"); count != 3 {
+		t.Errorf("output = %q, want the missing payload reported by each command", stdout)
+	}
+	if len(invocations()) != 0 {
+		t.Errorf("invocations = %q, want none", invocations())
+	}
+}
+
+func TestREPLFunctions(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "unregistered", want: "no registered functions"},
+		{name: "declared timeout", args: []string{"--lambda-functions", "name=hello;timeout=10s"}, want: "hello  provided.al2  10s\n"},
+		// the invocations of a function without a timeout time out after the timeout flag
+		{name: "default timeout", args: []string{"--lambda-functions", "name=hello"}, want: "hello  provided.al2  5m0s\n"},
+		{
+			name: "timeout flag",
+			args: []string{"--lambda-functions", "name=hello;timeout=10s", "--lambda-timeout", "1m"},
+			want: "hello  provided.al2  1m0s\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(tt.args, "repl", "--history-file", filepath.Join(t.TempDir(), "history"))
+			stdout, _, _ := runInvoke(t, "functions\n", args...)
+			if !strings.Contains(stdout, tt.want) {
+				t.Errorf("output = %q, want it to contain %q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAssignments(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{line: "a=1 b=2", want: []string{"a=1", "b=2"}},
+		{line: ` name="Jane Doe"  tags=["a b", "c"] `, want: []string{`name="Jane Doe"`, `tags=["a b", "c"]`}},
+		{line: `user={"name": "x \" y"} id=1`, want: []string{`user={"name": "x \" y"}`, "id=1"}},
+		{line: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := splitAssignments(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitAssignments(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -1,51 +1,188 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
 
 	offline "github.com/geode-io/aws-emulators"
 )
 
 const (
-	Function = "function"
-	Payload  = "payload"
+	Function       = "function"
+	Payload        = "payload"
+	PayloadFile    = "payload-file"
+	EventTemplate  = "event-template"
+	Set            = "set"
+	InvocationType = "invocation-type"
+	ClientContext  = "client-context"
+	TraceID        = "trace-id"
+	Output         = "output"
 )
 
+func init() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("cannot initialize zap logger: %v", err)
+	}
+	zap.ReplaceGlobals(logger)
+}
+
 func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newApp builds the invoke command and its subcommands.
+func newApp() *cli.App {
 	flags := []cli.Flag{
 		&cli.StringFlag{
-			Name:    Payload,
-			Aliases: []string{"p"},
-			Usage:   "Payload to send to the lambda function",
+			Name:  InvocationType,
+			Value: string(offline.InvocationTypeRequestResponse),
+			Usage: "Type of invocation, one of RequestResponse, Event or DryRun",
+		},
+		&cli.StringFlag{
+			Name:  ClientContext,
+			Usage: "Client context to pass to the lambda function as JSON. i.e. {\"custom\":{\"key\":\"value\"}}",
+		},
+		&cli.StringFlag{
+			Name:  TraceID,
+			Usage: "X-Ray trace header to forward to the lambda function, a new trace is started when empty",
+		},
+		&cli.StringFlag{
+			Name:    Output,
+			Aliases: []string{"o"},
+			Value:   string(OutputRaw),
+			Usage: "Format of the result, one of raw for the response payload alone, json or pretty for the " +
+				"status code, function error, duration and log tail alongside it",
 		},
 	}
 
+	flags = append(flags, payloadFlags()...)
+	flags = append(flags, watchFlags()...)
 	flags = append(flags, offline.LambdaFlags()...)
 	flags = append(flags, offline.LambdaInvokeFlags("")...)
+	flags = append(flags, offline.LambdaConcurrencyFlags("")...)
+	flags = append(flags, offline.LambdaAsyncFlags()...)
+	flags = append(flags, offline.LambdaDestinationFlags()...)
+	flags = append(flags, offline.KinesisFlags()...)
 
-	app := &cli.App{
+	return &cli.App{
 		Name:  "invoke",
 		Usage: "Invoke a lambda function via http",
-		Flags: flags,
+		Description: "Exits with 0 when the function succeeded, 1 for invalid flags, 2 when the lambda endpoint " +
+			"could not be reached, 3 when it rejected the invocation, 4 for a function error, 5 for a timeout and 6 when verify found a mismatch",
+		Flags:  flags,
+		Before: offline.LoadRegistryFile,
+		Commands: []*cli.Command{
+			batchCommand(),
+			verifyCommand(),
+			replCommand(),
+			loadCommand(),
+		},
 		Action: func(ctx *cli.Context) error {
-			payload := ctx.String(Payload)
-			if payload == "" {
-				payload = "{}"
+			format, err := ParseOutputFormat(ctx.String(Output))
+			if err != nil {
+				return cli.Exit(err.Error(), exitCodeUsage)
+			}
+
+			invocationType, err := offline.ParseInvocationType(ctx.String(InvocationType))
+			if err != nil {
+				return cli.Exit(err.Error(), exitCodeUsage)
+			}
+
+			invokeCtx, err := invokeContext(ctx)
+			if err != nil {
+				return cli.Exit(err.Error(), exitCodeUsage)
+			}
+
+			if ctx.Bool(Watch) {
+				if invocationType != offline.InvocationTypeRequestResponse {
+					return cli.Exit("--watch only supports RequestResponse invocations", exitCodeUsage)
+				}
+				invoker, err := offline.InvokerFromCLI(ctx, Function)
+				if err != nil {
+					return cli.Exit(err.Error(), exitCodeUsage)
+				}
+				return runWatch(ctx, format, invokeCtx, invoker)
+			}
+
+			payload, err := payloadFromCLI(ctx)
+			if err != nil {
+				return cli.Exit(err.Error(), exitCodeUsage)
+			}
+
+			switch invocationType {
+			case offline.InvocationTypeDryRun:
+				// the lambda endpoint validates the invocation without running the function
+				invokeCtx = offline.WithDryRun(invokeCtx)
+			case offline.InvocationTypeEvent:
+				return invokeAsync(ctx, invokeCtx, payload)
 			}
 
-			result, err := offline.LambdaInvokeFromCLI(ctx, Function, []byte(payload))
+			invoker, err := offline.InvokerFromCLI(ctx, Function)
 			if err != nil {
-				return cli.Exit("failed to invoke lambda", 1)
+				return cli.Exit(err.Error(), exitCodeUsage)
 			}
 
-			return cli.Exit(string(result), 0)
+			start := time.Now()
+			result, err := invoker.Invoke(invokeCtx, payload)
+			return writeResult(ctx, format, result, err, time.Since(start))
 		},
 	}
+}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+// invokeAsync queues the payload like an Event invocation, then keeps the process alive until the
+// invocation succeeded or was discarded so that retries can be observed.
+func invokeAsync(ctx *cli.Context, invokeCtx context.Context, payload []byte) error {
+	config, err := offline.AsyncInvokerConfigFromCLI(ctx, Function)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	syncInvoker, err := offline.InvokerFromCLI(ctx, Function)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	invoker := offline.NewAsyncInvoker(syncInvoker, config)
+	go invoker.Run(ctx.Context)
+
+	result, err := invoker.Invoke(invokeCtx, payload)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("failed to queue lambda invocation: %v", err), exitCode(err))
+	}
+	zap.L().Info("queued asynchronous invocation", zap.String("request.id", result.RequestID))
+
+	if err := invoker.Wait(ctx.Context); err != nil {
+		return cli.Exit("interrupted before the asynchronous invocation completed", exitCodeTransport)
 	}
+
+	return nil
+}
+
+// invokeContext forwards the trace header and client context from the flags to the invocation.
+func invokeContext(ctx *cli.Context) (context.Context, error) {
+	invokeCtx := ctx.Context
+	if traceID := ctx.String(TraceID); traceID != "" {
+		invokeCtx = offline.WithTraceID(invokeCtx, traceID)
+	}
+
+	if clientContextJSON := ctx.String(ClientContext); clientContextJSON != "" {
+		var clientContext lambdacontext.ClientContext
+		if err := json.Unmarshal([]byte(clientContextJSON), &clientContext); err != nil {
+			return nil, fmt.Errorf("invalid client context: %w", err)
+		}
+		invokeCtx = offline.WithClientContext(invokeCtx, &clientContext)
+	}
+
+	return invokeCtx, nil
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// newTestLambda serves the lambda invoke API with the handler.
+func newTestLambda(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// respond returns a handler writing a canned lambda response.
+func respond(statusCode int, header http.Header, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statusCode)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+// runInvoke runs the invoke command with the arguments, returning its output and exit code.
+func runInvoke(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	app := newApp()
+	app.Reader = strings.NewReader(stdin)
+	app.Writer = &stdout
+	app.ErrWriter = &stderr
+	// the exit code is returned rather than exiting the test
+	app.ExitErrHandler = func(*cli.Context, error) {}
+
+	code := exitCodeSuccess
+	if err := app.Run(append([]string{"invoke"}, args...)); err != nil {
+		var exitErr cli.ExitCoder
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("invoke failed without an exit code: %v", err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	return stdout.String(), stderr.String(), code
+}
+
+func TestInvokeExitCodes(t *testing.T) {
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		args    []string
+		want    int
+	}{
+		{name: "success", handler: respond(http.StatusOK, nil, `"ok"`), want: exitCodeSuccess},
+		{name: "invalid output", handler: respond(http.StatusOK, nil, `"ok"`), args: []string{"--output", "xml"}, want: exitCodeUsage},
+		{name: "invalid payload", handler: respond(http.StatusOK, nil, `"ok"`), args: []string{"--set", "a..b=1"}, want: exitCodeUsage},
+		{
+			name:    "function error",
+			handler: respond(http.StatusOK, http.Header{offline.HeaderFunctionError: {"Unhandled"}}, `{"errorMessage":"boom"}`),
+			want:    exitCodeFunctionError,
+		},
+		{
+			name: "timeout",
+			handler: respond(http.StatusOK, http.Header{offline.HeaderFunctionError: {"Unhandled"}},
+				`{"errorType":"Sandbox.Timedout","errorMessage":"Task timed out after 3.00 seconds"}`),
+			want: exitCodeTimeout,
+		},
+		{
+			name:    "service error",
+			handler: respond(http.StatusNotFound, http.Header{offline.HeaderErrorType: {"ResourceNotFoundException"}}, `{"message":"Function not found"}`),
+			want:    exitCodeServiceError,
+		},
+		{name: "transport error", want: exitCodeTransport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := unreachable.URL
+			if tt.handler != nil {
+				endpoint = newTestLambda(t, tt.handler).URL
+			}
+
+			_, _, code := runInvoke(t, "", append([]string{"--lambda-endpoint", endpoint}, tt.args...)...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvokeOutput(t *testing.T) {
+	lambda := newTestLambda(t, respond(http.StatusOK, http.Header{
+		offline.HeaderRequestID:       {"request"},
+		offline.HeaderExecutedVersion: {"$LATEST"},
+		offline.HeaderFunctionError:   {"Handled"},
+	}, `{"errorMessage":"boom"}`))
+
+	tests := []struct {
+		output string
+		want   []string
+	}{
+		{output: "raw", want: []string{`{"errorMessage":"boom"}`}},
+		{
+			output: "json",
+			want: []string{
+				`"statusCode":200`, `"requestId":"request"`, `"functionError":"Handled"`,
+				`"payload":{"errorMessage":"boom"}`, `"exitCode":4`,
+			},
+		},
+		{
+			output: "pretty",
+			want:   []string{"Status:          200", "Request ID:      request", "Function error:  Handled", `"errorMessage": "boom"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			stdout, _, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL, "--output", tt.output)
+			if code != exitCodeFunctionError {
+				t.Errorf("exit code = %d, want %d", code, exitCodeFunctionError)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output = %q, want it to contain %q", stdout, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInvokeDryRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		want       int
+	}{
+		{name: "accepted", statusCode: http.StatusNoContent, want: exitCodeSuccess},
+		{name: "rejected", statusCode: http.StatusNotFound, want: exitCodeServiceError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var invocationType string
+			lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+				invocationType = r.Header.Get(offline.HeaderInvocationType)
+				w.WriteHeader(tt.statusCode)
+			})
+
+			stdout, _, code := runInvoke(t, "", "--lambda-endpoint", lambda.URL, "--invocation-type", "DryRun")
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d", code, tt.want)
+			}
+			if invocationType != string(offline.InvocationTypeDryRun) {
+				t.Errorf("invocation type = %q, want the endpoint asked for a dry run", invocationType)
+			}
+			if stdout != "" {
+				t.Errorf("output = %q, want none", stdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// invocationStats collects the latencies and errors of a series of invocations.
+type invocationStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func newInvocationStats() *invocationStats {
+	return &invocationStats{
+		errors: make(map[string]int),
+	}
+}
+
+// add records an invocation, the error may be nil when it succeeded.
+func (s *invocationStats) add(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies = append(s.latencies, latency)
+	if class := errorClass(err); class != "" {
+		s.errors[class]++
+	}
+}
+
+// counts returns the number of invocations and how many of them failed.
+func (s *invocationStats) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.latencies), s.failed()
+}
+
+// failed counts the failed invocations, the lock must be held.
+func (s *invocationStats) failed() int {
+	failed := 0
+	for _, count := range s.errors {
+		failed += count
+	}
+
+	return failed
+}
+
+// sorted returns a sorted copy of the latencies.
+func (s *invocationStats) sorted() []time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sortedLocked()
+}
+
+// sortedLocked returns a sorted copy of the latencies, the lock must be held.
+func (s *invocationStats) sortedLocked() []time.Duration {
+	latencies := append([]time.Duration(nil), s.latencies...)
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	return latencies
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// writeSummary writes the invocation count, latency percentiles and error counts.
+func (s *invocationStats) writeSummary(w io.Writer, elapsed time.Duration) {
+	// the counts and latencies are taken at once, so that invocations recorded meanwhile do not
+	// make them disagree
+	s.mu.Lock()
+	latencies := s.sortedLocked()
+	failed := s.failed()
+	classes := make([]string, 0, len(s.errors))
+	for class, count := range s.errors {
+		classes = append(classes, fmt.Sprintf("%s: %d", class, count))
+	}
+	s.mu.Unlock()
+	total := len(latencies)
+
+	fmt.Fprintf(w, "invocations: %d, succeeded: %d, failed: %d", total, total-failed, failed)
+	if elapsed > 0 {
+		fmt.Fprintf(w, ", throughput: %.2f/s", float64(total)/elapsed.Seconds())
+	}
+	fmt.Fprintln(w)
+	if total > 0 {
+		fmt.Fprintf(w, "latency: min %s, p50 %s, p95 %s, p99 %s, max %s\n",
+			formatLatency(latencies[0]),
+			formatLatency(percentile(latencies, 50)),
+			formatLatency(percentile(latencies, 95)),
+			formatLatency(percentile(latencies, 99)),
+			formatLatency(latencies[total-1]),
+		)
+	}
+	if len(classes) > 0 {
+		sort.Strings(classes)
+		fmt.Fprintf(w, "errors: %s\n", strings.Join(classes, ", "))
+	}
+}
+
+func formatLatency(latency time.Duration) string {
+	return fmt.Sprintf("%.2fms", float64(latency.Microseconds())/1000)
+}
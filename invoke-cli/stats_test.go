@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0, want: time.Millisecond},
+		{p: 50, want: 50 * time.Millisecond},
+		{p: 95, want: 95 * time.Millisecond},
+		{p: 99.5, want: 100 * time.Millisecond},
+		{p: 100, want: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of no latencies = %s, want 0", got)
+	}
+}
+
+func TestInvocationStatsSummary(t *testing.T) {
+	stats := newInvocationStats()
+	stats.add(3*time.Millisecond, nil)
+	stats.add(time.Millisecond, nil)
+	stats.add(2*time.Millisecond, errors.New("connection refused"))
+	stats.add(4*time.Millisecond, &offline.FunctionError{Kind: offline.FunctionErrorUnhandled})
+
+	if total, failed := stats.counts(); total != 4 || failed != 2 {
+		t.Errorf("counts() = %d, %d, want 4, 2", total, failed)
+	}
+
+	var summary bytes.Buffer
+	stats.writeSummary(&summary, 2*time.Second)
+	want := "invocations: 4, succeeded: 2, failed: 2, throughput: 2.00/s\n" +
+		"latency: min 1.00ms, p50 2.00ms, p95 4.00ms, p99 4.00ms, max 4.00ms\n" +
+		"errors: function error: 1, transport: 1\n"
+	if summary.String() != want {
+		t.Errorf("summary = %q, want %q", summary.String(), want)
+	}
+
+	summary.Reset()
+	newInvocationStats().writeSummary(&summary, 0)
+	if want := "invocations: 0, succeeded: 0, failed: 0\n"; summary.String() != want {
+		t.Errorf("empty summary = %q, want %q", summary.String(), want)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	Ignore = "ignore"
+	Update = "update"
+)
+
+const (
+	requestFileSuffix  = ".request.json"
+	responseFileSuffix = ".response.json"
+	// errorFileSuffix is the golden file of the function error of a response, absent when it succeeded
+	errorFileSuffix = ".error"
+)
+
+func verifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "verify",
+		Usage:     "Invoke the lambda function with each request of a directory and compare the responses to golden files",
+		ArgsUsage: "<directory>",
+		Description: "Each {name}" + requestFileSuffix + " file of the directory is sent to the function, wrapped in " +
+			"the event template and updated by the set flags of the invoke command, and the response payload " +
+			"is compared to {name}" + responseFileSuffix + ", and its function error, if any, to {name}" + errorFileSuffix +
+			". JSON responses are compared as documents, so formatting and the order of keys do not matter. " +
+			"Exits with 6 when a response does not match",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name: Ignore,
+				Usage: "Path of the response to leave out of the comparison, with * matching any key or index. " +
+					"i.e. requestId or Records[*].eventID",
+			},
+			&cli.BoolFlag{
+				Name:  Update,
+				Usage: "Write the responses to the golden files instead of comparing them",
+			},
+		},
+		Action: runVerify,
+	}
+}
+
+func runVerify(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return cli.Exit("verify expects the directory of requests as its only argument", exitCodeUsage)
+	}
+	dir := ctx.Args().First()
+
+	ignored, err := parseJSONPaths(ctx.StringSlice(Ignore))
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	requests, err := filepath.Glob(filepath.Join(dir, "*"+requestFileSuffix))
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+	if len(requests) == 0 {
+		return cli.Exit(fmt.Sprintf("no *%s files in %s", requestFileSuffix, dir), exitCodeUsage)
+	}
+	sort.Strings(requests)
+
+	invoker, err := offline.InvokerFromCLI(ctx, Function)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+	invokeCtx, err := invokeContext(ctx)
+	if err != nil {
+		return cli.Exit(err.Error(), exitCodeUsage)
+	}
+
+	w := ctx.App.Writer
+	failed := 0
+	for _, requestPath := range requests {
+		name := strings.TrimSuffix(filepath.Base(requestPath), requestFileSuffix)
+		responsePath := strings.TrimSuffix(requestPath, requestFileSuffix) + responseFileSuffix
+		errorPath := strings.TrimSuffix(requestPath, requestFileSuffix) + errorFileSuffix
+
+		request, err := os.ReadFile(requestPath)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("failed to read request: %v", err), exitCodeUsage)
+		}
+		payload, err := newPayload(ctx, request)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("invalid request %s: %v", name, err), exitCodeUsage)
+		}
+
+		start := time.Now()
+		result, err := invoker.Invoke(invokeCtx, payload)
+		duration := formatLatency(time.Since(start))
+
+		// function errors are part of the contract of the function, other errors are not responses
+		var fnErr *offline.FunctionError
+		if err != nil && !errors.As(err, &fnErr) {
+			failed++
+			fmt.Fprintf(w, "FAIL %s (%s)\n  %v\n", name, duration, err)
+			continue
+		}
+
+		if ctx.Bool(Update) {
+			if err := os.WriteFile(responsePath, goldenPayload(result.Payload), 0o644); err != nil {
+				return cli.Exit(fmt.Sprintf("failed to write golden file: %v", err), exitCodeUsage)
+			}
+			if err := writeGoldenError(errorPath, result.FunctionError); err != nil {
+				return cli.Exit(fmt.Sprintf("failed to write golden file: %v", err), exitCodeUsage)
+			}
+			fmt.Fprintf(w, "UPDATED %s (%s)\n", name, duration)
+			continue
+		}
+
+		golden, err := os.ReadFile(responsePath)
+		if err != nil {
+			failed++
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(w, "FAIL %s (%s)\n  missing %s, run with --%s to create it\n",
+					name, duration, filepath.Base(responsePath), Update)
+			} else {
+				fmt.Fprintf(w, "FAIL %s (%s)\n  %v\n", name, duration, err)
+			}
+			continue
+		}
+
+		goldenError, err := readGoldenError(errorPath)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL %s (%s)\n  %v\n", name, duration, err)
+			continue
+		}
+
+		differences := diffJSON(golden, result.Payload, ignored)
+		if len(differences) == 0 && goldenError == result.FunctionError {
+			fmt.Fprintf(w, "ok   %s (%s)\n", name, duration)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(w, "FAIL %s (%s)\n", name, duration)
+		if goldenError != result.FunctionError {
+			fmt.Fprintf(w, "  function error: expected %s, got %s\n",
+				functionErrorName(goldenError), functionErrorName(result.FunctionError))
+		}
+		for _, difference := range differences {
+			fmt.Fprintf(w, "  %s\n", difference)
+		}
+	}
+
+	if ctx.Bool(Update) {
+		fmt.Fprintf(w, "%d updated, %d failed\n", len(requests)-failed, failed)
+	} else {
+		fmt.Fprintf(w, "%d passed, %d failed\n", len(requests)-failed, failed)
+	}
+	if failed > 0 {
+		return cli.Exit("", exitCodeMismatch)
+	}
+
+	return nil
+}
+
+// goldenPayload indents JSON payloads so that golden files are readable and diff well.
+func goldenPayload(payload []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, payload, "", "  "); err != nil {
+		return payload
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+// writeGoldenError records the function error of a response next to its golden file, removing the
+// record of a previous error when the function succeeded.
+func writeGoldenError(path string, kind offline.FunctionErrorKind) error {
+	if kind == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	return os.WriteFile(path, []byte(string(kind)+"\n"), 0o644)
+}
+
+// readGoldenError reads the function error recorded for a response, which is empty when there is no
+// record, as the function succeeded.
+func readGoldenError(path string) (offline.FunctionErrorKind, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return offline.FunctionErrorKind(strings.TrimSpace(string(data))), nil
+}
+
+func functionErrorName(kind offline.FunctionErrorKind) string {
+	if kind == "" {
+		return "none"
+	}
+
+	return string(kind)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// newVerifyLambda returns the endpoint of a lambda responding with the payload and the ID of the
+// request, which differs for every invocation, failing for the payloads asking to.
+func newVerifyLambda(t *testing.T) string {
+	t.Helper()
+
+	var requests int64
+	lambda := newTestLambda(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "fail") {
+			w.Header().Set(offline.HeaderFunctionError, "Unhandled")
+		}
+		_, _ = fmt.Fprintf(w, `{"requestId":"%d","input":%s}`, atomic.AddInt64(&requests, 1), body)
+	})
+
+	return lambda.URL
+}
+
+// writeFiles writes the files of a directory, by name.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  int
+		// Lines the output must contain
+		wantOutput []string
+	}{
+		{
+			name: "passed",
+			files: map[string]string{
+				"a.request.json": `{"id":1}`,
+				// formatting and the order of keys do not matter
+				"a.response.json": "{\n  \"input\": {\"id\": 1},\n  \"requestId\": \"1\"\n}\n",
+			},
+			want:       exitCodeSuccess,
+			wantOutput: []string{"ok   a (", "1 passed, 0 failed"},
+		},
+		{
+			name: "mismatch",
+			files: map[string]string{
+				"a.request.json":  `{"id":1}`,
+				"a.response.json": `{"requestId":"1","input":{"id":2}}`,
+			},
+			want:       exitCodeMismatch,
+			wantOutput: []string{"FAIL a (", "input.id: expected 2, got 1", "0 passed, 1 failed"},
+		},
+		{
+			name: "ignored",
+			files: map[string]string{
+				"a.request.json":  `{"id":1}`,
+				"a.response.json": `{"requestId":"other","input":{"id":1}}`,
+				"b.request.json":  `{"id":2}`,
+				"b.response.json": `{"requestId":"other","input":{"id":2}}`,
+			},
+			args:       []string{"--ignore", "requestId"},
+			want:       exitCodeSuccess,
+			wantOutput: []string{"ok   a (", "ok   b (", "2 passed, 0 failed"},
+		},
+		{
+			name: "missing golden file",
+			files: map[string]string{
+				"a.request.json":  `{"id":1}`,
+				"a.response.json": `{"requestId":"1","input":{"id":1}}`,
+				"b.request.json":  `{"id":2}`,
+			},
+			want:       exitCodeMismatch,
+			wantOutput: []string{"ok   a (", "FAIL b (", "missing b.response.json, run with --update to create it", "1 passed, 1 failed"},
+		},
+		{
+			name: "function error",
+			files: map[string]string{
+				"a.request.json":  `{"fail":true}`,
+				"a.response.json": `{"requestId":"1","input":{"fail":true}}`,
+				"a.error":         "Unhandled\n",
+			},
+			want:       exitCodeSuccess,
+			wantOutput: []string{"ok   a (", "1 passed, 0 failed"},
+		},
+		{
+			name: "unexpected function error",
+			files: map[string]string{
+				"a.request.json":  `{"fail":true}`,
+				"a.response.json": `{"requestId":"1","input":{"fail":true}}`,
+			},
+			want:       exitCodeMismatch,
+			wantOutput: []string{"FAIL a (", "function error: expected none, got Unhandled"},
+		},
+		{
+			name: "missing function error",
+			files: map[string]string{
+				"a.request.json":  `{"id":1}`,
+				"a.response.json": `{"requestId":"1","input":{"id":1}}`,
+				"a.error":         "Unhandled\n",
+			},
+			want:       exitCodeMismatch,
+			wantOutput: []string{"FAIL a (", "function error: expected Unhandled, got none"},
+		},
+		{
+			name:  "no requests",
+			files: map[string]string{"a.response.json": `{}`},
+			want:  exitCodeUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			// the IDs of the requests are counted from 1 for each test, in the order of the files
+			args := append([]string{"--lambda-endpoint", newVerifyLambda(t), "verify"}, tt.args...)
+			stdout, _, code := runInvoke(t, "", append(args, dir)...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d\n%s", code, tt.want, stdout)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("output = %q, want it to contain %q", stdout, want)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyUpdate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.request.json":  `{"id":1}`,
+		"a.response.json": `{"stale":true}`,
+		// a succeeded and its error golden file is out of date
+		"a.error":        "Unhandled\n",
+		"b.request.json": `{"fail":true}`,
+	})
+
+	stdout, _, code := runInvoke(t, "", "--lambda-endpoint", newVerifyLambda(t), "verify", "--update", dir)
+	if code != exitCodeSuccess {
+		t.Fatalf("exit code = %d, want %d\n%s", code, exitCodeSuccess, stdout)
+	}
+	if !strings.Contains(stdout, "UPDATED a (") || !strings.Contains(stdout, "2 updated, 0 failed") {
+		t.Errorf("output = %q, want the golden files updated", stdout)
+	}
+
+	golden, err := os.ReadFile(filepath.Join(dir, "a.response.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// golden files are indented
+	if want := "{\n  \"requestId\": \"1\",\n  \"input\": {\n    \"id\": 1\n  }\n}\n"; string(golden) != want {
+		t.Errorf("a.response.json = %q, want %q", golden, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.error")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a.error stat error = %v, want it removed", err)
+	}
+	goldenError, err := os.ReadFile(filepath.Join(dir, "b.error"))
+	if err != nil || string(goldenError) != "Unhandled\n" {
+		t.Errorf("b.error = %q, %v, want the function error", goldenError, err)
+	}
+
+	// the updated golden files pass
+	stdout, _, code = runInvoke(t, "", "--lambda-endpoint", newVerifyLambda(t), "verify", dir)
+	if code != exitCodeSuccess {
+		t.Errorf("exit code = %d, want %d\n%s", code, exitCodeSuccess, stdout)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	Watch         = "watch"
+	WatchFile     = "watch-file"
+	WatchInterval = "watch-interval"
+)
+
+func watchFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name: Watch,
+			Usage: "Keep running and invoke the function again each time the payload file or a watch file " +
+				"changes, printing the changes of the response to stderr",
+		},
+		&cli.StringSliceFlag{
+			Name:  WatchFile,
+			Usage: "File to watch in addition to the payload file, i.e. a file touched by the build of the function",
+		},
+		&cli.DurationFlag{
+			Name:  WatchInterval,
+			Value: 500 * time.Millisecond,
+			Usage: "Interval to check the watched files for changes at",
+		},
+	}
+}
+
+// fileStamp identifies a version of a watched file.
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// fileWatcher polls files for changes, which works the same on every platform and with files
+// replaced by editors and builds rather than written in place.
+type fileWatcher struct {
+	paths    []string
+	interval time.Duration
+	stamps   map[string]fileStamp
+}
+
+func newFileWatcher(paths []string, interval time.Duration) *fileWatcher {
+	w := &fileWatcher{
+		paths:    paths,
+		interval: interval,
+	}
+	w.stamps = w.stat()
+
+	return w
+}
+
+func (w *fileWatcher) stat() map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(w.paths))
+	for _, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			stamps[path] = fileStamp{}
+			continue
+		}
+		stamps[path] = fileStamp{exists: true, modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps
+}
+
+// wait blocks until a file changed and then did not change for an interval, so that a file being
+// written is not read half way. It returns the changed files, or false when the context is done.
+func (w *fileWatcher) wait(ctx context.Context) ([]string, bool) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	var pending map[string]fileStamp
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-ticker.C:
+		}
+
+		stamps := w.stat()
+		if pending != nil && reflect.DeepEqual(stamps, pending) {
+			var changed []string
+			for _, path := range w.paths {
+				if stamps[path] != w.stamps[path] {
+					changed = append(changed, path)
+				}
+			}
+			w.stamps = stamps
+			pending = nil
+			if len(changed) > 0 {
+				return changed, true
+			}
+			continue
+		}
+		if !reflect.DeepEqual(stamps, w.stamps) {
+			pending = stamps
+		}
+	}
+}
+
+// runWatch invokes the function each time the watched files change until the process is
+// interrupted, printing the changes of the response since the previous invocation.
+func runWatch(ctx *cli.Context, format OutputFormat, invokeCtx context.Context, invoker offline.Invoker) error {
+	if ctx.String(Payload) == stdinPayload || ctx.String(PayloadFile) == stdinPayload {
+		return cli.Exit("--watch cannot read the payload from stdin", exitCodeUsage)
+	}
+	// the files are polled by a ticker, which needs a positive interval
+	interval := ctx.Duration(WatchInterval)
+	if interval <= 0 {
+		return cli.Exit(fmt.Sprintf("invalid watch interval %s", interval), exitCodeUsage)
+	}
+
+	paths := ctx.StringSlice(WatchFile)
+	if path := ctx.String(PayloadFile); path != "" {
+		paths = append([]string{path}, paths...)
+	}
+	if len(paths) == 0 {
+		return cli.Exit(fmt.Sprintf("--%s requires --%s or --%s", Watch, PayloadFile, WatchFile), exitCodeUsage)
+	}
+
+	stop := offline.TrapProcess()
+	// interrupting the process cancels a hung invocation as well as the watch
+	invokeCtx, cancel := context.WithCancel(invokeCtx)
+	defer cancel()
+	stopInvocation := context.AfterFunc(stop, cancel)
+	defer stopInvocation()
+
+	watcher := newFileWatcher(paths, interval)
+	errOut := ctx.App.ErrWriter
+
+	var previous []byte
+	for {
+		if payload, err := payloadFromCLI(ctx); err != nil {
+			fmt.Fprintln(errOut, err)
+		} else {
+			start := time.Now()
+			result, err := invoker.Invoke(invokeCtx, payload)
+			if stop.Err() != nil {
+				return nil
+			}
+			output := newInvocationOutput(result, err, time.Since(start))
+			if writeErr := writeOutput(ctx, format, output, result); writeErr != nil {
+				return cli.Exit(writeErr.Error(), exitCodeUsage)
+			}
+			// separate the raw payloads of consecutive invocations
+			if format == OutputRaw && result != nil && !isTerminal(ctx.App.Writer) {
+				fmt.Fprintln(ctx.App.Writer)
+			}
+			if err != nil {
+				fmt.Fprintln(errOut, err)
+			}
+
+			if result != nil {
+				if previous != nil {
+					writeResponseChanges(ctx, previous, result.Payload)
+				}
+				previous = result.Payload
+			}
+		}
+
+		fmt.Fprintf(errOut, "watching %s\n", strings.Join(paths, ", "))
+		changed, ok := watcher.wait(stop)
+		if !ok {
+			return nil
+		}
+		fmt.Fprintf(errOut, "\n%s changed at %s\n", strings.Join(changed, ", "), time.Now().Format(time.TimeOnly))
+	}
+}
+
+func writeResponseChanges(ctx *cli.Context, previous, current []byte) {
+	differences := diffJSON(previous, current, nil)
+	if len(differences) == 0 {
+		fmt.Fprintln(ctx.App.ErrWriter, "response unchanged")
+		return
+	}
+
+	fmt.Fprintln(ctx.App.ErrWriter, "response changed:")
+	for _, difference := range differences {
+		fmt.Fprintf(ctx.App.ErrWriter, "  %s\n", difference.Change())
+	}
+}
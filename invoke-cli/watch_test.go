@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	payload := filepath.Join(dir, "payload.json")
+	sentinel := filepath.Join(dir, "build.done")
+	if err := os.WriteFile(payload, []byte(`{}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	watcher := newFileWatcher([]string{payload, sentinel}, 10*time.Millisecond)
+
+	tests := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{
+			name:   "changed file",
+			change: func() error { return os.WriteFile(payload, []byte(`{"id":1}`), 0o600) },
+			want:   []string{payload},
+		},
+		{
+			name:   "created file",
+			change: func() error { return os.WriteFile(sentinel, nil, 0o600) },
+			want:   []string{sentinel},
+		},
+		{
+			name:   "removed file",
+			change: func() error { return os.Remove(sentinel) },
+			want:   []string{sentinel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			changed, ok := watcher.wait(ctx)
+			if !ok || !reflect.DeepEqual(changed, tt.want) {
+				t.Errorf("wait() = %q, %v, want %q", changed, ok, tt.want)
+			}
+		})
+	}
+
+	// nothing changed since
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if changed, ok := watcher.wait(ctx); ok {
+		t.Errorf("wait() = %q, want no change before the context is done", changed)
+	}
+}
+
+func TestWatchUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "nothing to watch", args: []string{"--watch", "-p", "{}"}},
+		{name: "stdin payload", args: []string{"--watch", "--payload-file", "-"}},
+		{name: "event invocation", args: []string{"--watch", "--payload-file", "payload.json", "--invocation-type", "Event"}},
+		{name: "zero interval", args: []string{"--watch", "--payload-file", "payload.json", "--watch-interval", "0"}},
+		{name: "negative interval", args: []string{"--watch", "--payload-file", "payload.json", "--watch-interval", "-1s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, code := runInvoke(t, "", tt.args...); code != exitCodeUsage {
+				t.Errorf("exit code = %d, want %d", code, exitCodeUsage)
+			}
+		})
+	}
+}
+
+func TestWatch(t *testing.T) {
+	endpoint, invocations := newRecordingLambda(t)
+	payload := filepath.Join(t.TempDir(), "payload.json")
+	if err := os.WriteFile(payload, []byte(`{"id":1,"name":"a"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type watchResult struct {
+		stdout, stderr string
+		code           int
+	}
+	done := make(chan watchResult, 1)
+	go func() {
+		stdout, stderr, code := runInvoke(t, "", "--lambda-endpoint", endpoint, "--watch",
+			"--payload-file", payload, "--watch-interval", "10ms")
+		done <- watchResult{stdout: stdout, stderr: stderr, code: code}
+	}()
+
+	waitForInvocations := func(count int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(invocations()) < count {
+			if time.Now().After(deadline) {
+				t.Fatalf("invocations = %q, want %d", invocations(), count)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitForInvocations(1)
+	if err := os.WriteFile(payload, []byte(`{"id":2,"name":"a","tags":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitForInvocations(2)
+
+	// the watch runs until the process is interrupted
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	var result watchResult
+	select {
+	case result = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch did not stop when the process was interrupted")
+	}
+
+	if result.code != exitCodeSuccess {
+		t.Errorf("exit code = %d, want %d", result.code, exitCodeSuccess)
+	}
+	if want := "{\"id\":1,\"name\":\"a\"}\n{\"id\":2,\"name\":\"a\",\"tags\":[]}\n"; result.stdout != want {
+		t.Errorf("output = %q, want %q", result.stdout, want)
+	}
+	for _, want := range []string{"watching " + payload, payload + " changed at", "response changed:\n  id: 1 -> 2\n  tags: added []\n"} {
+		if !strings.Contains(result.stderr, want) {
+			t.Errorf("stderr = %q, want it to contain %q", result.stderr, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package offline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const (
+	HeaderTraceID       = "X-Amzn-Trace-Id"
+	HeaderClientContext = "X-Amz-Client-Context"
+	HeaderLogType       = "X-Amz-Log-Type"
+	HeaderLogResult     = "X-Amz-Log-Result"
+)
+
+// LogType is the value of the X-Amz-Log-Type header sent to lambda.
+type LogType string
+
+const (
+	// LogTypeNone does not return any logs of the invocation.
+	LogTypeNone LogType = "None"
+	// LogTypeTail returns the last 4 KB of logs of the invocation in the result.
+	LogTypeTail LogType = "Tail"
+)
+
+type (
+	traceIDKey       struct{}
+	clientContextKey struct{}
+	dryRunKey        struct{}
+)
+
+// NewTraceID generates a sampled X-Ray trace header with a new root trace id.
+func NewTraceID() string {
+	var id [12]byte
+	_, _ = rand.Read(id[:])
+	return fmt.Sprintf("Root=1-%08x-%s;Sampled=1", time.Now().Unix(), hex.EncodeToString(id[:]))
+}
+
+// WithTraceID returns a context which forwards the X-Ray trace header to invoked functions.
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey{}).(string)
+	return traceID, ok && traceID != ""
+}
+
+// WithClientContext returns a context which passes the client context to invoked functions.
+func WithClientContext(ctx context.Context, clientContext *lambdacontext.ClientContext) context.Context {
+	return context.WithValue(ctx, clientContextKey{}, clientContext)
+}
+
+func ClientContextFromContext(ctx context.Context) (*lambdacontext.ClientContext, bool) {
+	clientContext, ok := ctx.Value(clientContextKey{}).(*lambdacontext.ClientContext)
+	return clientContext, ok && clientContext != nil
+}
+
+// WithDryRun returns a context which asks the lambda endpoint to validate invocations without running
+// the function, as DryRun invocations.
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunKey{}, true)
+}
+
+func DryRunFromContext(ctx context.Context) bool {
+	dryRun, _ := ctx.Value(dryRunKey{}).(bool)
+	return dryRun
+}
+
+// setInvokeContextHeaders sets the trace and client context headers of the invocation request from
+// the context, generating a new trace when none is forwarded.
+func setInvokeContextHeaders(ctx context.Context, header http.Header) error {
+	traceID, ok := TraceIDFromContext(ctx)
+	if !ok {
+		traceID = NewTraceID()
+	}
+	header.Set(HeaderTraceID, traceID)
+
+	if clientContext, ok := ClientContextFromContext(ctx); ok {
+		clientContextBytes, err := json.Marshal(clientContext)
+		if err != nil {
+			return fmt.Errorf("failed to marshal client context: %w", err)
+		}
+		header.Set(HeaderClientContext, base64.StdEncoding.EncodeToString(clientContextBytes))
+	}
+
+	return nil
+}
+
+// decodeLogResult decodes the base64 log tail returned by lambda.
+func decodeLogResult(logResult string) (string, error) {
+	if logResult == "" {
+		return "", nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(logResult)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode log result: %w", err)
+	}
+
+	return string(decoded), nil
+}
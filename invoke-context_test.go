@@ -0,0 +1,171 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+func TestNewTraceID(t *testing.T) {
+	pattern := regexp.MustCompile(`^Root=1-[0-9a-f]{8}-[0-9a-f]{24};Sampled=1$`)
+	first, second := NewTraceID(), NewTraceID()
+	if !pattern.MatchString(first) {
+		t.Errorf("NewTraceID() = %q, want an X-Ray trace header", first)
+	}
+	if first == second {
+		t.Errorf("NewTraceID() returned %q twice", first)
+	}
+}
+
+func TestSetInvokeContextHeaders(t *testing.T) {
+	clientContext := &lambdacontext.ClientContext{
+		Client: lambdacontext.ClientApplication{AppTitle: "app"},
+		Custom: map[string]string{"tenant": "acme"},
+	}
+	ctx := WithClientContext(WithTraceID(context.Background(), "Root=1-5759e988-bd862e3fe1be46a994272793"), clientContext)
+
+	header := http.Header{}
+	if err := setInvokeContextHeaders(ctx, header); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get(HeaderTraceID); got != "Root=1-5759e988-bd862e3fe1be46a994272793" {
+		t.Errorf("trace header = %q, want the forwarded trace", got)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header.Get(HeaderClientContext))
+	if err != nil {
+		t.Fatalf("client context header is not base64: %v", err)
+	}
+	var got lambdacontext.ClientContext
+	if err := json.Unmarshal(decoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, clientContext) {
+		t.Errorf("client context = %+v, want %+v", got, clientContext)
+	}
+
+	// a new trace is started when none is forwarded
+	header = http.Header{}
+	if err := setInvokeContextHeaders(context.Background(), header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get(HeaderTraceID) == "" || header.Get(HeaderClientContext) != "" {
+		t.Errorf("headers without a forwarded context = %v, want a new trace only", header)
+	}
+}
+
+func TestDecodeLogResult(t *testing.T) {
+	tests := []struct {
+		logResult string
+		want      string
+		wantErr   bool
+	}{
+		{logResult: "", want: ""},
+		{logResult: base64.StdEncoding.EncodeToString([]byte("START RequestId: 1\nEND RequestId: 1\n")), want: "START RequestId: 1\nEND RequestId: 1\n"},
+		{logResult: "not base64!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.logResult, func(t *testing.T) {
+			got, err := decodeLogResult(tt.logResult)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeLogResult(%q) error = %v, wantErr %v", tt.logResult, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeLogResult(%q) = %q, want %q", tt.logResult, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPInvokerLogTail(t *testing.T) {
+	tests := []struct {
+		name      string
+		logResult string
+		want      string
+	}{
+		{name: "log tail", logResult: base64.StdEncoding.EncodeToString([]byte("hello\n")), want: "hello\n"},
+		{name: "invalid log tail", logResult: "not base64!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logType string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logType = r.Header.Get(HeaderLogType)
+				w.Header().Set(HeaderLogResult, tt.logResult)
+				_, _ = io.WriteString(w, `"ok"`)
+			}))
+			defer server.Close()
+
+			invoker := NewHTTPInvoker(server.URL, time.Minute)
+			invoker.LogType = LogTypeTail
+
+			// the log tail is informational, so the invocation succeeds without it
+			result, err := invoker.Invoke(context.Background(), []byte(`{}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if logType != string(LogTypeTail) {
+				t.Errorf("log type header = %q, want %s", logType, LogTypeTail)
+			}
+			if result.LogResult != tt.want || string(result.Payload) != `"ok"` {
+				t.Errorf("Invoke() = %q with log tail %q, want \"ok\" with %q", result.Payload, result.LogResult, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncInvokerTrace(t *testing.T) {
+	const traceID = "Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=1"
+
+	var (
+		mu     sync.Mutex
+		traces []string
+	)
+	errs := []error{newTestFunctionError()}
+	invoker := InvokeFunc(func(ctx context.Context, _ []byte) (*InvokeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		trace, _ := TraceIDFromContext(ctx)
+		traces = append(traces, trace)
+		if len(errs) > 0 {
+			err := errs[0]
+			errs = errs[1:]
+			return &InvokeResult{StatusCode: http.StatusOK}, err
+		}
+		return &InvokeResult{StatusCode: http.StatusOK}, nil
+	})
+
+	asyncInvoker := NewAsyncInvoker(invoker, AsyncInvokerConfig{
+		MaximumRetryAttempts: 1,
+		MaximumEventAge:      time.Minute,
+		RetryDelay:           time.Millisecond,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go asyncInvoker.Run(ctx)
+
+	if _, err := asyncInvoker.Invoke(WithTraceID(ctx, traceID), []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := asyncInvoker.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// every attempt belongs to the trace of the request which queued the event
+	if want := []string{traceID, traceID}; !reflect.DeepEqual(traces, want) {
+		t.Errorf("attempts traced as %q, want %q", traces, want)
+	}
+}
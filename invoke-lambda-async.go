@@ -0,0 +1,585 @@
+package offline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/google/uuid"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+const HeaderInvocationType = "X-Amz-Invocation-Type"
+
+// InvocationType is the value of the X-Amz-Invocation-Type header sent to lambda.
+type InvocationType string
+
+const (
+	// InvocationTypeRequestResponse invokes the function synchronously and waits for its response.
+	InvocationTypeRequestResponse InvocationType = "RequestResponse"
+	// InvocationTypeEvent queues the event and invokes the function asynchronously.
+	InvocationTypeEvent InvocationType = "Event"
+	// InvocationTypeDryRun validates the invocation without running the function.
+	InvocationTypeDryRun InvocationType = "DryRun"
+)
+
+func ParseInvocationType(value string) (InvocationType, error) {
+	switch invocationType := InvocationType(value); invocationType {
+	case InvocationTypeRequestResponse, InvocationTypeEvent, InvocationTypeDryRun:
+		return invocationType, nil
+	case "":
+		return InvocationTypeRequestResponse, nil
+	default:
+		return "", fmt.Errorf("unsupported invocation type %q", value)
+	}
+}
+
+const (
+	AsyncMaximumRetryAttemptsName   = "async-maximum-retry-attempts"
+	AsyncMaximumEventAgeName        = "async-maximum-event-age"
+	AsyncRetryDelayName             = "async-retry-delay"
+	EnvVarAsyncMaximumRetryAttempts = "LAMBDA_ASYNC_MAXIMUM_RETRY_ATTEMPTS"
+	EnvVarAsyncMaximumEventAge      = "LAMBDA_ASYNC_MAXIMUM_EVENT_AGE"
+	EnvVarAsyncRetryDelay           = "LAMBDA_ASYNC_RETRY_DELAY"
+)
+
+const (
+	// Upper bound of the retries lambda makes after a function error.
+	maxAsyncRetryAttempts = 2
+
+	// Bounds of the time lambda keeps an event in the queue.
+	minAsyncEventAge = time.Minute
+	maxAsyncEventAge = 6 * time.Hour
+
+	// Delay before lambda retries an event the first time after a function error.
+	defaultAsyncRetryDelay = time.Minute
+
+	// Bounds of the backoff used when the function is throttled or lambda fails to run it.
+	asyncThrottleBaseDelay = time.Second
+	asyncThrottleMaxDelay  = 5 * time.Minute
+)
+
+// AsyncInvokerConfig mirrors the asynchronous invocation configuration of a lambda function.
+type AsyncInvokerConfig struct {
+	// Times to retry an event after the function returns an error, between 0 and 2
+	MaximumRetryAttempts int
+	// Maximum time an event is kept in the queue before it is discarded
+	MaximumEventAge time.Duration
+	// Delay before the first retry after a function error, doubled for every retry after it
+	RetryDelay time.Duration
+	// ARN of the invoked function, qualified by the version or alias it is invoked with if any,
+	// reported in destination records
+	FunctionArn string
+	// Limiter of the function's reserved concurrency, which bounds the events invoked at once, if any
+	Concurrency *ConcurrencyLimiter
+	// Destination for records of successful invocations, if any
+	OnSuccess Destination
+	// Destination for records of discarded invocations, if any
+	OnFailure Destination
+}
+
+func (c AsyncInvokerConfig) Validate() error {
+	if c.MaximumRetryAttempts < 0 || c.MaximumRetryAttempts > maxAsyncRetryAttempts {
+		return fmt.Errorf("maximum retry attempts must be between 0 and %d", maxAsyncRetryAttempts)
+	}
+	if c.MaximumEventAge < minAsyncEventAge || c.MaximumEventAge > maxAsyncEventAge {
+		return fmt.Errorf("maximum event age must be between %s and %s", minAsyncEventAge, maxAsyncEventAge)
+	}
+	if c.RetryDelay < 0 {
+		return errors.New("retry delay must not be negative")
+	}
+
+	return nil
+}
+
+// AsyncEvent is an event accepted by the asynchronous invoker.
+type AsyncEvent struct {
+	// ID of the request which queued the event
+	RequestID string
+	// Payload to invoke the function with
+	Payload []byte
+	// Time the event was queued
+	ReceivedAt time.Time
+	// X-Ray trace header of the request which queued the event
+	TraceID string
+	// Number of times the function was run for the event
+	Attempts int
+	// Result of the last invocation, if the function was run
+	Result *InvokeResult
+	// Error of the last invocation
+	Err error
+
+	retries       int
+	throttles     int
+	clientContext *lambdacontext.ClientContext
+}
+
+// AsyncInvoker emulates the lambda asynchronous invocation queue, accepting events immediately and
+// invoking the function in the background with the retry semantics of the Event invocation type.
+type AsyncInvoker struct {
+	invoker Invoker
+	config  AsyncInvokerConfig
+
+	mu sync.Mutex
+	// Events ready to be invoked.
+	queue []*AsyncEvent
+	// Number of accepted events which have not been completed or discarded.
+	depth int
+	// Closed whenever there are no accepted events.
+	idle chan struct{}
+	// Events waiting for the delay of their retry.
+	delayed map[*AsyncEvent]*time.Timer
+	// Signals the run loop that an event is ready or an invocation completed.
+	ready chan struct{}
+	// Name of the function in the limiter of its reserved concurrency.
+	functionName string
+}
+
+func NewAsyncInvoker(invoker Invoker, config AsyncInvokerConfig) *AsyncInvoker {
+	idle := make(chan struct{})
+	close(idle)
+
+	functionName, _ := SplitFunctionName(config.FunctionArn)
+
+	return &AsyncInvoker{
+		invoker:      invoker,
+		config:       config,
+		idle:         idle,
+		delayed:      make(map[*AsyncEvent]*time.Timer),
+		ready:        make(chan struct{}, 1),
+		functionName: functionName,
+	}
+}
+
+// Invoke queues the payload and returns immediately with a 202 result, like an Event invocation.
+func (a *AsyncInvoker) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	event := &AsyncEvent{
+		RequestID:  uuid.New().String(),
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+	}
+	// every attempt of the event belongs to the trace of the request which queued it
+	if traceID, ok := TraceIDFromContext(ctx); ok {
+		event.TraceID = traceID
+	} else {
+		event.TraceID = NewTraceID()
+	}
+	if clientContext, ok := ClientContextFromContext(ctx); ok {
+		event.clientContext = clientContext
+	}
+
+	a.mu.Lock()
+	if a.depth == 0 {
+		a.idle = make(chan struct{})
+	}
+	a.depth++
+	a.mu.Unlock()
+
+	a.push(event)
+
+	return &InvokeResult{
+		StatusCode: http.StatusAccepted,
+		RequestID:  event.RequestID,
+	}, nil
+}
+
+// QueueDepth returns the number of events which are queued or waiting to be retried.
+func (a *AsyncInvoker) QueueDepth() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.depth
+}
+
+// Wait blocks until every accepted event was either completed or discarded.
+func (a *AsyncInvoker) Wait(ctx context.Context) error {
+	a.mu.Lock()
+	idle := a.idle
+	a.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+		return nil
+	}
+}
+
+// Run invokes queued events until the context is cancelled, as many at once as the reserved
+// concurrency of the function allows. Events still queued or waiting for a retry when the context
+// is cancelled are dropped, without being sent to the on-failure destination.
+func (a *AsyncInvoker) Run(ctx context.Context) {
+	defer a.shutdown()
+
+	for {
+		// taken before acquiring, so that concurrency released by the sync invokers of the function
+		// in the meantime is not missed
+		released := a.waitRelease()
+		if !a.acquire() {
+			// queued events keep ageing while the function is throttled, until they expire
+			expiry := a.expireQueued(ctx)
+			select {
+			case <-ctx.Done():
+				expiry.Stop()
+				return
+			case <-a.ready:
+			case <-released:
+			case <-expiry.C:
+			}
+			expiry.Stop()
+			continue
+		}
+
+		event := a.pop()
+		if event == nil {
+			a.release()
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.ready:
+			}
+			continue
+		}
+
+		go func() {
+			defer a.signal()
+			defer a.release()
+			a.process(ctx, event)
+		}()
+	}
+}
+
+// expireQueued discards the queued events older than the maximum event age, and returns a timer
+// which fires once the oldest of the remaining events expires.
+func (a *AsyncInvoker) expireQueued(ctx context.Context) *time.Timer {
+	var expired []*AsyncEvent
+	next := a.config.MaximumEventAge
+
+	a.mu.Lock()
+	queue := a.queue[:0]
+	for _, event := range a.queue {
+		age := time.Since(event.ReceivedAt)
+		if age > a.config.MaximumEventAge {
+			expired = append(expired, event)
+			continue
+		}
+		queue = append(queue, event)
+		if remaining := a.config.MaximumEventAge - age; remaining < next {
+			next = remaining
+		}
+	}
+	for i := len(queue); i < len(a.queue); i++ {
+		a.queue[i] = nil
+	}
+	a.queue = queue
+	a.mu.Unlock()
+
+	for _, event := range expired {
+		a.discard(ctx, event, DestinationConditionEventAgeExceeded)
+	}
+
+	// the event is past its maximum age once the timer fires
+	return time.NewTimer(next + time.Millisecond)
+}
+
+// acquire takes one of the function's reserved concurrency for an event, if it is reserved.
+func (a *AsyncInvoker) acquire() bool {
+	return a.config.Concurrency == nil || a.config.Concurrency.acquire(a.functionName)
+}
+
+func (a *AsyncInvoker) release() {
+	if a.config.Concurrency != nil {
+		a.config.Concurrency.release(a.functionName)
+	}
+}
+
+// waitRelease returns a channel closed once any invoker releases reserved concurrency, nil when the
+// concurrency of the function is not reserved.
+func (a *AsyncInvoker) waitRelease() <-chan struct{} {
+	if a.config.Concurrency == nil {
+		return nil
+	}
+	return a.config.Concurrency.waitRelease()
+}
+
+// shutdown drops the events which will not be invoked since the invoker stopped.
+func (a *AsyncInvoker) shutdown() {
+	a.mu.Lock()
+	events := a.queue
+	a.queue = nil
+	for event, timer := range a.delayed {
+		// an event whose timer already fired is discarded by the timer
+		if timer.Stop() {
+			delete(a.delayed, event)
+			events = append(events, event)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, event := range events {
+		a.discardStopped(event)
+	}
+}
+
+// discardStopped drops an event of the stopped invoker. It did not run out of retries or age, so
+// unlike discard, it is not reported to the on-failure destination.
+func (a *AsyncInvoker) discardStopped(event *AsyncEvent) {
+	fields := []zap.Field{
+		zap.String("request.id", event.RequestID),
+		zap.Int("attempts", event.Attempts),
+		zap.Duration("event.age", time.Since(event.ReceivedAt)),
+	}
+	if event.Err != nil {
+		fields = append(fields, LambdaErrorFields(event.Err)...)
+	}
+	zap.L().Warn("dropping asynchronous lambda invocation of stopped invoker", fields...)
+
+	a.complete(event)
+}
+
+func (a *AsyncInvoker) push(event *AsyncEvent) {
+	a.mu.Lock()
+	a.queue = append(a.queue, event)
+	a.mu.Unlock()
+
+	a.signal()
+}
+
+func (a *AsyncInvoker) signal() {
+	select {
+	case a.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (a *AsyncInvoker) pop() *AsyncEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.queue) == 0 {
+		return nil
+	}
+
+	event := a.queue[0]
+	a.queue[0] = nil
+	a.queue = a.queue[1:]
+	return event
+}
+
+func (a *AsyncInvoker) complete(*AsyncEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.depth--
+	if a.depth == 0 {
+		close(a.idle)
+	}
+}
+
+func (a *AsyncInvoker) retry(ctx context.Context, event *AsyncEvent, delay time.Duration) {
+	if ctx.Err() != nil {
+		a.discardStopped(event)
+		return
+	}
+
+	zap.L().Warn("retrying asynchronous lambda invocation",
+		append(LambdaErrorFields(event.Err),
+			zap.String("request.id", event.RequestID),
+			zap.Int("attempts", event.Attempts),
+			zap.Duration("retry.delay", delay),
+		)...,
+	)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.delayed[event] = time.AfterFunc(delay, func() {
+		a.mu.Lock()
+		_, delayed := a.delayed[event]
+		delete(a.delayed, event)
+		a.mu.Unlock()
+
+		switch {
+		case !delayed:
+			// dropped by the shutdown of the invoker
+		case ctx.Err() != nil:
+			a.discardStopped(event)
+		default:
+			a.push(event)
+		}
+	})
+}
+
+func (a *AsyncInvoker) discard(ctx context.Context, event *AsyncEvent, condition DestinationCondition) {
+	fields := []zap.Field{
+		zap.String("request.id", event.RequestID),
+		zap.String("condition", string(condition)),
+		zap.Int("attempts", event.Attempts),
+		zap.Duration("event.age", time.Since(event.ReceivedAt)),
+	}
+	if event.Err != nil {
+		fields = append(fields, LambdaErrorFields(event.Err)...)
+	}
+	zap.L().Error("discarding asynchronous lambda invocation", fields...)
+
+	a.sendRecord(ctx, a.config.OnFailure, event, condition)
+	a.complete(event)
+}
+
+func (a *AsyncInvoker) sendRecord(
+	ctx context.Context,
+	destination Destination,
+	event *AsyncEvent,
+	condition DestinationCondition,
+) {
+	if destination == nil {
+		return
+	}
+
+	record := NewDestinationRecord(a.config.FunctionArn, event, condition)
+	if err := destination.Send(ctx, record); err != nil {
+		zap.L().Error("failed to send asynchronous invocation record to destination",
+			zap.String("request.id", event.RequestID),
+			zap.String("condition", string(condition)),
+			zap.Error(err),
+		)
+	}
+}
+
+func (a *AsyncInvoker) process(ctx context.Context, event *AsyncEvent) {
+	if time.Since(event.ReceivedAt) > a.config.MaximumEventAge {
+		a.discard(ctx, event, DestinationConditionEventAgeExceeded)
+		return
+	}
+
+	invokeCtx := WithTraceID(ctx, event.TraceID)
+	if a.config.Concurrency != nil {
+		invokeCtx = withAcquiredConcurrency(invokeCtx, a.config.Concurrency, a.functionName)
+	}
+	if event.clientContext != nil {
+		invokeCtx = WithClientContext(invokeCtx, event.clientContext)
+	}
+
+	result, err := a.invoker.Invoke(invokeCtx, event.Payload)
+	event.Result, event.Err = result, err
+
+	var fnErr *FunctionError
+	var svcErr *ServiceError
+	switch {
+	case err == nil:
+		event.Attempts++
+		zap.L().Info("asynchronous lambda invocation succeeded",
+			zap.String("request.id", event.RequestID),
+			zap.Int("attempts", event.Attempts),
+		)
+		a.sendRecord(ctx, a.config.OnSuccess, event, DestinationConditionSuccess)
+		a.complete(event)
+	case ctx.Err() != nil:
+		a.discardStopped(event)
+	case errors.As(err, &fnErr):
+		event.Attempts++
+		if event.retries >= a.config.MaximumRetryAttempts {
+			a.discard(ctx, event, DestinationConditionRetriesExhausted)
+			return
+		}
+		delay := a.config.RetryDelay << event.retries
+		event.retries++
+		a.retry(ctx, event, delay)
+	case errors.As(err, &svcErr) &&
+		svcErr.StatusCode != http.StatusTooManyRequests &&
+		svcErr.StatusCode < http.StatusInternalServerError:
+		// the invocation can never succeed, so there is nothing to retry
+		a.discard(ctx, event, DestinationConditionRetriesExhausted)
+	default:
+		// throttles and system errors are retried with backoff until the event expires
+		delay := asyncThrottleDelay(event.throttles)
+		event.throttles++
+		a.retry(ctx, event, delay)
+	}
+}
+
+// asyncThrottleDelay is the delay before retrying an event which was throttled the given number of
+// times, doubled from a second for every throttle up to 5 minutes.
+func asyncThrottleDelay(throttles int) time.Duration {
+	delay := asyncThrottleBaseDelay << throttles
+	if delay <= 0 || delay > asyncThrottleMaxDelay {
+		return asyncThrottleMaxDelay
+	}
+	return delay
+}
+
+// AsyncInvokerConfigFromCLI builds the asynchronous invocation configuration of the function,
+// including its destinations when LambdaDestinationFlags are set.
+func AsyncInvokerConfigFromCLI(cliCtx *cli.Context, functionName string) (AsyncInvokerConfig, error) {
+	config, err := asyncInvokerConfigFromCLI(cliCtx, DestinationFromCLI)
+	if err != nil {
+		return config, err
+	}
+
+	// the events draw from the reserved concurrency the synchronous invokers of the function use
+	concurrency, funcName := reservedConcurrencyFromCLI(cliCtx, functionName)
+	config.FunctionArn = LambdaFunctionArn(cliCtx.String(AwsRegionName), funcName)
+	config.Concurrency = concurrency
+	if _, qualifier := qualifiedFunctionFromCLI(cliCtx, functionName); qualifier != "" {
+		config.FunctionArn = fmt.Sprintf("%s:%s", config.FunctionArn, qualifier)
+	}
+
+	return config, nil
+}
+
+// asyncInvokerConfigFromCLI builds the configuration shared by the asynchronous invocations of every
+// function, configured by LambdaAsyncFlags and LambdaDestinationFlags, with the destinations built
+// by newDestination.
+func asyncInvokerConfigFromCLI(
+	cliCtx *cli.Context,
+	newDestination func(cliCtx *cli.Context, name string) (Destination, error),
+) (AsyncInvokerConfig, error) {
+	config := AsyncInvokerConfig{
+		MaximumRetryAttempts: cliCtx.Int(AsyncMaximumRetryAttemptsName),
+		MaximumEventAge:      cliCtx.Duration(AsyncMaximumEventAgeName),
+		RetryDelay:           cliCtx.Duration(AsyncRetryDelayName),
+	}
+	if err := config.Validate(); err != nil {
+		return config, err
+	}
+
+	var err error
+	if config.OnSuccess, err = newDestination(cliCtx, OnSuccessDestinationName); err != nil {
+		return config, fmt.Errorf("invalid on-success destination: %w", err)
+	}
+	if config.OnFailure, err = newDestination(cliCtx, OnFailureDestinationName); err != nil {
+		return config, fmt.Errorf("invalid on-failure destination: %w", err)
+	}
+
+	return config, nil
+}
+
+func LambdaAsyncFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    AsyncMaximumRetryAttemptsName,
+			EnvVars: []string{EnvVarAsyncMaximumRetryAttempts},
+			Value:   maxAsyncRetryAttempts,
+			Usage:   "Times to retry an asynchronous invocation when the function returns an error, 0 to 2",
+		},
+		&cli.DurationFlag{
+			Name:    AsyncMaximumEventAgeName,
+			EnvVars: []string{EnvVarAsyncMaximumEventAge},
+			Value:   maxAsyncEventAge,
+			Usage:   "Maximum age of an asynchronous invocation before it is discarded, from 1m to 6h",
+		},
+		&cli.DurationFlag{
+			Name:    AsyncRetryDelayName,
+			EnvVars: []string{EnvVarAsyncRetryDelay},
+			Value:   defaultAsyncRetryDelay,
+			Usage:   "Delay before the first retry of a failed asynchronous invocation, doubled for each retry",
+		},
+	}
+}
@@ -0,0 +1,250 @@
+package offline
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseInvocationType(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    InvocationType
+		wantErr bool
+	}{
+		{value: "", want: InvocationTypeRequestResponse},
+		{value: "RequestResponse", want: InvocationTypeRequestResponse},
+		{value: "Event", want: InvocationTypeEvent},
+		{value: "DryRun", want: InvocationTypeDryRun},
+		{value: "event", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseInvocationType(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInvocationType(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseInvocationType(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncInvokerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AsyncInvokerConfig
+		wantErr bool
+	}{
+		{name: "bounds", config: AsyncInvokerConfig{MaximumRetryAttempts: 2, MaximumEventAge: 6 * time.Hour, RetryDelay: time.Minute}},
+		{name: "minimums", config: AsyncInvokerConfig{MaximumEventAge: time.Minute}},
+		{name: "negative retry attempts", config: AsyncInvokerConfig{MaximumRetryAttempts: -1, MaximumEventAge: time.Hour}, wantErr: true},
+		{name: "too many retry attempts", config: AsyncInvokerConfig{MaximumRetryAttempts: 3, MaximumEventAge: time.Hour}, wantErr: true},
+		{name: "no event age", config: AsyncInvokerConfig{}, wantErr: true},
+		{name: "event age below a minute", config: AsyncInvokerConfig{MaximumEventAge: 59 * time.Second}, wantErr: true},
+		{name: "event age above 6 hours", config: AsyncInvokerConfig{MaximumEventAge: 7 * time.Hour}, wantErr: true},
+		{name: "negative retry delay", config: AsyncInvokerConfig{MaximumEventAge: time.Hour, RetryDelay: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAsyncThrottleDelay(t *testing.T) {
+	tests := []struct {
+		throttles int
+		want      time.Duration
+	}{
+		{throttles: 0, want: time.Second},
+		{throttles: 1, want: 2 * time.Second},
+		{throttles: 8, want: 256 * time.Second},
+		{throttles: 9, want: 5 * time.Minute},
+		{throttles: 100, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := asyncThrottleDelay(tt.throttles); got != tt.want {
+			t.Errorf("asyncThrottleDelay(%d) = %s, want %s", tt.throttles, got, tt.want)
+		}
+	}
+}
+
+// scriptedInvoker fails the invocations of an asynchronous invoker with the scripted errors in
+// order, then succeeds, recording the time of every invocation.
+type scriptedInvoker struct {
+	mu          sync.Mutex
+	errs        []error
+	invocations []time.Time
+}
+
+func (i *scriptedInvoker) Invoke(context.Context, []byte) (*InvokeResult, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.invocations = append(i.invocations, time.Now())
+	if len(i.errs) == 0 {
+		return &InvokeResult{StatusCode: http.StatusOK, Payload: []byte(`"ok"`)}, nil
+	}
+	err := i.errs[0]
+	i.errs = i.errs[1:]
+	return &InvokeResult{StatusCode: http.StatusOK}, err
+}
+
+func (i *scriptedInvoker) times() []time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]time.Time(nil), i.invocations...)
+}
+
+func newTestFunctionError() error {
+	return &FunctionError{ErrorPayload: ErrorPayload{ErrorMessage: "boom"}, Kind: FunctionErrorHandled}
+}
+
+// invokeAsync queues an event with a running asynchronous invoker and waits for it to complete.
+func invokeAsync(t *testing.T, invoker Invoker, config AsyncInvokerConfig) *AsyncInvoker {
+	t.Helper()
+
+	asyncInvoker := NewAsyncInvoker(invoker, config)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go asyncInvoker.Run(ctx)
+
+	result, err := asyncInvoker.Invoke(ctx, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StatusCode != http.StatusAccepted || result.RequestID == "" {
+		t.Errorf("Invoke() = %d %q, want 202 with a request ID", result.StatusCode, result.RequestID)
+	}
+	if err := asyncInvoker.Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	return asyncInvoker
+}
+
+func TestAsyncInvokerRetries(t *testing.T) {
+	const retryDelay = 20 * time.Millisecond
+
+	tests := []struct {
+		name            string
+		retryAttempts   int
+		errs            []error
+		wantInvocations int
+	}{
+		{name: "success", retryAttempts: 2, wantInvocations: 1},
+		{name: "retried function error", retryAttempts: 2, errs: []error{newTestFunctionError()}, wantInvocations: 2},
+		{
+			name:            "retries exhausted",
+			retryAttempts:   2,
+			errs:            []error{newTestFunctionError(), newTestFunctionError(), newTestFunctionError(), newTestFunctionError()},
+			wantInvocations: 3,
+		},
+		{name: "no retries", retryAttempts: 0, errs: []error{newTestFunctionError()}, wantInvocations: 1},
+		{
+			name:            "rejected invocation",
+			retryAttempts:   2,
+			errs:            []error{&ServiceError{StatusCode: http.StatusNotFound, Code: "ResourceNotFoundException"}},
+			wantInvocations: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := &scriptedInvoker{errs: tt.errs}
+			asyncInvoker := invokeAsync(t, invoker, AsyncInvokerConfig{
+				MaximumRetryAttempts: tt.retryAttempts,
+				MaximumEventAge:      time.Minute,
+				RetryDelay:           retryDelay,
+			})
+
+			times := invoker.times()
+			if len(times) != tt.wantInvocations {
+				t.Fatalf("function invoked %d times, want %d", len(times), tt.wantInvocations)
+			}
+			// the retry delay doubles after every retry
+			for i := 1; i < len(times); i++ {
+				if delay, want := times[i].Sub(times[i-1]), retryDelay<<(i-1); delay < want {
+					t.Errorf("retry %d after %s, want at least %s", i, delay, want)
+				}
+			}
+			if depth := asyncInvoker.QueueDepth(); depth != 0 {
+				t.Errorf("QueueDepth() = %d, want 0", depth)
+			}
+		})
+	}
+}
+
+func TestAsyncInvokerThrottle(t *testing.T) {
+	invoker := &scriptedInvoker{errs: []error{
+		&ServiceError{StatusCode: http.StatusTooManyRequests, Code: ErrorCodeTooManyRequests},
+	}}
+	invokeAsync(t, invoker, AsyncInvokerConfig{MaximumEventAge: time.Minute})
+
+	times := invoker.times()
+	if len(times) != 2 {
+		t.Fatalf("function invoked %d times, want 2", len(times))
+	}
+	if delay := times[1].Sub(times[0]); delay < asyncThrottleBaseDelay {
+		t.Errorf("throttled event retried after %s, want at least %s", delay, asyncThrottleBaseDelay)
+	}
+}
+
+func TestAsyncInvokerEventAge(t *testing.T) {
+	// the event expires before the retry of the function error
+	invoker := &scriptedInvoker{errs: []error{newTestFunctionError()}}
+	invokeAsync(t, invoker, AsyncInvokerConfig{
+		MaximumRetryAttempts: 2,
+		MaximumEventAge:      10 * time.Millisecond,
+		RetryDelay:           20 * time.Millisecond,
+	})
+
+	if invocations := len(invoker.times()); invocations != 1 {
+		t.Errorf("function invoked %d times, want 1", invocations)
+	}
+}
+
+func TestAsyncInvokerShutdown(t *testing.T) {
+	invoker := &scriptedInvoker{errs: []error{newTestFunctionError()}}
+	asyncInvoker := NewAsyncInvoker(invoker, AsyncInvokerConfig{
+		MaximumRetryAttempts: 2,
+		MaximumEventAge:      time.Hour,
+		RetryDelay:           time.Hour,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		asyncInvoker.Run(ctx)
+	}()
+
+	if _, err := asyncInvoker.Invoke(ctx, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	// stop the invoker while the event waits for its retry
+	for len(invoker.times()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	// the delayed event is discarded rather than waiting for its retry
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := asyncInvoker.Wait(waitCtx); err != nil {
+		t.Fatalf("Wait() error = %v, want the event discarded", err)
+	}
+	if invocations := len(invoker.times()); invocations != 1 {
+		t.Errorf("function invoked %d times, want 1", invocations)
+	}
+}
@@ -3,29 +3,275 @@ package offline
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/hashicorp/go-cleanhttp"
 	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
 )
 
-func LambdaInvoke(ctx context.Context, invokeEndpoint string, payload []byte) ([]byte, error) {
-	httpClient := cleanhttp.DefaultClient()
+const (
+	HeaderFunctionError   = "X-Amz-Function-Error"
+	HeaderExecutedVersion = "X-Amz-Executed-Version"
+	HeaderErrorType       = "X-Amzn-ErrorType"
+	HeaderRequestID       = "X-Amzn-RequestId"
+)
+
+// FunctionErrorKind is the value of the X-Amz-Function-Error header returned by lambda.
+type FunctionErrorKind string
+
+const (
+	// FunctionErrorHandled is reported when the function returned an error from its handler.
+	FunctionErrorHandled FunctionErrorKind = "Handled"
+	// FunctionErrorUnhandled is reported when the runtime failed, i.e. a panic, crash or timeout.
+	FunctionErrorUnhandled FunctionErrorKind = "Unhandled"
+)
+
+// ErrorTypeTimedOut is the error type reported when a function exceeds its timeout.
+const ErrorTypeTimedOut = "Sandbox.Timedout"
+
+// InvokeResult is the outcome of a lambda invocation as reported by the lambda endpoint.
+type InvokeResult struct {
+	// HTTP status code returned by the lambda endpoint
+	StatusCode int
+	// ID of the invocation request, if reported by the lambda endpoint
+	RequestID string
+	// Kind of function error reported by the runtime, empty when the function succeeded
+	FunctionError FunctionErrorKind
+	// Version of the function that was executed, i.e. $LATEST
+	ExecutedVersion string
+	// Decoded tail of the invocation logs, when requested with LogTypeTail
+	LogResult string
+	// Response payload of the function, or the error payload when the invocation failed
+	Payload []byte
+}
+
+// ErrorPayload is the error document returned by lambda runtimes when a function fails.
+type ErrorPayload struct {
+	ErrorType    string   `json:"errorType,omitempty"`
+	ErrorMessage string   `json:"errorMessage,omitempty"`
+	StackTrace   []string `json:"stackTrace,omitempty"`
+}
+
+func (p *ErrorPayload) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ErrorType    string            `json:"errorType"`
+		ErrorMessage string            `json:"errorMessage"`
+		StackTrace   []json.RawMessage `json:"stackTrace"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.ErrorType = raw.ErrorType
+	p.ErrorMessage = raw.ErrorMessage
+	p.StackTrace = nil
+	for _, frame := range raw.StackTrace {
+		// most runtimes send plain strings, while the go runtime sends structured frames
+		var line string
+		if err := json.Unmarshal(frame, &line); err == nil {
+			p.StackTrace = append(p.StackTrace, line)
+			continue
+		}
+
+		var goFrame struct {
+			Path  string `json:"path"`
+			Line  int32  `json:"line"`
+			Label string `json:"label"`
+		}
+		if err := json.Unmarshal(frame, &goFrame); err != nil {
+			return fmt.Errorf("failed to parse stack frame: %w", err)
+		}
+		p.StackTrace = append(p.StackTrace, fmt.Sprintf("%s:%d %s", goFrame.Path, goFrame.Line, goFrame.Label))
+	}
+
+	return nil
+}
+
+// FunctionError is returned when the invoked function reported an error, either by returning one
+// from its handler (Handled) or by crashing or timing out (Unhandled).
+type FunctionError struct {
+	ErrorPayload
+	// Kind of function error reported by the runtime
+	Kind FunctionErrorKind
+	// Result of the failed invocation
+	Result *InvokeResult
+}
+
+// Timeout reports whether the function was stopped for exceeding its timeout.
+func (e *FunctionError) Timeout() bool {
+	return e.ErrorType == ErrorTypeTimedOut
+}
+
+func (e *FunctionError) Error() string {
+	if e.ErrorType == "" {
+		return fmt.Sprintf("lambda function error (%s): %s", e.Kind, e.ErrorMessage)
+	}
+
+	return fmt.Sprintf("lambda function error (%s): %s: %s", e.Kind, e.ErrorType, e.ErrorMessage)
+}
+
+// ServiceError is returned when the lambda endpoint rejected the invocation before or instead of
+// running the function, i.e. an unknown function name or a throttle.
+type ServiceError struct {
+	// HTTP status code returned by the lambda endpoint
+	StatusCode int
+	// Error code, i.e. ResourceNotFoundException
+	Code string
+	// Error message returned by the lambda endpoint
+	Message string
+	// Result of the failed invocation
+	Result *InvokeResult
+}
+
+// Throttled reports whether the invocation was rejected for exceeding the function's concurrency.
+func (e *ServiceError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.Code == ErrorCodeTooManyRequests
+}
+
+func (e *ServiceError) Error() string {
+	return fmt.Sprintf("lambda service error (%d): %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func newServiceError(resp *http.Response, result *InvokeResult) *ServiceError {
+	var body struct {
+		Code         string `json:"code"`
+		UpperCode    string `json:"Code"`
+		Type         string `json:"__type"`
+		Message      string `json:"message"`
+		UpperMessage string `json:"Message"`
+	}
+	_ = json.Unmarshal(result.Payload, &body)
+
+	svcErr := &ServiceError{
+		StatusCode: resp.StatusCode,
+		Result:     result,
+	}
+
+	// the error type header may be suffixed with extra context, i.e. ResourceNotFoundException:http://...
+	if code, _, _ := strings.Cut(resp.Header.Get(HeaderErrorType), ":"); code != "" {
+		svcErr.Code = code
+	}
+	for _, code := range []string{body.Code, body.UpperCode, body.Type} {
+		if svcErr.Code == "" {
+			svcErr.Code = code
+		}
+	}
+	if svcErr.Code == "" {
+		svcErr.Code = http.StatusText(resp.StatusCode)
+	}
+
+	svcErr.Message = body.Message
+	if svcErr.Message == "" {
+		svcErr.Message = body.UpperMessage
+	}
+	if svcErr.Message == "" {
+		svcErr.Message = strings.TrimSpace(string(result.Payload))
+	}
+
+	return svcErr
+}
+
+// Invoker invokes a lambda function.
+//
+// When the function or the lambda endpoint reports a failure, the result is returned alongside a
+// *FunctionError or *ServiceError so that callers can inspect the response.
+type Invoker interface {
+	Invoke(ctx context.Context, payload []byte) (*InvokeResult, error)
+}
+
+// InvokeFunc is an adapter to allow the use of ordinary functions as invokers.
+type InvokeFunc func(ctx context.Context, payload []byte) (*InvokeResult, error)
+
+func (f InvokeFunc) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	return f(ctx, payload)
+}
+
+// lambdaHTTPClient is shared by all HTTP invokers so that connections to the lambda endpoints are
+// reused across invocations.
+var lambdaHTTPClient = cleanhttp.DefaultPooledClient()
+
+// errTaskTimedOut is the cause of the context cancellation when a function exceeds its timeout.
+var errTaskTimedOut = errors.New("task timed out")
+
+// HTTPInvoker synchronously invokes the lambda function served at an invoke endpoint, i.e. by the
+// lambda runtime interface emulator.
+type HTTPInvoker struct {
+	// Endpoint to invoke the lambda function
+	Endpoint string
+	// Maximum duration of an invocation, no timeout is enforced when zero
+	Timeout time.Duration
+	// Whether to request the tail of the invocation logs
+	LogType LogType
+	// Signs invocation requests when set
+	Signer *RequestSigner
 
+	client *http.Client
+}
+
+func NewHTTPInvoker(invokeEndpoint string, timeout time.Duration) *HTTPInvoker {
+	return &HTTPInvoker{
+		Endpoint: invokeEndpoint,
+		Timeout:  timeout,
+		client:   lambdaHTTPClient,
+	}
+}
+
+// LambdaInvoke synchronously invokes the lambda function at the given endpoint without a timeout.
+func LambdaInvoke(ctx context.Context, invokeEndpoint string, payload []byte) (*InvokeResult, error) {
+	return NewHTTPInvoker(invokeEndpoint, 0).Invoke(ctx, payload)
+}
+
+func (i *HTTPInvoker) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	if i.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, i.Timeout, errTaskTimedOut)
+		defer cancel()
+	}
+
+	result, err := i.invoke(ctx, payload)
+	if err != nil && errors.Is(context.Cause(ctx), errTaskTimedOut) {
+		return newTimeoutResult(i.Timeout)
+	}
+
+	return result, err
+}
+
+func (i *HTTPInvoker) invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
-		invokeEndpoint,
+		i.Endpoint,
 		io.NopCloser(bytes.NewReader(payload)),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build lambda invocation request: %w", err)
 	}
+	invocationType := InvocationTypeRequestResponse
+	if DryRunFromContext(ctx) {
+		invocationType = InvocationTypeDryRun
+	}
+	req.Header.Set(HeaderInvocationType, string(invocationType))
+	if i.LogType != "" {
+		req.Header.Set(HeaderLogType, string(i.LogType))
+	}
+	if err := setInvokeContextHeaders(ctx, req.Header); err != nil {
+		return nil, err
+	}
+	if i.Signer != nil {
+		if err := i.Signer.Sign(ctx, req, payload); err != nil {
+			return nil, err
+		}
+	}
 
-	resp, err := httpClient.Do(req)
+	resp, err := i.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to invoke lambda: %w", err)
 	}
@@ -37,14 +283,52 @@ func LambdaInvoke(ctx context.Context, invokeEndpoint string, payload []byte) ([
 		return nil, fmt.Errorf("failed to read lambda response: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	result := &InvokeResult{
+		StatusCode:      resp.StatusCode,
+		RequestID:       resp.Header.Get(HeaderRequestID),
+		FunctionError:   FunctionErrorKind(resp.Header.Get(HeaderFunctionError)),
+		ExecutedVersion: resp.Header.Get(HeaderExecutedVersion),
+		Payload:         buf.Bytes(),
+	}
+
+	// the log tail is informational, so a malformed one does not fail the invocation
+	if result.LogResult, err = decodeLogResult(resp.Header.Get(HeaderLogResult)); err != nil {
+		zap.L().Warn("ignoring invalid log result of lambda invocation",
+			zap.String("request.id", result.RequestID),
+			zap.Error(err),
+		)
+	}
+
+	if result.FunctionError != "" {
+		fnErr := &FunctionError{
+			Kind:   result.FunctionError,
+			Result: result,
+		}
+		if err := json.Unmarshal(result.Payload, &fnErr.ErrorPayload); err != nil {
+			fnErr.ErrorMessage = strings.TrimSpace(string(result.Payload))
+		}
+		return result, fnErr
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return result, newServiceError(resp, result)
+	}
+
+	return result, nil
 }
 
+// defaultLambdaTimeout matches the default timeout of the lambda runtime interface emulator.
+const defaultLambdaTimeout = 300 * time.Second
+
 const (
 	LambdaEndpointName         = "lambda-endpoint"
+	LambdaTimeoutName          = "lambda-timeout"
+	LambdaLogTypeName          = "lambda-log-type"
 	InvokeEndpointNamePrefix   = "invoke-endpoint"
 	FunctionNamePrefix         = "function"
 	EnvVarLambdaEndpoint       = "LAMBDA_ENDPOINT"
+	EnvVarLambdaTimeout        = "LAMBDA_TIMEOUT"
+	EnvVarLambdaLogType        = "LAMBDA_LOG_TYPE"
 	EnvVarFunctionNamePrefix   = "LAMBDA_FUNCTION"
 	EnvVarInvokeEndpointPrefix = "LAMBDA_INVOKE_ENDPOINT"
 )
@@ -81,27 +365,161 @@ func EnvVarFunctionNameForFunction(functionName string) string {
 	return fmt.Sprintf("%s_%s", EnvVarFunctionNamePrefix, strings.ToUpper(functionName))
 }
 
-func LambdaInvokeFromCLI(cliCtx *cli.Context, functionName string, payload []byte) ([]byte, error) {
-	invokeEndpoint := cliCtx.String(InvokeEndpointNameForFunction(functionName))
+// SplitFunctionName splits a function name, qualified name (name:alias) or ARN into the name of the
+// function and its qualifier.
+func SplitFunctionName(nameOrArn string) (string, string) {
+	if strings.HasPrefix(nameOrArn, "arn:") {
+		// arn:aws:lambda:region:account:function:name[:qualifier]
+		parts := strings.Split(nameOrArn, ":")
+		if len(parts) < 7 {
+			return nameOrArn, ""
+		}
+		if len(parts) > 7 {
+			return parts[6], parts[7]
+		}
+		return parts[6], ""
+	}
+
+	name, qualifier, _ := strings.Cut(nameOrArn, ":")
+	return name, qualifier
+}
+
+// InvokerFromCLI builds an invoker for the function configured by LambdaInvokeFlags, throttled by
+// the reserved concurrency configured by LambdaConcurrencyFlags. When the qualifier is an alias with
+// routes configured by the aliases flag, invocations are shifted between the routes by weight.
+// Functions registered by LambdaRegistryFlags are invoked at their upstream with their timeout.
+func InvokerFromCLI(cliCtx *cli.Context, functionName string) (Invoker, error) {
+	funcName, qualifier := qualifiedFunctionFromCLI(cliCtx, functionName)
+	invoker, err := functionInvokerFromCLI(
+		cliCtx, funcName, qualifier, cliCtx.String(InvokeEndpointNameForFunction(functionName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter, limitedName := reservedConcurrencyFromCLI(cliCtx, functionName)
+	return limiter.Limit(limitedName, invoker), nil
+}
+
+// qualifiedFunctionFromCLI returns the name of the function configured by LambdaInvokeFlags and the
+// version or alias it is invoked with, if any.
+func qualifiedFunctionFromCLI(cliCtx *cli.Context, functionName string) (string, string) {
+	qualifier := cliCtx.String(QualifierNameForFunction(functionName))
+	// qualified function names and ARNs, i.e. name:alias, behave like the qualifier flag
+	funcName, nameQualifier := SplitFunctionName(cliCtx.String(FunctionNameForFunction(functionName)))
+	if qualifier == "" {
+		qualifier = nameQualifier
+	}
+
+	return funcName, qualifier
+}
+
+// FunctionInvokerFromCLI builds an invoker for a function by its name, qualified name or ARN rather
+// than by the flags of LambdaInvokeFlags, i.e. for functions declared by other configuration. Like
+// InvokerFromCLI, it honours the aliases and registry flags, the lambda endpoint and the reserved
+// concurrency of the function.
+func FunctionInvokerFromCLI(cliCtx *cli.Context, nameOrArn string) (Invoker, error) {
+	funcName, qualifier := SplitFunctionName(nameOrArn)
+	invoker, err := functionInvokerFromCLI(cliCtx, funcName, qualifier, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return ConcurrencyLimiterFromCLI(cliCtx).Limit(funcName, invoker), nil
+}
+
+// functionInvokerFromCLI builds an invoker for the function at the invoke endpoint, or at the
+// endpoint of its aliases, registry entry or the lambda endpoint when empty.
+func functionInvokerFromCLI(cliCtx *cli.Context, funcName, qualifier, invokeEndpoint string) (Invoker, error) {
+	registry, err := FunctionRegistryFromCLI(cliCtx)
+	if err != nil {
+		return nil, err
+	}
+	definition, registered := registry.Lookup(funcName)
+
+	newInvoker := func(invokeEndpoint string) Invoker {
+		httpInvoker := httpInvokerFromCLI(cliCtx, invokeEndpoint)
+		// the timeout of a registered function applies when it declares one, unless the timeout flag is set
+		if registered && definition.Timeout > 0 && !cliCtx.IsSet(LambdaTimeoutName) {
+			httpInvoker.Timeout = definition.Timeout
+		}
+		return httpInvoker
+	}
+
+	invoker, err := aliasInvokerFromCLI(cliCtx, funcName, qualifier, newInvoker)
+	if err != nil {
+		return nil, err
+	}
+	if invoker != nil {
+		return invoker, nil
+	}
+
+	if invokeEndpoint == "" && registered && definition.Upstream != "" {
+		invokeEndpoint = definition.InvokeEndpoint()
+	}
 	if invokeEndpoint == "" {
-		base := cliCtx.String(LambdaEndpointName)
-		base = strings.TrimSuffix(base, "/")
-		funcName := cliCtx.String(FunctionNameForFunction(functionName))
-		funcName = strings.TrimSuffix(strings.TrimPrefix(funcName, "/"), "/")
-		invokeEndpoint = fmt.Sprintf("%s/2015-03-31/functions/%s/invocations", base, funcName)
+		invokeEndpoint = lambdaInvokeEndpoint(cliCtx.String(LambdaEndpointName), funcName)
+	}
+	if invokeEndpoint, err = withQualifier(invokeEndpoint, qualifier); err != nil {
+		return nil, err
+	}
+
+	return newInvoker(invokeEndpoint), nil
+}
+
+// httpInvokerFromCLI builds an invoker for the endpoint with the options configured by LambdaFlags.
+func httpInvokerFromCLI(cliCtx *cli.Context, invokeEndpoint string) *HTTPInvoker {
+	httpInvoker := NewHTTPInvoker(invokeEndpoint, cliCtx.Duration(LambdaTimeoutName))
+	httpInvoker.LogType = LogType(cliCtx.String(LambdaLogTypeName))
+	httpInvoker.Signer = RequestSignerFromCLI(cliCtx)
+	return httpInvoker
+}
+
+func LambdaInvokeFromCLI(cliCtx *cli.Context, functionName string, payload []byte) (*InvokeResult, error) {
+	invoker, err := InvokerFromCLI(cliCtx, functionName)
+	if err != nil {
+		return nil, err
 	}
 
-	return LambdaInvoke(cliCtx.Context, invokeEndpoint, payload)
+	return invoker.Invoke(cliCtx.Context, payload)
+}
+
+func lambdaInvokeEndpoint(base, funcName string) string {
+	base = strings.TrimSuffix(base, "/")
+	funcName = strings.TrimSuffix(strings.TrimPrefix(funcName, "/"), "/")
+	return fmt.Sprintf("%s/2015-03-31/functions/%s/invocations", base, funcName)
 }
 
 func LambdaFlags() []cli.Flag {
-	return []cli.Flag{
+	flags := []cli.Flag{
 		&cli.StringFlag{
 			Name:    LambdaEndpointName,
 			EnvVars: []string{EnvVarLambdaEndpoint},
 			Usage:   "Endpoint to invoke lambda functions. i.e. http://localhost:8080",
 		},
+		&cli.DurationFlag{
+			Name:    LambdaTimeoutName,
+			EnvVars: []string{EnvVarLambdaTimeout},
+			Value:   defaultLambdaTimeout,
+			Usage:   "Maximum duration of a lambda invocation before it fails with a timeout, 0 to disable",
+		},
+		&cli.StringFlag{
+			Name:    LambdaLogTypeName,
+			EnvVars: []string{EnvVarLambdaLogType},
+			Value:   string(LogTypeNone),
+			Usage:   "Set to Tail to include the last 4 KB of the invocation logs in the result",
+		},
+		&cli.GenericFlag{
+			Name:    LambdaAliasesName,
+			EnvVars: []string{EnvVarLambdaAliases},
+			Value:   &DefinitionsValue{},
+			Usage: "Weighted routes of function aliases to the endpoints of their versions, separated by newlines in the " +
+				"environment. i.e. function=name;alias=live;version=2;weight=10;endpoint=http://name-v2:8080/2015-03-31/functions/function/invocations",
+		},
 	}
+
+	flags = append(flags, LambdaRegistryFlags()...)
+	return append(flags, LambdaSigningFlags()...)
 }
 
 func LambdaInvokeFlags(functionName string) []cli.Flag {
@@ -118,5 +536,65 @@ func LambdaInvokeFlags(functionName string) []cli.Flag {
 			Value:   "function",
 			Usage:   "Name of the lambda function to invoke",
 		},
+		&cli.StringFlag{
+			Name:    QualifierNameForFunction(functionName),
+			EnvVars: []string{EnvVarQualifierForFunction(functionName)},
+			Usage:   "Version or alias of the lambda function to invoke",
+		},
+	}
+}
+
+// newTimeoutResult reports a timed out invocation the way lambda does, as an unhandled error.
+func newTimeoutResult(timeout time.Duration) (*InvokeResult, error) {
+	requestID := uuid.New().String()
+	fnErr := &FunctionError{
+		ErrorPayload: ErrorPayload{
+			ErrorType: ErrorTypeTimedOut,
+			ErrorMessage: fmt.Sprintf(
+				"RequestId: %s Error: Task timed out after %.2f seconds", requestID, timeout.Seconds(),
+			),
+		},
+		Kind: FunctionErrorUnhandled,
+	}
+
+	payload, err := json.Marshal(fnErr.ErrorPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal timeout error: %w", err)
+	}
+
+	fnErr.Result = &InvokeResult{
+		StatusCode:      http.StatusOK,
+		RequestID:       requestID,
+		FunctionError:   FunctionErrorUnhandled,
+		ExecutedVersion: latestVersion,
+		Payload:         payload,
 	}
+
+	return fnErr.Result, fnErr
+}
+
+// LambdaErrorFields describes an invocation error as log fields, including the details of any
+// function or service error.
+func LambdaErrorFields(err error) []zap.Field {
+	fields := []zap.Field{zap.Error(err)}
+
+	var fnErr *FunctionError
+	if errors.As(err, &fnErr) {
+		fields = append(fields,
+			zap.String("lambda.error.kind", string(fnErr.Kind)),
+			zap.String("lambda.error.type", fnErr.ErrorType),
+			zap.String("lambda.error.message", fnErr.ErrorMessage),
+			zap.Strings("lambda.error.stack_trace", fnErr.StackTrace),
+		)
+	}
+
+	var svcErr *ServiceError
+	if errors.As(err, &svcErr) {
+		fields = append(fields,
+			zap.Int("lambda.status_code", svcErr.StatusCode),
+			zap.String("lambda.error.code", svcErr.Code),
+		)
+	}
+
+	return fields
 }
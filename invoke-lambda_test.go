@@ -0,0 +1,275 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// newTestCLIContext parses the arguments with the flags the way the commands of the emulators do.
+func newTestCLIContext(t *testing.T, flags []cli.Flag, args ...string) *cli.Context {
+	t.Helper()
+
+	var cliCtx *cli.Context
+	app := &cli.App{
+		Flags: flags,
+		Action: func(c *cli.Context) error {
+			cliCtx = c
+			return nil
+		},
+	}
+	if err := app.RunContext(context.Background(), append([]string{"test"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	return cliCtx
+}
+
+// newLambdaServer serves a single canned lambda response.
+func newLambdaServer(t *testing.T, statusCode int, header http.Header, body string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(statusCode)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestLambdaInvoke(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		body       string
+		wantFnErr  *FunctionError
+		wantSvcErr *ServiceError
+	}{
+		{
+			name:       "success",
+			statusCode: http.StatusOK,
+			header:     http.Header{HeaderExecutedVersion: {"$LATEST"}},
+			body:       `{"ok":true}`,
+		},
+		{
+			name:       "handled function error",
+			statusCode: http.StatusOK,
+			header:     http.Header{HeaderFunctionError: {"Handled"}},
+			body:       `{"errorType":"ValidationError","errorMessage":"bad input","stackTrace":["at handler (index.js:1)"]}`,
+			wantFnErr: &FunctionError{
+				ErrorPayload: ErrorPayload{
+					ErrorType:    "ValidationError",
+					ErrorMessage: "bad input",
+					StackTrace:   []string{"at handler (index.js:1)"},
+				},
+				Kind: FunctionErrorHandled,
+			},
+		},
+		{
+			name:       "go runtime stack frames",
+			statusCode: http.StatusOK,
+			header:     http.Header{HeaderFunctionError: {"Unhandled"}},
+			body: `{"errorType":"runtime.Error","errorMessage":"nil map",` +
+				`"stackTrace":[{"path":"main.go","line":12,"label":"handler"}]}`,
+			wantFnErr: &FunctionError{
+				ErrorPayload: ErrorPayload{
+					ErrorType:    "runtime.Error",
+					ErrorMessage: "nil map",
+					StackTrace:   []string{"main.go:12 handler"},
+				},
+				Kind: FunctionErrorUnhandled,
+			},
+		},
+		{
+			name:       "function error which is not JSON",
+			statusCode: http.StatusOK,
+			header:     http.Header{HeaderFunctionError: {"Unhandled"}},
+			body:       "exit status 2\n",
+			wantFnErr: &FunctionError{
+				ErrorPayload: ErrorPayload{ErrorMessage: "exit status 2"},
+				Kind:         FunctionErrorUnhandled,
+			},
+		},
+		{
+			name:       "service error with an error type header",
+			statusCode: http.StatusNotFound,
+			header:     http.Header{HeaderErrorType: {"ResourceNotFoundException:http://internal.amazon.com/coral/com.amazonaws.awslambda/"}},
+			body:       `{"Message":"Function not found: hello"}`,
+			wantSvcErr: &ServiceError{
+				StatusCode: http.StatusNotFound,
+				Code:       "ResourceNotFoundException",
+				Message:    "Function not found: hello",
+			},
+		},
+		{
+			name:       "service error with a type field",
+			statusCode: http.StatusTooManyRequests,
+			body:       `{"__type":"TooManyRequestsException","message":"Rate exceeded"}`,
+			wantSvcErr: &ServiceError{
+				StatusCode: http.StatusTooManyRequests,
+				Code:       "TooManyRequestsException",
+				Message:    "Rate exceeded",
+			},
+		},
+		{
+			name:       "service error without a body",
+			statusCode: http.StatusBadGateway,
+			wantSvcErr: &ServiceError{StatusCode: http.StatusBadGateway, Code: "Bad Gateway"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newLambdaServer(t, tt.statusCode, tt.header, tt.body)
+
+			result, err := LambdaInvoke(context.Background(), server.URL, []byte(`{}`))
+			if result == nil {
+				t.Fatalf("LambdaInvoke() result = nil, error = %v", err)
+			}
+			if result.StatusCode != tt.statusCode || string(result.Payload) != tt.body {
+				t.Errorf("LambdaInvoke() result = %d %s, want %d %s", result.StatusCode, result.Payload, tt.statusCode, tt.body)
+			}
+
+			var fnErr *FunctionError
+			if errors.As(err, &fnErr) != (tt.wantFnErr != nil) {
+				t.Fatalf("LambdaInvoke() error = %v, want function error %v", err, tt.wantFnErr)
+			}
+			if fnErr != nil {
+				if fnErr.Result != result {
+					t.Errorf("function error result = %v, want %v", fnErr.Result, result)
+				}
+				fnErr.Result = nil
+				if !reflect.DeepEqual(fnErr, tt.wantFnErr) {
+					t.Errorf("function error = %+v, want %+v", fnErr, tt.wantFnErr)
+				}
+			}
+
+			var svcErr *ServiceError
+			if errors.As(err, &svcErr) != (tt.wantSvcErr != nil) {
+				t.Fatalf("LambdaInvoke() error = %v, want service error %v", err, tt.wantSvcErr)
+			}
+			if svcErr != nil {
+				svcErr.Result = nil
+				if !reflect.DeepEqual(svcErr, tt.wantSvcErr) {
+					t.Errorf("service error = %+v, want %+v", svcErr, tt.wantSvcErr)
+				}
+			}
+
+			if tt.wantFnErr == nil && tt.wantSvcErr == nil && err != nil {
+				t.Errorf("LambdaInvoke() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLambdaInvokeTransportError(t *testing.T) {
+	server := newLambdaServer(t, http.StatusOK, nil, "")
+	server.Close()
+
+	result, err := LambdaInvoke(context.Background(), server.URL, []byte(`{}`))
+	if err == nil || result != nil {
+		t.Fatalf("LambdaInvoke() = %v, %v, want a transport error", result, err)
+	}
+
+	var fnErr *FunctionError
+	var svcErr *ServiceError
+	if errors.As(err, &fnErr) || errors.As(err, &svcErr) {
+		t.Errorf("LambdaInvoke() error = %v, want neither a function nor a service error", err)
+	}
+}
+
+func TestLambdaInvokeFromCLI(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		_, _ = io.WriteString(w, `"ok"`)
+	}))
+	defer server.Close()
+
+	flags := append(LambdaFlags(), LambdaInvokeFlags(FunctionNamePrefix)...)
+	cliCtx := newTestCLIContext(t, flags, "--lambda-endpoint", server.URL+"/", "--function", "hello")
+
+	result, err := LambdaInvokeFromCLI(cliCtx, FunctionNamePrefix, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result.Payload) != `"ok"` {
+		t.Errorf("LambdaInvokeFromCLI() payload = %s, want \"ok\"", result.Payload)
+	}
+	if want := "/2015-03-31/functions/hello/invocations"; path != want {
+		t.Errorf("invoked path %s, want %s", path, want)
+	}
+}
+
+func TestHTTPInvokerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	result, err := NewHTTPInvoker(server.URL, 20*time.Millisecond).Invoke(context.Background(), []byte(`{}`))
+
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) || !fnErr.Timeout() || fnErr.Kind != FunctionErrorUnhandled {
+		t.Fatalf("Invoke() error = %v, want an unhandled timeout", err)
+	}
+	if !strings.Contains(fnErr.ErrorMessage, "Task timed out after 0.02 seconds") {
+		t.Errorf("timeout message = %q", fnErr.ErrorMessage)
+	}
+	if result == nil || result.FunctionError != FunctionErrorUnhandled || result != fnErr.Result {
+		t.Errorf("Invoke() result = %+v, want the unhandled error result", result)
+	}
+
+	var payload ErrorPayload
+	if err := json.Unmarshal(result.Payload, &payload); err != nil || payload.ErrorType != ErrorTypeTimedOut {
+		t.Errorf("timeout payload = %s, want a %s error", result.Payload, ErrorTypeTimedOut)
+	}
+}
+
+func TestHTTPInvokerCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// the cancellation of the caller is not a timeout of the function
+	result, err := NewHTTPInvoker(server.URL, time.Minute).Invoke(ctx, []byte(`{}`))
+	var fnErr *FunctionError
+	if err == nil || errors.As(err, &fnErr) || result != nil {
+		t.Errorf("Invoke() = %v, %v, want the cancellation of the context", result, err)
+	}
+}
+
+func TestHTTPInvokerWithoutTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = io.WriteString(w, `"ok"`)
+	}))
+	defer server.Close()
+
+	result, err := NewHTTPInvoker(server.URL, 0).Invoke(context.Background(), []byte(`{}`))
+	if err != nil || string(result.Payload) != `"ok"` {
+		t.Errorf("Invoke() = %v, %v, want the response of the function", result, err)
+	}
+}
@@ -0,0 +1,165 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	consumer "github.com/harlow/kinesis-consumer"
+	"go.uber.org/zap"
+)
+
+const (
+	// Delay before retrying a batch after the first function error.
+	retryBaseDelay = time.Second
+
+	// Upper bound of the delay between retries of a batch.
+	retryMaxDelay = time.Minute
+)
+
+// KinesisEventSourceMapping invokes a lambda function with the records read from a kinesis stream,
+// like a lambda event source mapping with a batch size of one.
+type KinesisEventSourceMapping struct {
+	// Invoker of the lambda function
+	Invoker Invoker
+	// Times to retry a batch when the function returns an error, negative to retry until it succeeds
+	MaximumRetryAttempts int
+}
+
+func NewKinesisEventSourceMapping(invoker Invoker, maximumRetryAttempts int) *KinesisEventSourceMapping {
+	return &KinesisEventSourceMapping{
+		Invoker:              invoker,
+		MaximumRetryAttempts: maximumRetryAttempts,
+	}
+}
+
+// Handle invokes the function with the record, it can be used as the scan function of a consumer.
+// It returns an error, which ends the scan, only when the invocation is rejected by lambda or the
+// context is cancelled.
+func (m *KinesisEventSourceMapping) Handle(ctx context.Context, record *consumer.Record) error {
+	event := NewKinesisEvent(record)
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		zap.L().Error("failed to marshal event", zap.Error(err))
+		return err
+	}
+
+	// continue the trace of the websocket emulator when the record carries one
+	traceID, ok := traceIDFromRecord(record.Data)
+	if !ok {
+		traceID = NewTraceID()
+	}
+	invokeCtx := WithTraceID(ctx, traceID)
+
+	// like an event source mapping, retry the batch while the function fails, blocking the shard
+	retries := 0
+	for attempt := 0; ; attempt++ {
+		res, err := m.Invoker.Invoke(invokeCtx, eventJSON)
+		if err == nil {
+			zap.L().Info("lambda invoked", zap.String("response", string(res.Payload)))
+			return nil
+		}
+
+		var fnErr *FunctionError
+		var svcErr *ServiceError
+		switch {
+		case errors.As(err, &fnErr):
+			if m.MaximumRetryAttempts >= 0 && retries >= m.MaximumRetryAttempts {
+				zap.L().Error("lambda failed, discarding record after exhausting retries",
+					append(LambdaErrorFields(err),
+						zap.String("kinesis.event.id", event.Records[0].EventID),
+						zap.Int("attempts", attempt+1),
+					)...,
+				)
+				return nil
+			}
+			retries++
+		case errors.As(err, &svcErr) && !svcErr.Throttled() && svcErr.StatusCode < http.StatusInternalServerError:
+			// the invocation is rejected, i.e. an unknown function, so retrying it cannot succeed
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		default:
+			// throttles, lambda service errors and transport errors are retried until the function is
+			// available, without counting as retries
+		}
+
+		delay := retryBaseDelay << attempt
+		if delay <= 0 || delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+
+		zap.L().Warn("lambda failed, retrying record",
+			append(LambdaErrorFields(err),
+				zap.String("kinesis.event.id", event.Records[0].EventID),
+				zap.Int("attempts", attempt+1),
+				zap.Duration("retry.delay", delay),
+			)...,
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// NewKinesisEvent builds the event lambda receives for a kinesis record.
+func NewKinesisEvent(record *consumer.Record) events.KinesisEvent {
+	sequenceNumber := "0"
+	if record.SequenceNumber != nil {
+		sequenceNumber = *record.SequenceNumber
+	}
+	arrivalTime := time.Now()
+	if record.ApproximateArrivalTimestamp != nil {
+		arrivalTime = *record.ApproximateArrivalTimestamp
+	}
+	partitionKey := ""
+	if record.PartitionKey != nil {
+		partitionKey = *record.PartitionKey
+	}
+
+	return events.KinesisEvent{
+		Records: []events.KinesisEventRecord{
+			{
+				EventSource:       "aws:kinesis",
+				EventVersion:      "0",
+				EventID:           fmt.Sprintf("%s:%s", record.ShardID, sequenceNumber),
+				EventName:         "aws:kinesis:record",
+				InvokeIdentityArn: fmt.Sprintf("arn:aws:iam::%s:role/canned-role", cannedAccountID),
+				Kinesis: events.KinesisRecord{
+					ApproximateArrivalTimestamp: events.SecondsEpochTime{Time: arrivalTime},
+					Data:                        record.Data,
+					PartitionKey:                partitionKey,
+					SequenceNumber:              sequenceNumber,
+					KinesisSchemaVersion:        "0",
+				},
+			},
+		},
+	}
+}
+
+// traceIDFromRecord reads the trace header the websocket emulator adds to the records it puts,
+// which are base64 encoded JSON documents.
+func traceIDFromRecord(data []byte) (string, bool) {
+	var templatedData struct {
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(data, &templatedData); err != nil {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return "", false
+		}
+		if err := json.Unmarshal(decoded, &templatedData); err != nil {
+			return "", false
+		}
+	}
+
+	return templatedData.TraceID, templatedData.TraceID != ""
+}
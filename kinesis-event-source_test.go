@@ -0,0 +1,160 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	consumer "github.com/harlow/kinesis-consumer"
+)
+
+func newTestKinesisRecord(data []byte) *consumer.Record {
+	arrival := time.Unix(1700000000, 0)
+	return &consumer.Record{
+		Record: types.Record{
+			Data:                        data,
+			PartitionKey:                aws.String("connection"),
+			SequenceNumber:              aws.String("42"),
+			ApproximateArrivalTimestamp: &arrival,
+		},
+		ShardID: "shardId-000000000000",
+	}
+}
+
+func TestNewKinesisEvent(t *testing.T) {
+	event := NewKinesisEvent(newTestKinesisRecord([]byte("hello")))
+
+	if len(event.Records) != 1 {
+		t.Fatalf("NewKinesisEvent() = %d records, want 1", len(event.Records))
+	}
+	record := event.Records[0]
+	if record.EventID != "shardId-000000000000:42" || record.EventSource != "aws:kinesis" {
+		t.Errorf("event record = %s from %s, want shardId-000000000000:42 from aws:kinesis", record.EventID, record.EventSource)
+	}
+	if string(record.Kinesis.Data) != "hello" || record.Kinesis.PartitionKey != "connection" || record.Kinesis.SequenceNumber != "42" {
+		t.Errorf("kinesis record = %+v, want the data, partition key and sequence number of the record", record.Kinesis)
+	}
+	if !record.Kinesis.ApproximateArrivalTimestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("arrival time = %s", record.Kinesis.ApproximateArrivalTimestamp)
+	}
+}
+
+func TestTraceIDFromRecord(t *testing.T) {
+	const traceID = "Root=1-5759e988-bd862e3fe1be46a994272793"
+	document := []byte(`{"trace_id":"` + traceID + `","body":"hello"}`)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		want   string
+		wantOK bool
+	}{
+		{name: "JSON", data: document, want: traceID, wantOK: true},
+		{name: "base64 JSON", data: []byte(base64.StdEncoding.EncodeToString(document)), want: traceID, wantOK: true},
+		{name: "without trace", data: []byte(`{"body":"hello"}`)},
+		{name: "text", data: []byte("hello")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := traceIDFromRecord(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("traceIDFromRecord(%s) = %q, %v, want %q, %v", tt.data, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestKinesisEventSourceMappingHandle(t *testing.T) {
+	throttle := &ServiceError{StatusCode: http.StatusTooManyRequests, Code: ErrorCodeTooManyRequests}
+	serviceFailure := &ServiceError{StatusCode: http.StatusBadGateway, Code: "ServiceException"}
+	notFound := &ServiceError{StatusCode: http.StatusNotFound, Code: "ResourceNotFoundException"}
+	transport := errors.New("failed to invoke lambda: connection refused")
+
+	tests := []struct {
+		name            string
+		retryAttempts   int
+		errs            []error
+		wantErr         error
+		wantInvocations int
+	}{
+		{name: "success", wantInvocations: 1},
+		{name: "discarded after retries", retryAttempts: 0, errs: []error{newTestFunctionError()}, wantInvocations: 1},
+		{name: "retried function error", retryAttempts: 1, errs: []error{newTestFunctionError()}, wantInvocations: 2},
+		{name: "throttle", retryAttempts: 0, errs: []error{throttle}, wantInvocations: 2},
+		{name: "lambda service failure", retryAttempts: 0, errs: []error{serviceFailure}, wantInvocations: 2},
+		{name: "transport error", retryAttempts: 0, errs: []error{transport}, wantInvocations: 2},
+		{name: "rejected invocation", retryAttempts: -1, errs: []error{notFound}, wantErr: notFound, wantInvocations: 1},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// retries wait for a second, so the cases run at once
+			t.Parallel()
+
+			invoker := &scriptedInvoker{errs: tt.errs}
+			mapping := NewKinesisEventSourceMapping(invoker, tt.retryAttempts)
+
+			err := mapping.Handle(context.Background(), newTestKinesisRecord([]byte(`{}`)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Handle() error = %v, want %v", err, tt.wantErr)
+			}
+			if invocations := len(invoker.times()); invocations != tt.wantInvocations {
+				t.Errorf("function invoked %d times, want %d", invocations, tt.wantInvocations)
+			}
+		})
+	}
+}
+
+func TestKinesisEventSourceMappingHandleCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	invoker := InvokeFunc(func(context.Context, []byte) (*InvokeResult, error) {
+		cancel()
+		return nil, errors.New("failed to invoke lambda: connection refused")
+	})
+
+	mapping := NewKinesisEventSourceMapping(invoker, -1)
+	if err := mapping.Handle(ctx, newTestKinesisRecord([]byte(`{}`))); !errors.Is(err, context.Canceled) {
+		t.Errorf("Handle() error = %v, want the cancellation of the context", err)
+	}
+}
+
+func TestKinesisEventSourceMappingTrace(t *testing.T) {
+	const traceID = "Root=1-5759e988-bd862e3fe1be46a994272793"
+
+	var (
+		mu      sync.Mutex
+		traced  string
+		invoked events.KinesisEvent
+	)
+	invoker := InvokeFunc(func(ctx context.Context, payload []byte) (*InvokeResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		traced, _ = TraceIDFromContext(ctx)
+		return &InvokeResult{StatusCode: http.StatusOK}, json.Unmarshal(payload, &invoked)
+	})
+
+	mapping := NewKinesisEventSourceMapping(invoker, 0)
+	data := []byte(`{"trace_id":"` + traceID + `"}`)
+	if err := mapping.Handle(context.Background(), newTestKinesisRecord(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if traced != traceID {
+		t.Errorf("invocation traced as %q, want the trace of the record %q", traced, traceID)
+	}
+	if len(invoked.Records) != 1 || string(invoked.Records[0].Kinesis.Data) != string(data) {
+		t.Errorf("function invoked with %+v, want the kinesis event of the record", invoked)
+	}
+}
@@ -2,17 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"os"
-	"time"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/kinesis"
 	consumer "github.com/harlow/kinesis-consumer"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
@@ -21,9 +14,10 @@ import (
 )
 
 const (
-	AwsRegion       = "aws-region"
-	KinesisEndpoint = "kinesis-endpoint"
-	KinesisStream   = "kinesis-stream"
+	AwsRegion            = offline.AwsRegionName
+	KinesisEndpoint      = offline.KinesisEndpointName
+	KinesisStream        = "kinesis-stream"
+	MaximumRetryAttempts = "maximum-retry-attempts"
 )
 
 type kinesisLoggerShim struct {
@@ -46,31 +40,29 @@ func init() {
 
 func main() {
 	flags := []cli.Flag{
-		&cli.StringFlag{
-			Name:    AwsRegion,
-			EnvVars: []string{"AWS_REGION"},
-			Value:   "us-east-1",
-			Usage:   "AWS region to use",
-		},
-		&cli.StringFlag{
-			Name:    KinesisEndpoint,
-			EnvVars: []string{"KINESIS_ENDPOINT"},
-			Usage:   "Endpoint to use for kinesis. i.e. http://localhost:4566",
-		},
 		&cli.StringFlag{
 			Name:    KinesisStream,
 			EnvVars: []string{"KINESIS_STREAM"},
 			Usage:   "Kinesis stream to read from",
 		},
+		&cli.IntFlag{
+			Name:    MaximumRetryAttempts,
+			EnvVars: []string{"MAXIMUM_RETRY_ATTEMPTS"},
+			Value:   -1,
+			Usage:   "Times to retry a batch when the function returns an error, -1 retries until it succeeds",
+		},
 	}
 
+	flags = append(flags, offline.KinesisFlags()...)
 	flags = append(flags, offline.LambdaFlags()...)
 	flags = append(flags, offline.LambdaInvokeFlags("")...)
+	flags = append(flags, offline.LambdaConcurrencyFlags("")...)
 
 	app := &cli.App{
-		Name:  "kinesis-subscription-emulator",
-		Usage: "Invoke a lambda function via http for every message in the kinesis stream",
-		Flags: flags,
+		Name:   "kinesis-subscription-emulator",
+		Usage:  "Invoke a lambda function via http for every message in the kinesis stream",
+		Flags:  flags,
+		Before: offline.LoadRegistryFile,
 		Action: func(cliCtx *cli.Context) error {
 			awsRegion := cliCtx.String(AwsRegion)
 			kinesisEndpoint := cliCtx.String(KinesisEndpoint)
@@ -82,32 +74,10 @@ func main() {
 				zap.String("kinesis.stream", streamName),
 			)
 
-			resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...any) (aws.Endpoint, error) {
-				if service != kinesis.ServiceID {
-					return aws.Endpoint{}, fmt.Errorf("unsupported service %s", service)
-				}
-				if region != awsRegion {
-					return aws.Endpoint{}, fmt.Errorf("unsupported region %s", region)
-				}
-				return aws.Endpoint{
-					PartitionID:   "aws",
-					URL:           kinesisEndpoint,
-					SigningRegion: awsRegion,
-				}, nil
-			})
-
-			cfg, err := config.LoadDefaultConfig(
-				context.Background(),
-				config.WithRegion(awsRegion),
-				config.WithEndpointResolverWithOptions(resolver),
-				config.WithCredentialsProvider(
-					credentials.NewStaticCredentialsProvider("canned", "canned", "kinesis-subscription-emulator"),
-				),
-			)
+			client, err := offline.KinesisClientFromCLI(cliCtx, "kinesis-subscription-emulator")
 			if err != nil {
 				zap.L().Fatal("unable to load SDK config", zap.Error(err))
 			}
-			var client = kinesis.NewFromConfig(cfg)
 
 			c, err := consumer.New(
 				streamName,
@@ -122,14 +92,20 @@ func main() {
 				zap.String("kinesis.stream", streamName),
 			)
 
+			invoker, err := offline.InvokerFromCLI(cliCtx, "")
+			if err != nil {
+				zap.L().Fatal("invalid lambda configuration", zap.Error(err))
+			}
+			mapping := offline.NewKinesisEventSourceMapping(invoker, cliCtx.Int(MaximumRetryAttempts))
 			ctx := offline.TrapProcess()
 			err = c.Scan(ctx, func(r *consumer.Record) error {
-				return handle(cliCtx, "", r)
+				return mapping.Handle(ctx, r)
 			})
-			if err != nil {
+			// the scan stops with the context when the process is interrupted
+			if err != nil && !errors.Is(err, context.Canceled) {
 				zap.L().Fatal("scan error", zap.Error(err))
 			}
-			return err
+			return nil
 		},
 	}
 
@@ -137,52 +113,3 @@ func main() {
 		log.Fatal(err)
 	}
 }
-
-func handle(ctx *cli.Context, functionName string, record *consumer.Record) error {
-	sequenceNumber := "0"
-	if record.SequenceNumber != nil {
-		sequenceNumber = *record.SequenceNumber
-	}
-	arrivalTime := time.Now()
-	if record.ApproximateArrivalTimestamp != nil {
-		arrivalTime = *record.ApproximateArrivalTimestamp
-	}
-	partitionKey := ""
-	if record.PartitionKey != nil {
-		partitionKey = *record.PartitionKey
-	}
-
-	event := events.KinesisEvent{
-		Records: []events.KinesisEventRecord{
-			{
-				EventSource:       "aws:kinesis",
-				EventVersion:      "0",
-				EventID:           fmt.Sprintf("%s:%s", record.ShardID, sequenceNumber),
-				EventName:         "aws:kinesis:record",
-				InvokeIdentityArn: "arn:aws:iam::000000000000:role/canned-role",
-				Kinesis: events.KinesisRecord{
-					ApproximateArrivalTimestamp: events.SecondsEpochTime{Time: arrivalTime},
-					Data:                        record.Data,
-					PartitionKey:                partitionKey,
-					SequenceNumber:              sequenceNumber,
-					KinesisSchemaVersion:        "0",
-				},
-			},
-		},
-	}
-
-	eventJSON, err := json.Marshal(event)
-	if err != nil {
-		zap.L().Error("failed to marshal event", zap.Error(err))
-		return err
-	}
-
-	res, err := offline.LambdaInvokeFromCLI(ctx, functionName, eventJSON)
-	if err != nil {
-		return err
-	}
-
-	zap.L().Info("lambda invoked", zap.String("response", string(res)))
-
-	return nil
-}
@@ -0,0 +1,71 @@
+package offline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	AwsRegionName         = "aws-region"
+	KinesisEndpointName   = "kinesis-endpoint"
+	EnvVarAwsRegion       = "AWS_REGION"
+	EnvVarKinesisEndpoint = "KINESIS_ENDPOINT"
+	defaultAwsRegion      = "us-east-1"
+)
+
+// NewKinesisClient builds a kinesis client for the emulated endpoint using canned credentials.
+func NewKinesisClient(ctx context.Context, awsRegion, kinesisEndpoint, sessionName string) (*kinesis.Client, error) {
+	resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...any) (aws.Endpoint, error) {
+		if service != kinesis.ServiceID {
+			return aws.Endpoint{}, fmt.Errorf("unsupported service %s", service)
+		}
+		if region != awsRegion {
+			return aws.Endpoint{}, fmt.Errorf("unsupported region %s", region)
+		}
+		return aws.Endpoint{
+			PartitionID:   "aws",
+			URL:           kinesisEndpoint,
+			SigningRegion: awsRegion,
+		}, nil
+	})
+
+	cfg, err := config.LoadDefaultConfig(
+		ctx,
+		config.WithRegion(awsRegion),
+		config.WithEndpointResolverWithOptions(resolver),
+		config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider("canned", "canned", sessionName),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SDK config: %w", err)
+	}
+
+	return kinesis.NewFromConfig(cfg), nil
+}
+
+func KinesisClientFromCLI(cliCtx *cli.Context, sessionName string) (*kinesis.Client, error) {
+	return NewKinesisClient(cliCtx.Context, cliCtx.String(AwsRegionName), cliCtx.String(KinesisEndpointName), sessionName)
+}
+
+func KinesisFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    AwsRegionName,
+			EnvVars: []string{EnvVarAwsRegion},
+			Value:   defaultAwsRegion,
+			Usage:   "AWS region to use",
+		},
+		&cli.StringFlag{
+			Name:    KinesisEndpointName,
+			EnvVars: []string{EnvVarKinesisEndpoint},
+			Usage:   "Endpoint to use for kinesis. i.e. http://localhost:4566",
+		},
+	}
+}
@@ -0,0 +1,130 @@
+package offline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const defaultListFunctionsMaxItems = 50
+
+// LambdaAPI serves the read-only subset of the lambda management API for the functions of a
+// registry: ListFunctions, GetFunction and GetFunctionConfiguration.
+type LambdaAPI struct {
+	registry *FunctionRegistry
+	region   string
+}
+
+func NewLambdaAPI(registry *FunctionRegistry, region string) *LambdaAPI {
+	return &LambdaAPI{
+		registry: registry,
+		region:   region,
+	}
+}
+
+// Register adds the routes of the API to the router.
+func (a *LambdaAPI) Register(router *mux.Router) {
+	router.HandleFunc("/2015-03-31/functions", a.serveListFunctions).Methods(http.MethodGet)
+	router.HandleFunc("/2015-03-31/functions/", a.serveListFunctions).Methods(http.MethodGet)
+	router.HandleFunc("/2015-03-31/functions/{functionName}", a.serveGetFunction).Methods(http.MethodGet)
+	router.HandleFunc(
+		"/2015-03-31/functions/{functionName}/configuration",
+		a.serveGetFunctionConfiguration,
+	).Methods(http.MethodGet)
+}
+
+func (a *LambdaAPI) serveListFunctions(w http.ResponseWriter, r *http.Request) {
+	maxItems := defaultListFunctionsMaxItems
+	if value := r.URL.Query().Get("MaxItems"); value != "" {
+		var err error
+		if maxItems, err = strconv.Atoi(value); err != nil || maxItems < 1 {
+			writeServiceError(w, &ServiceError{
+				StatusCode: http.StatusBadRequest,
+				Code:       "InvalidParameterValueException",
+				Message:    fmt.Sprintf("Invalid MaxItems %q", value),
+			})
+			return
+		}
+	}
+
+	// the marker is the name of the first function of the page
+	marker := r.URL.Query().Get("Marker")
+	response := struct {
+		Functions  []FunctionConfiguration `json:"Functions"`
+		NextMarker *string                 `json:"NextMarker"`
+	}{
+		Functions: []FunctionConfiguration{},
+	}
+	for _, definition := range a.registry.List() {
+		if definition.Name < marker {
+			continue
+		}
+		if len(response.Functions) == maxItems {
+			nextMarker := definition.Name
+			response.NextMarker = &nextMarker
+			break
+		}
+		response.Functions = append(response.Functions, definition.Configuration(a.region))
+	}
+
+	writeJSON(w, response)
+}
+
+func (a *LambdaAPI) serveGetFunction(w http.ResponseWriter, r *http.Request) {
+	definition, ok := a.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, struct {
+		Configuration FunctionConfiguration `json:"Configuration"`
+		Code          map[string]string     `json:"Code"`
+		Tags          map[string]string     `json:"Tags"`
+	}{
+		Configuration: definition.Configuration(a.region),
+		Code:          map[string]string{"RepositoryType": "S3", "Location": ""},
+		Tags:          map[string]string{},
+	})
+}
+
+func (a *LambdaAPI) serveGetFunctionConfiguration(w http.ResponseWriter, r *http.Request) {
+	definition, ok := a.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, definition.Configuration(a.region))
+}
+
+// lookup finds the function of the request, responding with an error when it does not exist.
+func (a *LambdaAPI) lookup(w http.ResponseWriter, r *http.Request) (FunctionDefinition, bool) {
+	functionName := mux.Vars(r)["functionName"]
+	definition, ok := a.registry.Lookup(functionName)
+	if !ok {
+		name, _ := SplitFunctionName(functionName)
+		writeServiceError(w, &ServiceError{
+			StatusCode: http.StatusNotFound,
+			Code:       ErrorCodeResourceNotFound,
+			Message:    fmt.Sprintf("Function not found: %s", LambdaFunctionArn(a.region, name)),
+		})
+	}
+
+	return definition, ok
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		zap.L().Error("failed to marshal response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
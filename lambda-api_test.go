@@ -0,0 +1,126 @@
+package offline
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func newTestLambdaAPI(t *testing.T, names ...string) *mux.Router {
+	t.Helper()
+
+	registry := NewFunctionRegistry()
+	for _, name := range names {
+		registry.Register(FunctionDefinition{Name: name, Timeout: 10 * time.Second})
+	}
+	router := mux.NewRouter()
+	NewLambdaAPI(registry, "eu-west-1").Register(router)
+
+	return router
+}
+
+func TestLambdaAPIListFunctions(t *testing.T) {
+	router := newTestLambdaAPI(t, "c", "a", "b")
+
+	tests := []struct {
+		name           string
+		query          string
+		wantStatus     int
+		wantFunctions  []string
+		wantNextMarker string
+	}{
+		{name: "all", wantStatus: http.StatusOK, wantFunctions: []string{"a", "b", "c"}},
+		{name: "first page", query: "?MaxItems=2", wantStatus: http.StatusOK, wantFunctions: []string{"a", "b"}, wantNextMarker: "c"},
+		{name: "next page", query: "?MaxItems=2&Marker=c", wantStatus: http.StatusOK, wantFunctions: []string{"c"}},
+		{name: "invalid max items", query: "?MaxItems=0", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/2015-03-31/functions/"+tt.query, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var response struct {
+				Functions  []FunctionConfiguration
+				NextMarker *string
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, function := range response.Functions {
+				names = append(names, function.FunctionName)
+			}
+			nextMarker := ""
+			if response.NextMarker != nil {
+				nextMarker = *response.NextMarker
+			}
+			if len(names) != len(tt.wantFunctions) || nextMarker != tt.wantNextMarker {
+				t.Errorf("ListFunctions() = %q with marker %q, want %q with marker %q", names, nextMarker, tt.wantFunctions, tt.wantNextMarker)
+			}
+			for i := range names {
+				if names[i] != tt.wantFunctions[i] {
+					t.Errorf("ListFunctions() = %q, want %q", names, tt.wantFunctions)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestLambdaAPIGetFunction(t *testing.T) {
+	router := newTestLambdaAPI(t, "hello")
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{name: "function", path: "/2015-03-31/functions/hello", wantStatus: http.StatusOK},
+		{name: "configuration", path: "/2015-03-31/functions/hello/configuration", wantStatus: http.StatusOK},
+		{name: "qualified name", path: "/2015-03-31/functions/hello:live/configuration", wantStatus: http.StatusOK},
+		{name: "ARN", path: "/2015-03-31/functions/arn:aws:lambda:eu-west-1:000000000000:function:hello", wantStatus: http.StatusOK},
+		{name: "unknown function", path: "/2015-03-31/functions/goodbye", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotFound {
+				if code := recorder.Header().Get(HeaderErrorType); code != ErrorCodeResourceNotFound {
+					t.Errorf("error type = %s, want %s", code, ErrorCodeResourceNotFound)
+				}
+				return
+			}
+
+			var configuration FunctionConfiguration
+			body := recorder.Body.Bytes()
+			var function struct {
+				Configuration *FunctionConfiguration
+			}
+			if err := json.Unmarshal(body, &function); err == nil && function.Configuration != nil {
+				configuration = *function.Configuration
+			} else if err := json.Unmarshal(body, &configuration); err != nil {
+				t.Fatal(err)
+			}
+			if configuration.FunctionName != "hello" || configuration.Timeout != 10 {
+				t.Errorf("configuration = %+v, want the hello function with its timeout", configuration)
+			}
+		})
+	}
+}
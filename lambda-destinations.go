@@ -0,0 +1,281 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	OnSuccessDestinationName         = "on-success-destination"
+	OnFailureDestinationName         = "on-failure-destination"
+	EnvVarOnSuccessDestination       = "LAMBDA_ON_SUCCESS_DESTINATION"
+	EnvVarOnFailureDestination       = "LAMBDA_ON_FAILURE_DESTINATION"
+	destinationRecordVersion         = "1.0"
+	destinationRecordTimestampLayout = "2006-01-02T15:04:05.000Z"
+	cannedAccountID                  = "000000000000"
+	latestVersion                    = "$LATEST"
+)
+
+// DestinationCondition is the reason an invocation record was sent to a destination.
+type DestinationCondition string
+
+const (
+	DestinationConditionSuccess          DestinationCondition = "Success"
+	DestinationConditionRetriesExhausted DestinationCondition = "RetriesExhausted"
+	DestinationConditionEventAgeExceeded DestinationCondition = "EventAgeExceeded"
+)
+
+type DestinationRequestContext struct {
+	RequestID              string               `json:"requestId"`
+	FunctionArn            string               `json:"functionArn"`
+	Condition              DestinationCondition `json:"condition"`
+	ApproximateInvokeCount int                  `json:"approximateInvokeCount"`
+}
+
+type DestinationResponseContext struct {
+	StatusCode      int               `json:"statusCode"`
+	ExecutedVersion string            `json:"executedVersion"`
+	FunctionError   FunctionErrorKind `json:"functionError,omitempty"`
+}
+
+// DestinationRecord is the invocation record lambda sends to the destinations of asynchronous
+// invocations.
+type DestinationRecord struct {
+	Version         string                      `json:"version"`
+	Timestamp       string                      `json:"timestamp"`
+	RequestContext  DestinationRequestContext   `json:"requestContext"`
+	RequestPayload  json.RawMessage             `json:"requestPayload"`
+	ResponseContext *DestinationResponseContext `json:"responseContext,omitempty"`
+	ResponsePayload json.RawMessage             `json:"responsePayload,omitempty"`
+}
+
+// NewDestinationRecord describes the outcome of an asynchronous invocation of the given function.
+// The ARN is qualified by the version or alias which was invoked, unqualified ARNs invoke $LATEST.
+func NewDestinationRecord(functionArn string, event *AsyncEvent, condition DestinationCondition) *DestinationRecord {
+	_, qualifier := SplitFunctionName(functionArn)
+	if qualifier == "" {
+		qualifier = latestVersion
+		functionArn = fmt.Sprintf("%s:%s", functionArn, qualifier)
+	}
+
+	record := &DestinationRecord{
+		Version:   destinationRecordVersion,
+		Timestamp: time.Now().UTC().Format(destinationRecordTimestampLayout),
+		RequestContext: DestinationRequestContext{
+			RequestID:              event.RequestID,
+			FunctionArn:            functionArn,
+			Condition:              condition,
+			ApproximateInvokeCount: event.Attempts,
+		},
+		RequestPayload: RawJSON(event.Payload),
+	}
+
+	if event.Result != nil {
+		executedVersion := event.Result.ExecutedVersion
+		if executedVersion == "" {
+			executedVersion = latestVersion
+			// a version runs itself, only the version an alias resolved to is unknown
+			if isFunctionVersion(qualifier) {
+				executedVersion = qualifier
+			}
+		}
+		record.ResponseContext = &DestinationResponseContext{
+			StatusCode:      event.Result.StatusCode,
+			ExecutedVersion: executedVersion,
+			FunctionError:   event.Result.FunctionError,
+		}
+		record.ResponsePayload = RawJSON(event.Result.Payload)
+	}
+
+	return record
+}
+
+// RawJSON embeds a payload in a JSON document, as is when it is valid JSON and as a string otherwise.
+func RawJSON(payload []byte) json.RawMessage {
+	if len(payload) == 0 {
+		return nil
+	}
+	if json.Valid(payload) {
+		return payload
+	}
+
+	encoded, _ := json.Marshal(string(payload))
+	return encoded
+}
+
+// isFunctionVersion reports whether the qualifier is a version rather than an alias.
+func isFunctionVersion(qualifier string) bool {
+	if qualifier == latestVersion {
+		return true
+	}
+	_, err := strconv.ParseUint(qualifier, 10, 64)
+	return err == nil
+}
+
+// LambdaFunctionArn builds the ARN of a function in the emulated account.
+func LambdaFunctionArn(region, functionName string) string {
+	return fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", region, cannedAccountID, functionName)
+}
+
+// Destination receives the invocation records of asynchronous invocations.
+type Destination interface {
+	Send(ctx context.Context, record *DestinationRecord) error
+}
+
+// FunctionDestination invokes another lambda function with the invocation record.
+type FunctionDestination struct {
+	invoker Invoker
+}
+
+func NewFunctionDestination(invoker Invoker) *FunctionDestination {
+	return &FunctionDestination{invoker: invoker}
+}
+
+func (d *FunctionDestination) Send(ctx context.Context, record *DestinationRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal destination record: %w", err)
+	}
+
+	if _, err := d.invoker.Invoke(ctx, recordBytes); err != nil {
+		return fmt.Errorf("failed to invoke destination function: %w", err)
+	}
+
+	return nil
+}
+
+// KinesisDestination puts the invocation record to a kinesis stream.
+type KinesisDestination struct {
+	client     *kinesis.Client
+	streamName string
+}
+
+func NewKinesisDestination(client *kinesis.Client, streamName string) *KinesisDestination {
+	return &KinesisDestination{client: client, streamName: streamName}
+}
+
+func (d *KinesisDestination) Send(ctx context.Context, record *DestinationRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal destination record: %w", err)
+	}
+
+	_, err = d.client.PutRecord(ctx, &kinesis.PutRecordInput{
+		Data:         recordBytes,
+		StreamName:   aws.String(d.streamName),
+		PartitionKey: aws.String(record.RequestContext.RequestID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put destination record to kinesis: %w", err)
+	}
+
+	return nil
+}
+
+// FileDestination appends the invocation record to a local JSONL file.
+type FileDestination struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileDestination(path string) *FileDestination {
+	return &FileDestination{path: path}
+}
+
+func (d *FileDestination) Send(_ context.Context, record *DestinationRecord) error {
+	recordBytes, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal destination record: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open destination file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(recordBytes, '\n')); err != nil {
+		return fmt.Errorf("failed to write destination record: %w", err)
+	}
+
+	return nil
+}
+
+// DestinationFromCLI builds the destination configured by the named flag, which is either the ARN
+// of a lambda function or kinesis stream, or the path of a JSONL file. It returns nil when the flag
+// is not set.
+func DestinationFromCLI(cliCtx *cli.Context, name string) (Destination, error) {
+	return destinationFromCLI(cliCtx, name, func(functionArn string) (Destination, error) {
+		invoker, err := FunctionInvokerFromCLI(cliCtx, functionArn)
+		if err != nil {
+			return nil, err
+		}
+		return NewFunctionDestination(invoker), nil
+	})
+}
+
+// destinationFromCLI builds the destination configured by the named flag like DestinationFromCLI,
+// with the destinations of lambda function ARNs built by functionDestination.
+func destinationFromCLI(
+	cliCtx *cli.Context,
+	name string,
+	functionDestination func(functionArn string) (Destination, error),
+) (Destination, error) {
+	target := cliCtx.String(name)
+	switch {
+	case target == "":
+		return nil, nil
+	case strings.HasPrefix(target, "arn:aws:lambda:"):
+		// arn:aws:lambda:region:account:function:name[:qualifier]
+		parts := strings.Split(target, ":")
+		if len(parts) < 7 || len(parts) > 8 || parts[5] != "function" || parts[6] == "" {
+			return nil, fmt.Errorf("invalid lambda function arn %q", target)
+		}
+		return functionDestination(target)
+	case strings.HasPrefix(target, "arn:aws:kinesis:"):
+		// arn:aws:kinesis:region:account:stream/name
+		_, streamName, ok := strings.Cut(target, ":stream/")
+		if !ok || streamName == "" {
+			return nil, fmt.Errorf("invalid kinesis stream arn %q", target)
+		}
+		client, err := KinesisClientFromCLI(cliCtx, "lambda-destination")
+		if err != nil {
+			return nil, err
+		}
+		return NewKinesisDestination(client, streamName), nil
+	default:
+		return NewFileDestination(strings.TrimPrefix(target, "file://")), nil
+	}
+}
+
+func LambdaDestinationFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    OnSuccessDestinationName,
+			EnvVars: []string{EnvVarOnSuccessDestination},
+			Usage: "Destination for records of successful asynchronous invocations. " +
+				"i.e. arn:aws:lambda:us-east-1:000000000000:function:name, " +
+				"arn:aws:kinesis:us-east-1:000000000000:stream/name or file:///tmp/success.jsonl",
+		},
+		&cli.StringFlag{
+			Name:    OnFailureDestinationName,
+			EnvVars: []string{EnvVarOnFailureDestination},
+			Usage: "Destination for records of failed asynchronous invocations. " +
+				"i.e. arn:aws:lambda:us-east-1:000000000000:function:name, " +
+				"arn:aws:kinesis:us-east-1:000000000000:stream/name or file:///tmp/failure.jsonl",
+		},
+	}
+}
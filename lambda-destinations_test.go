@@ -0,0 +1,364 @@
+package offline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDestination keeps the records it receives.
+type recordingDestination struct {
+	mu      sync.Mutex
+	records []*DestinationRecord
+}
+
+func (d *recordingDestination) Send(_ context.Context, record *DestinationRecord) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.records = append(d.records, record)
+	return nil
+}
+
+func (d *recordingDestination) conditions() []DestinationCondition {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var conditions []DestinationCondition
+	for _, record := range d.records {
+		conditions = append(conditions, record.RequestContext.Condition)
+	}
+	return conditions
+}
+
+func TestNewDestinationRecord(t *testing.T) {
+	event := &AsyncEvent{
+		RequestID: "request",
+		Payload:   []byte("not json"),
+		Attempts:  2,
+		Result: &InvokeResult{
+			StatusCode:    http.StatusOK,
+			FunctionError: FunctionErrorHandled,
+			Payload:       []byte(`{"errorMessage":"boom"}`),
+		},
+	}
+
+	record := NewDestinationRecord(LambdaFunctionArn("us-east-1", "hello"), event, DestinationConditionRetriesExhausted)
+
+	want := DestinationRequestContext{
+		RequestID:              "request",
+		FunctionArn:            "arn:aws:lambda:us-east-1:000000000000:function:hello:$LATEST",
+		Condition:              DestinationConditionRetriesExhausted,
+		ApproximateInvokeCount: 2,
+	}
+	if record.RequestContext != want {
+		t.Errorf("request context = %+v, want %+v", record.RequestContext, want)
+	}
+	if string(record.RequestPayload) != `"not json"` {
+		t.Errorf("request payload = %s, want the payload as a string", record.RequestPayload)
+	}
+	wantResponse := DestinationResponseContext{
+		StatusCode:      http.StatusOK,
+		ExecutedVersion: latestVersion,
+		FunctionError:   FunctionErrorHandled,
+	}
+	if record.ResponseContext == nil || *record.ResponseContext != wantResponse {
+		t.Errorf("response context = %+v, want %+v", record.ResponseContext, wantResponse)
+	}
+	if string(record.ResponsePayload) != `{"errorMessage":"boom"}` {
+		t.Errorf("response payload = %s, want the error payload", record.ResponsePayload)
+	}
+
+	// events discarded before the function ran have no response
+	record = NewDestinationRecord("arn", &AsyncEvent{Payload: []byte(`{}`)}, DestinationConditionEventAgeExceeded)
+	if record.ResponseContext != nil || record.ResponsePayload != nil {
+		t.Errorf("record of an event which did not run = %+v, want no response", record)
+	}
+}
+
+func TestNewDestinationRecordQualifier(t *testing.T) {
+	functionArn := LambdaFunctionArn("us-east-1", "hello")
+	tests := []struct {
+		name                string
+		functionArn         string
+		executedVersion     string
+		wantFunctionArn     string
+		wantExecutedVersion string
+	}{
+		{
+			name:                "unqualified",
+			functionArn:         functionArn,
+			wantFunctionArn:     functionArn + ":$LATEST",
+			wantExecutedVersion: latestVersion,
+		},
+		{
+			name:                "version",
+			functionArn:         functionArn + ":3",
+			wantFunctionArn:     functionArn + ":3",
+			wantExecutedVersion: "3",
+		},
+		{
+			name:                "alias",
+			functionArn:         functionArn + ":live",
+			executedVersion:     "2",
+			wantFunctionArn:     functionArn + ":live",
+			wantExecutedVersion: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &AsyncEvent{
+				Payload: []byte(`{}`),
+				Result:  &InvokeResult{StatusCode: http.StatusOK, ExecutedVersion: tt.executedVersion},
+			}
+			record := NewDestinationRecord(tt.functionArn, event, DestinationConditionSuccess)
+
+			if record.RequestContext.FunctionArn != tt.wantFunctionArn {
+				t.Errorf("function ARN = %q, want %q", record.RequestContext.FunctionArn, tt.wantFunctionArn)
+			}
+			if record.ResponseContext.ExecutedVersion != tt.wantExecutedVersion {
+				t.Errorf("executed version = %q, want %q", record.ResponseContext.ExecutedVersion, tt.wantExecutedVersion)
+			}
+		})
+	}
+}
+
+func TestRawJSON(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{payload: "", want: ""},
+		{payload: `{"ok":true}`, want: `{"ok":true}`},
+		{payload: "plain text", want: `"plain text"`},
+	}
+
+	for _, tt := range tests {
+		if got := RawJSON([]byte(tt.payload)); string(got) != tt.want {
+			t.Errorf("RawJSON(%q) = %s, want %s", tt.payload, got, tt.want)
+		}
+	}
+}
+
+func TestFileDestination(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.jsonl")
+	destination := NewFileDestination(path)
+
+	for _, requestID := range []string{"first", "second"} {
+		record := &DestinationRecord{RequestContext: DestinationRequestContext{RequestID: requestID}}
+		if err := destination.Send(context.Background(), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var requestIDs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record DestinationRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		requestIDs = append(requestIDs, record.RequestContext.RequestID)
+	}
+	if len(requestIDs) != 2 || requestIDs[0] != "first" || requestIDs[1] != "second" {
+		t.Errorf("appended records %q, want first and second", requestIDs)
+	}
+}
+
+func TestDestinationFromCLI(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		path  string
+		query string
+		body  []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path, query = r.URL.Path, r.URL.RawQuery
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		target    string
+		wantNil   bool
+		wantFile  string
+		wantPath  string
+		wantQuery string
+		wantErr   bool
+	}{
+		{name: "not set", wantNil: true},
+		{name: "file", target: "/tmp/records.jsonl", wantFile: "/tmp/records.jsonl"},
+		{name: "file URL", target: "file:///tmp/records.jsonl", wantFile: "/tmp/records.jsonl"},
+		{
+			name:     "function",
+			target:   "arn:aws:lambda:us-east-1:000000000000:function:on-failure",
+			wantPath: "/2015-03-31/functions/on-failure/invocations",
+		},
+		{
+			name:      "qualified function",
+			target:    "arn:aws:lambda:us-east-1:000000000000:function:on-failure:live",
+			wantPath:  "/2015-03-31/functions/on-failure/invocations",
+			wantQuery: "Qualifier=live",
+		},
+		{name: "invalid function", target: "arn:aws:lambda:us-east-1:000000000000:layer:name", wantErr: true},
+		{name: "function without a name", target: "arn:aws:lambda:us-east-1:000000000000:function:", wantErr: true},
+		{name: "invalid stream", target: "arn:aws:kinesis:us-east-1:000000000000:records", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := append(LambdaFlags(), LambdaDestinationFlags()...)
+			args := []string{"--lambda-endpoint", server.URL}
+			if tt.target != "" {
+				args = append(args, "--on-failure-destination", tt.target)
+			}
+			cliCtx := newTestCLIContext(t, flags, args...)
+
+			destination, err := DestinationFromCLI(cliCtx, OnFailureDestinationName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DestinationFromCLI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantErr:
+				return
+			case tt.wantNil:
+				if destination != nil {
+					t.Errorf("DestinationFromCLI() = %v, want nil", destination)
+				}
+				return
+			case tt.wantFile != "":
+				if file, ok := destination.(*FileDestination); !ok || file.path != tt.wantFile {
+					t.Errorf("DestinationFromCLI() = %#v, want a file destination of %s", destination, tt.wantFile)
+				}
+				return
+			}
+
+			record := &DestinationRecord{RequestContext: DestinationRequestContext{RequestID: "request"}}
+			if err := destination.Send(context.Background(), record); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if path != tt.wantPath || query != tt.wantQuery {
+				t.Errorf("destination invoked %s?%s, want %s?%s", path, query, tt.wantPath, tt.wantQuery)
+			}
+			var sent DestinationRecord
+			if err := json.Unmarshal(body, &sent); err != nil || sent.RequestContext.RequestID != "request" {
+				t.Errorf("destination invoked with %s, want the record", body)
+			}
+		})
+	}
+}
+
+func TestAsyncInvokerDestinations(t *testing.T) {
+	tests := []struct {
+		name            string
+		errs            []error
+		eventAge        time.Duration
+		wantSuccess     []DestinationCondition
+		wantFailure     []DestinationCondition
+		wantInvokeCount int
+	}{
+		{
+			name:            "success",
+			wantSuccess:     []DestinationCondition{DestinationConditionSuccess},
+			wantInvokeCount: 1,
+		},
+		{
+			name:            "retries exhausted",
+			errs:            []error{newTestFunctionError(), newTestFunctionError(), newTestFunctionError()},
+			wantFailure:     []DestinationCondition{DestinationConditionRetriesExhausted},
+			wantInvokeCount: 3,
+		},
+		{
+			name:            "event age exceeded",
+			errs:            []error{newTestFunctionError()},
+			eventAge:        10 * time.Millisecond,
+			wantFailure:     []DestinationCondition{DestinationConditionEventAgeExceeded},
+			wantInvokeCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			onSuccess, onFailure := &recordingDestination{}, &recordingDestination{}
+			config := AsyncInvokerConfig{
+				MaximumRetryAttempts: 2,
+				MaximumEventAge:      time.Minute,
+				RetryDelay:           20 * time.Millisecond,
+				FunctionArn:          LambdaFunctionArn("us-east-1", "hello"),
+				OnSuccess:            onSuccess,
+				OnFailure:            onFailure,
+			}
+			if tt.eventAge > 0 {
+				config.MaximumEventAge = tt.eventAge
+			}
+			invokeAsync(t, &scriptedInvoker{errs: tt.errs}, config)
+
+			if got := onSuccess.conditions(); !reflect.DeepEqual(got, tt.wantSuccess) {
+				t.Errorf("on-success records %q, want %q", got, tt.wantSuccess)
+			}
+			if got := onFailure.conditions(); !reflect.DeepEqual(got, tt.wantFailure) {
+				t.Errorf("on-failure records %q, want %q", got, tt.wantFailure)
+			}
+			records := append(onSuccess.records, onFailure.records...)
+			if len(records) == 1 && records[0].RequestContext.ApproximateInvokeCount != tt.wantInvokeCount {
+				t.Errorf("approximate invoke count = %d, want %d", records[0].RequestContext.ApproximateInvokeCount, tt.wantInvokeCount)
+			}
+		})
+	}
+}
+
+func TestAsyncInvokerShutdownDestination(t *testing.T) {
+	onFailure := &recordingDestination{}
+	invoker := &scriptedInvoker{errs: []error{newTestFunctionError()}}
+	asyncInvoker := NewAsyncInvoker(invoker, AsyncInvokerConfig{
+		MaximumRetryAttempts: 2,
+		MaximumEventAge:      time.Hour,
+		RetryDelay:           time.Hour,
+		OnFailure:            onFailure,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		asyncInvoker.Run(ctx)
+	}()
+	if _, err := asyncInvoker.Invoke(ctx, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	for len(invoker.times()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	if err := asyncInvoker.Wait(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+	// the event did not run out of retries, it is dropped with the invoker
+	if got := onFailure.conditions(); len(got) != 0 {
+		t.Errorf("on-failure records %q, want none", got)
+	}
+}
@@ -0,0 +1,295 @@
+package offline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	LambdaUpstreamsName     = "lambda-upstreams"
+	UpstreamPortName        = "upstream-port"
+	WebsocketUpstreamName   = "websocket-upstream"
+	RouterPortName          = "router-port"
+	EnvVarLambdaUpstreams   = "LAMBDA_UPSTREAMS"
+	EnvVarUpstreamPort      = "UPSTREAM_PORT"
+	EnvVarWebsocketUpstream = "WEBSOCKET_UPSTREAM"
+	EnvVarRouterPort        = "ROUTER_PORT"
+	HeaderTargetFunction    = "X-Target-Function"
+)
+
+const (
+	// invokePathPattern matches the invoke API path of a function.
+	invokePathPattern = `^/2015-03-31/functions/([^/]+)/invocations$`
+	// runtimeInvokePath is the only invoke path served by the runtime interface emulator.
+	runtimeInvokePath      = "/2015-03-31/functions/function/invocations"
+	websocketPathPrefix    = "/ws"
+	defaultUpstreamPort    = 8080
+	defaultWebsocketTarget = "ws-gateway:8080"
+)
+
+var invokePathRegexp = regexp.MustCompile(invokePathPattern)
+
+// LambdaRouter emulates the lambda edge, routing invocations of each function to the runtime
+// interface emulator serving it and websocket connections to the websocket emulator. It also
+// serves the lambda management API for the functions of its registry.
+type LambdaRouter struct {
+	// Registered functions, functions without an upstream are routed to {name}:UpstreamPort
+	Registry *FunctionRegistry
+	// Port of the upstreams of functions routed by name
+	UpstreamPort int
+	// Upstream host:port of the websocket emulator
+	WebsocketUpstream string
+	// Receives a JSON access log line per request
+	AccessLog io.Writer
+
+	proxy *httputil.ReverseProxy
+	api   *mux.Router
+	mu    sync.Mutex
+}
+
+func NewLambdaRouter(
+	registry *FunctionRegistry,
+	region, websocketUpstream string,
+	accessLog io.Writer,
+) *LambdaRouter {
+	router := &LambdaRouter{
+		Registry:          registry,
+		UpstreamPort:      defaultUpstreamPort,
+		WebsocketUpstream: websocketUpstream,
+		AccessLog:         accessLog,
+		api:               mux.NewRouter(),
+	}
+	NewLambdaAPI(registry, region).Register(router.api)
+	router.proxy = &httputil.ReverseProxy{
+		// the request is already rewritten to its upstream by ServeHTTP
+		Rewrite:      func(*httputil.ProxyRequest) {},
+		ErrorHandler: router.serveUpstreamError,
+	}
+
+	return router
+}
+
+// accessLogEntry has the fields of the access log of the envoy lambda edge.
+type accessLogEntry struct {
+	Status         int    `json:"status,omitempty"`
+	Method         string `json:"method,omitempty"`
+	Path           string `json:"path,omitempty"`
+	TargetFunction string `json:"target_function,omitempty"`
+	UpstreamHost   string `json:"upstream_host,omitempty"`
+}
+
+func (r *LambdaRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	entry := &accessLogEntry{
+		Method: req.Method,
+		Path:   req.URL.RequestURI(),
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	defer func() {
+		entry.Status = recorder.status
+		r.writeAccessLog(entry)
+	}()
+
+	switch {
+	case req.URL.Path == runtimeInvokePath:
+		writeRouterError(recorder, http.StatusBadRequest, "InvalidFunction", "Reserved function name function.")
+	case invokePathRegexp.MatchString(req.URL.Path):
+		functionName := invokePathRegexp.FindStringSubmatch(req.URL.Path)[1]
+		entry.TargetFunction = functionName
+		entry.UpstreamHost = r.upstream(functionName)
+
+		req.Header.Set(HeaderTargetFunction, functionName)
+		r.forward(recorder, req, entry.UpstreamHost, runtimeInvokePath)
+	case strings.HasPrefix(req.URL.Path, websocketPathPrefix):
+		entry.UpstreamHost = r.WebsocketUpstream
+		r.forward(recorder, req, entry.UpstreamHost, req.URL.Path)
+	case r.api.Match(req, &mux.RouteMatch{}):
+		r.api.ServeHTTP(recorder, req)
+	default:
+		writeRouterError(recorder, http.StatusNotFound, "NOT_FOUND", "No such path supported.")
+	}
+}
+
+// upstream resolves the host:port serving the function, by default the host named after it.
+func (r *LambdaRouter) upstream(functionName string) string {
+	if definition, ok := r.Registry.Lookup(functionName); ok && definition.Upstream != "" {
+		return definition.Upstream
+	}
+
+	return net.JoinHostPort(functionName, strconv.Itoa(r.UpstreamPort))
+}
+
+func (r *LambdaRouter) forward(w http.ResponseWriter, req *http.Request, upstream, path string) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = "http"
+	out.URL.Host = upstream
+	out.URL.Path = path
+	out.URL.RawPath = ""
+	out.Host = upstream
+
+	r.proxy.ServeHTTP(w, out)
+}
+
+// serveUpstreamError reports an unreachable upstream like envoy.
+func (r *LambdaRouter) serveUpstreamError(w http.ResponseWriter, req *http.Request, err error) {
+	zap.L().Warn("failed to proxy request",
+		zap.String("upstream.host", req.URL.Host),
+		zap.Error(err),
+	)
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = fmt.Fprintf(w, "upstream connect error or disconnect/reset before headers. reset reason: %s", err)
+}
+
+func (r *LambdaRouter) writeAccessLog(entry *accessLogEntry) {
+	if r.AccessLog == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		zap.L().Error("failed to marshal access log", zap.Error(err))
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.AccessLog.Write(append(line, '\n'))
+}
+
+func writeRouterError(w http.ResponseWriter, statusCode int, code, message string) {
+	body, err := json.Marshal(map[string]string{
+		"code":    code,
+		"message": message,
+	})
+	if err != nil {
+		http.Error(w, message, statusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// statusRecorder records the status code of a response, while still allowing the proxy to hijack
+// the connection of websocket upgrades.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(statusCode int) {
+	if s.status == 0 {
+		s.status = statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Hijack records the switch of protocols of an upgraded connection, whose response is written
+// directly to the connection by the proxy.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// ParseLambdaUpstream parses an upstream of a function of the form name=host:port.
+func ParseLambdaUpstream(value string) (string, string, error) {
+	name, upstream, ok := strings.Cut(value, "=")
+	if !ok || name == "" || upstream == "" {
+		return "", "", fmt.Errorf("invalid lambda upstream %q, expected name=host:port", value)
+	}
+	if _, _, err := net.SplitHostPort(upstream); err != nil {
+		return "", "", fmt.Errorf("invalid lambda upstream %q: %w", value, err)
+	}
+
+	return name, upstream, nil
+}
+
+// LambdaRouterFromCLI builds a router for the functions configured by LambdaRegistryFlags, with the
+// upstreams configured by LambdaRouterFlags.
+func LambdaRouterFromCLI(cliCtx *cli.Context, accessLog io.Writer) (*LambdaRouter, error) {
+	registry, err := FunctionRegistryFromCLI(cliCtx)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range DefinitionsFromCLI(cliCtx, LambdaUpstreamsName) {
+		name, upstream, err := ParseLambdaUpstream(value)
+		if err != nil {
+			return nil, err
+		}
+		definition, ok := registry.Lookup(name)
+		if !ok {
+			definition = FunctionDefinition{Name: name}
+		}
+		definition.Upstream = upstream
+		registry.Register(definition)
+	}
+
+	router := NewLambdaRouter(
+		registry,
+		cliCtx.String(AwsRegionName),
+		cliCtx.String(WebsocketUpstreamName),
+		accessLog,
+	)
+	router.UpstreamPort = cliCtx.Int(UpstreamPortName)
+
+	return router, nil
+}
+
+func LambdaRouterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    RouterPortName,
+			EnvVars: []string{EnvVarRouterPort},
+			Value:   8080,
+			Usage:   "Port to listen on for lambda invocations and websocket connections",
+		},
+		&cli.GenericFlag{
+			Name:    LambdaUpstreamsName,
+			EnvVars: []string{EnvVarLambdaUpstreams},
+			Value:   &DefinitionsValue{},
+			Usage: "Upstreams of functions that are not served at {name}:{upstream-port}, separated by newlines in the " +
+				"environment. i.e. hello=localhost:9001",
+		},
+		&cli.IntFlag{
+			Name:    UpstreamPortName,
+			EnvVars: []string{EnvVarUpstreamPort},
+			Value:   defaultUpstreamPort,
+			Usage:   "Port of the runtime interface emulator of functions routed by name",
+		},
+		&cli.StringFlag{
+			Name:    WebsocketUpstreamName,
+			EnvVars: []string{EnvVarWebsocketUpstream},
+			Value:   defaultWebsocketTarget,
+			Usage:   "Upstream host:port of the websocket emulator",
+		},
+	}
+}
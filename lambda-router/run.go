@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+func init() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("cannot initialize zap logger: %v", err)
+	}
+	zap.ReplaceGlobals(logger)
+	//nolint:errcheck
+	defer logger.Sync()
+}
+
+func main() {
+	flags := []cli.Flag{
+		&cli.StringFlag{
+			Name:    offline.AwsRegionName,
+			EnvVars: []string{offline.EnvVarAwsRegion},
+			Value:   "us-east-1",
+			Usage:   "AWS region to use",
+		},
+	}
+	flags = append(flags, offline.LambdaRouterFlags()...)
+	flags = append(flags, offline.LambdaRegistryFlags()...)
+
+	app := &cli.App{
+		Name:   "lambda-router",
+		Usage:  "Route lambda invocations to the runtime interface emulator of each function, like the lambda edge",
+		Flags:  flags,
+		Before: offline.LoadRegistryFile,
+		Action: func(cliCtx *cli.Context) error {
+			router, err := offline.LambdaRouterFromCLI(cliCtx, os.Stdout)
+			if err != nil {
+				return err
+			}
+
+			server := http.Server{
+				Addr:              fmt.Sprintf(":%d", cliCtx.Int(offline.RouterPortName)),
+				Handler:           router,
+				ReadHeaderTimeout: time.Second * 1,
+			}
+
+			ctx := offline.TrapProcess()
+			serverErr := make(chan error, 1)
+			go func() {
+				zap.L().Info("starting lambda router",
+					zap.Int("port", cliCtx.Int(offline.RouterPortName)),
+					zap.String("websocket.upstream", router.WebsocketUpstream),
+				)
+				err := server.ListenAndServe()
+				if !errors.Is(err, http.ErrServerClosed) {
+					zap.L().Error("failed to serve lambda router", zap.Error(err))
+					serverErr <- err
+				}
+			}()
+
+			defer func() {
+				_ = server.Shutdown(context.Background())
+			}()
+
+			select {
+			case err := <-serverErr:
+				return err
+			case <-ctx.Done():
+				zap.L().Info("shutting down server")
+				return nil
+			}
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
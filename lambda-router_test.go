@@ -0,0 +1,312 @@
+package offline
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// upstreamRequest is a request received by a test upstream of the router.
+type upstreamRequest struct {
+	path           string
+	targetFunction string
+	body           string
+}
+
+// newTestUpstream records the requests it receives, and echoes the messages of websocket
+// connections.
+func newTestUpstream(t *testing.T) (*httptest.Server, func() []upstreamRequest) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []upstreamRequest
+	)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, upstreamRequest{
+			path:           r.URL.Path,
+			targetFunction: r.Header.Get(HeaderTargetFunction),
+			body:           string(body),
+		})
+		mu.Unlock()
+
+		if !websocket.IsWebSocketUpgrade(r) {
+			_, _ = io.WriteString(w, `"ok"`)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []upstreamRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]upstreamRequest(nil), requests...)
+	}
+}
+
+// accessLogLines passes on the lines of an access log, which is written once the response is sent.
+type accessLogLines chan []byte
+
+func (l accessLogLines) Write(line []byte) (int, error) {
+	l <- append([]byte(nil), line...)
+	return len(line), nil
+}
+
+func (l accessLogLines) next(t *testing.T) accessLogEntry {
+	t.Helper()
+
+	var entry accessLogEntry
+	select {
+	case line := <-l:
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("invalid access log %q: %v", line, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request was not logged")
+	}
+	return entry
+}
+
+// newTestLambdaRouter serves a router built from the arguments, returning its access log.
+func newTestLambdaRouter(t *testing.T, args ...string) (*httptest.Server, accessLogLines) {
+	t.Helper()
+
+	cliCtx := newTestCLIContext(t, LambdaRouterFlags(), args...)
+	accessLog := make(accessLogLines, 1)
+	router, err := LambdaRouterFromCLI(cliCtx, accessLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return server, accessLog
+}
+
+func upstreamHost(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serverURL.Host
+}
+
+func TestLambdaRouter(t *testing.T) {
+	upstream, requests := newTestUpstream(t)
+	router, accessLog := newTestLambdaRouter(t, "--lambda-upstreams", "hello="+upstreamHost(t, upstream))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantCode   string
+		wantTarget string
+	}{
+		{
+			name:       "invoke",
+			method:     http.MethodPost,
+			path:       "/2015-03-31/functions/hello/invocations",
+			wantStatus: http.StatusOK,
+			wantBody:   `"ok"`,
+			wantTarget: "hello",
+		},
+		{
+			name:       "reserved name",
+			method:     http.MethodPost,
+			path:       runtimeInvokePath,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   "InvalidFunction",
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodGet,
+			path:       "/2015-03-31/layers",
+			wantStatus: http.StatusNotFound,
+			wantCode:   "NOT_FOUND",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(requests())
+
+			req, err := http.NewRequest(tt.method, router.URL+tt.path, strings.NewReader(`{"name":"world"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				var routerErr struct {
+					Code string `json:"code"`
+				}
+				if err := json.Unmarshal(body, &routerErr); err != nil || routerErr.Code != tt.wantCode {
+					t.Errorf("body = %s, want the error code %s", body, tt.wantCode)
+				}
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+
+			entry := accessLog.next(t)
+			if entry.Status != tt.wantStatus || entry.Path != tt.path || entry.TargetFunction != tt.wantTarget {
+				t.Errorf("access log = %+v, want %d %s to %q", entry, tt.wantStatus, tt.path, tt.wantTarget)
+			}
+
+			proxied := requests()[before:]
+			if tt.wantTarget == "" {
+				if len(proxied) != 0 {
+					t.Errorf("proxied %+v, want the router to respond", proxied)
+				}
+				return
+			}
+			// the invocation is forwarded to the runtime interface emulator serving the function
+			want := upstreamRequest{path: runtimeInvokePath, targetFunction: tt.wantTarget, body: `{"name":"world"}`}
+			if len(proxied) != 1 || proxied[0] != want {
+				t.Errorf("proxied %+v, want %+v", proxied, want)
+			}
+			if entry.UpstreamHost != upstreamHost(t, upstream) {
+				t.Errorf("access log upstream = %s, want %s", entry.UpstreamHost, upstreamHost(t, upstream))
+			}
+		})
+	}
+}
+
+func TestLambdaRouterUpstreamPort(t *testing.T) {
+	// functions without an upstream are routed to the host named after them
+	router, accessLog := newTestLambdaRouter(t, "--upstream-port", "9001")
+
+	resp, err := http.Post(router.URL+"/2015-03-31/functions/127.0.0.1/invocations", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d for an unreachable upstream", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	if entry := accessLog.next(t); entry.UpstreamHost != "127.0.0.1:9001" {
+		t.Errorf("access log upstream = %s, want 127.0.0.1:9001", entry.UpstreamHost)
+	}
+}
+
+func TestLambdaRouterWebsocket(t *testing.T) {
+	upstream, requests := newTestUpstream(t)
+	router, accessLog := newTestLambdaRouter(t, "--websocket-upstream", upstreamHost(t, upstream))
+
+	wsURL := "ws" + strings.TrimPrefix(router.URL, "http") + "/ws/connections"
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "hello" {
+		t.Errorf("message = %q, want the echo of the upstream", message)
+	}
+
+	if proxied := requests(); len(proxied) != 1 || proxied[0].path != "/ws/connections" {
+		t.Errorf("proxied %+v, want the connection to /ws/connections", proxied)
+	}
+
+	// the upgraded connection is logged once it is closed
+	conn.Close()
+	if entry := accessLog.next(t); entry.Status != http.StatusSwitchingProtocols || entry.UpstreamHost != upstreamHost(t, upstream) {
+		t.Errorf("access log = %+v, want %d to %s", entry, http.StatusSwitchingProtocols, upstreamHost(t, upstream))
+	}
+}
+
+func TestParseLambdaUpstream(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantName     string
+		wantUpstream string
+		wantErr      bool
+	}{
+		{value: "hello=localhost:9001", wantName: "hello", wantUpstream: "localhost:9001"},
+		{value: "hello=localhost", wantErr: true},
+		{value: "hello", wantErr: true},
+		{value: "=localhost:9001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			name, upstream, err := ParseLambdaUpstream(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLambdaUpstream(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if name != tt.wantName || upstream != tt.wantUpstream {
+				t.Errorf("ParseLambdaUpstream(%q) = %q, %q, want %q, %q", tt.value, name, upstream, tt.wantName, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestLambdaRouterFromCLIUpstreams(t *testing.T) {
+	t.Setenv(EnvVarLambdaUpstreams, "hello=hello-v1:8080\ngoodbye=localhost:9002")
+
+	cliCtx := newTestCLIContext(t, LambdaRouterFlags())
+	router, err := LambdaRouterFromCLI(cliCtx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// upstreams are separated by newlines in the environment
+	for name, want := range map[string]string{"hello": "hello-v1:8080", "goodbye": "localhost:9002", "other": "other:8080"} {
+		if got := router.upstream(name); got != want {
+			t.Errorf("upstream(%s) = %s, want %s", name, got, want)
+		}
+	}
+
+	cliCtx = newTestCLIContext(t, LambdaRouterFlags(), "--lambda-upstreams", "hello")
+	if _, err := LambdaRouterFromCLI(cliCtx, nil); err == nil {
+		t.Error("LambdaRouterFromCLI() error = nil, want the invalid upstream reported")
+	}
+}
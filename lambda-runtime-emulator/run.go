@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+func init() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatalf("cannot initialize zap logger: %v", err)
+	}
+	zap.ReplaceGlobals(logger)
+	//nolint:errcheck
+	defer logger.Sync()
+}
+
+func main() {
+	// the region of the functions and the endpoint of kinesis destinations
+	flags := offline.KinesisFlags()
+	flags = append(flags, offline.LambdaRuntimeFlags()...)
+	flags = append(flags, offline.LambdaAsyncFlags()...)
+	flags = append(flags, offline.LambdaDestinationFlags()...)
+	flags = append(flags, offline.LambdaRegistryFileFlags()...)
+
+	app := &cli.App{
+		Name:   "lambda-runtime-emulator",
+		Usage:  "Run lambda functions from their bootstrap binaries behind the lambda invoke API",
+		Flags:  flags,
+		Before: offline.LoadRegistryFile,
+		Action: func(cliCtx *cli.Context) error {
+			invokeServer, err := offline.RuntimeInvokeServerFromCLI(cliCtx)
+			if err != nil {
+				return err
+			}
+			defer invokeServer.Close()
+
+			server := http.Server{
+				Addr:              fmt.Sprintf(":%d", cliCtx.Int(offline.RuntimeAPIPortName)),
+				Handler:           invokeServer.Handler(),
+				ReadHeaderTimeout: time.Second * 1,
+			}
+
+			ctx := offline.TrapProcess()
+			serverErr := make(chan error, 1)
+			go func() {
+				zap.L().Info("starting lambda invoke server", zap.Int("port", cliCtx.Int(offline.RuntimeAPIPortName)))
+				err := server.ListenAndServe()
+				if !errors.Is(err, http.ErrServerClosed) {
+					zap.L().Error("failed to serve lambda invocations", zap.Error(err))
+					serverErr <- err
+				}
+			}()
+
+			defer func() {
+				_ = server.Shutdown(context.Background())
+			}()
+
+			select {
+			case err := <-serverErr:
+				return err
+			case <-ctx.Done():
+				zap.L().Info("shutting down server")
+				return nil
+			}
+		},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
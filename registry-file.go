@@ -0,0 +1,232 @@
+package offline
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	LambdaRegistryFileName   = "lambda-registry-file"
+	EnvVarLambdaRegistryFile = "LAMBDA_REGISTRY_FILE"
+)
+
+// RegistryFile declares the functions of a project, replacing the per-function flags of the
+// emulators. YAML and JSON files are both accepted, i.e.
+//
+//	endpoint: http://api-gateway:8080
+//	timeout: 30s
+//	functions:
+//	  connect:
+//	    name: on-connect
+//	    qualifier: live
+//	    timeout: 10s
+//	    upstream: on-connect:8080
+//
+// where each function is keyed by the name the emulators use for it, i.e. connect and disconnect
+// for the websocket emulator, or function for the others. Functions with a bootstrap are run by
+// the lambda runtime emulator.
+type RegistryFile struct {
+	// Endpoint to invoke lambda functions, like the lambda endpoint flag
+	Endpoint string `yaml:"endpoint"`
+	// Timeout of the functions which do not declare one
+	Timeout string `yaml:"timeout"`
+	// Functions by the name the emulators use for them
+	Functions map[string]RegistryFileFunction `yaml:"functions"`
+}
+
+// RegistryFileFunction declares a function of a RegistryFile.
+type RegistryFileFunction struct {
+	// Name of the lambda function, the key of the function when empty
+	Name string `yaml:"name"`
+	// Endpoint to invoke the function, like the invoke endpoint flag
+	Endpoint string `yaml:"endpoint"`
+	// Version or alias of the function to invoke, like the qualifier flag
+	Qualifier string `yaml:"qualifier"`
+	// Maximum duration of an invocation of the function
+	Timeout string `yaml:"timeout"`
+	// Reserved concurrency of the function, like the reserved concurrency flag
+	ReservedConcurrency *int `yaml:"reservedConcurrency"`
+	// Runtime identifier, i.e. provided.al2
+	Runtime string `yaml:"runtime"`
+	// Handler of the function
+	Handler string `yaml:"handler"`
+	// Memory size of the function, in MB
+	MemorySize int `yaml:"memorySize"`
+	// Environment variables of the function
+	Environment map[string]string `yaml:"environment"`
+	// host:port of the runtime interface emulator serving the function
+	Upstream string `yaml:"upstream"`
+	// Path of the bootstrap executable run by the built-in runtime API, like the runtime functions flag
+	Bootstrap string `yaml:"bootstrap"`
+}
+
+// ReadRegistryFile reads a YAML or JSON registry file.
+func ReadRegistryFile(path string) (*RegistryFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry file: %w", err)
+	}
+
+	// YAML is a superset of JSON, so a single decoder reads both
+	file := &RegistryFile{}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse registry file %s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Definitions returns the functions of the file to register.
+func (f *RegistryFile) Definitions() ([]FunctionDefinition, error) {
+	definitions := make([]FunctionDefinition, 0, len(f.Functions))
+	for key, function := range f.Functions {
+		definition := FunctionDefinition{
+			Name:        function.Name,
+			Runtime:     function.Runtime,
+			Handler:     function.Handler,
+			MemorySize:  function.MemorySize,
+			Environment: function.Environment,
+			Upstream:    function.Upstream,
+		}
+		if definition.Name == "" {
+			definition.Name = key
+		}
+		if function.Timeout == "" {
+			function.Timeout = f.Timeout
+		}
+		if function.Timeout != "" {
+			timeout, err := time.ParseDuration(function.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout of function %s: %w", key, err)
+			}
+			definition.Timeout = timeout
+		}
+		definitions = append(definitions, definition)
+	}
+
+	return definitions, nil
+}
+
+// flagValues maps the file to the values of the emulator flags it replaces.
+func (f *RegistryFile) flagValues() map[string]string {
+	values := make(map[string]string)
+	if f.Endpoint != "" {
+		values[LambdaEndpointName] = f.Endpoint
+	}
+
+	var runtimeFunctions []string
+	for key, function := range f.Functions {
+		if function.Bootstrap != "" {
+			runtimeFunctions = append(runtimeFunctions, f.runtimeFunctionValue(key, function))
+		}
+		if function.Name != "" {
+			values[FunctionNameForFunction(key)] = function.Name
+		} else {
+			values[FunctionNameForFunction(key)] = key
+		}
+		if function.Endpoint != "" {
+			values[InvokeEndpointNameForFunction(key)] = function.Endpoint
+		}
+		if function.Qualifier != "" {
+			values[QualifierNameForFunction(key)] = function.Qualifier
+		}
+		if function.ReservedConcurrency != nil {
+			values[ReservedConcurrencyNameForFunction(key)] = strconv.Itoa(*function.ReservedConcurrency)
+		}
+	}
+	if len(runtimeFunctions) > 0 {
+		sort.Strings(runtimeFunctions)
+		values[RuntimeFunctionsName] = strings.Join(runtimeFunctions, "\n")
+	}
+
+	return values
+}
+
+// runtimeFunctionValue maps a function of the file to a definition of the runtime functions flag,
+// its reserved concurrency bounding the sandboxes which run it.
+func (f *RegistryFile) runtimeFunctionValue(key string, function RegistryFileFunction) string {
+	name := function.Name
+	if name == "" {
+		name = key
+	}
+	fields := []string{"name=" + name, "bootstrap=" + function.Bootstrap}
+	if function.Handler != "" {
+		fields = append(fields, "handler="+function.Handler)
+	}
+	if function.Timeout == "" {
+		function.Timeout = f.Timeout
+	}
+	if function.Timeout != "" {
+		fields = append(fields, "timeout="+function.Timeout)
+	}
+	if function.MemorySize > 0 {
+		fields = append(fields, "memory="+strconv.Itoa(function.MemorySize))
+	}
+	// a function without concurrency cannot run a sandbox, which the runtime functions flag rejects
+	if function.ReservedConcurrency != nil && *function.ReservedConcurrency > 0 {
+		fields = append(fields, "concurrency="+strconv.Itoa(*function.ReservedConcurrency))
+	}
+
+	keys := make([]string, 0, len(function.Environment))
+	for key := range function.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("env=%s=%s", key, function.Environment[key]))
+	}
+
+	return strings.Join(fields, ";")
+}
+
+// LoadRegistryFile sets the flags of the emulator from the registry file configured by
+// LambdaRegistryFlags, flags set on the command line or by their environment variables take
+// precedence over the file. It is meant to be used as the Before hook of the emulator apps.
+func LoadRegistryFile(cliCtx *cli.Context) error {
+	path := cliCtx.String(LambdaRegistryFileName)
+	if path == "" {
+		return nil
+	}
+
+	file, err := ReadRegistryFile(path)
+	if err != nil {
+		return err
+	}
+
+	defined := make(map[string]bool)
+	for _, ctx := range cliCtx.Lineage() {
+		if ctx.Command != nil {
+			for _, flag := range ctx.Command.Flags {
+				for _, name := range flag.Names() {
+					defined[name] = true
+				}
+			}
+		}
+		if ctx.App != nil {
+			for _, flag := range ctx.App.Flags {
+				for _, name := range flag.Names() {
+					defined[name] = true
+				}
+			}
+		}
+	}
+
+	for name, value := range file.flagValues() {
+		// the file may declare functions of other emulators, which do not have flags here
+		if !defined[name] || cliCtx.IsSet(name) {
+			continue
+		}
+		if err := cliCtx.Set(name, value); err != nil {
+			return fmt.Errorf("invalid registry file value of %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
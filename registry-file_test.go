@@ -0,0 +1,250 @@
+package offline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func writeRegistryFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadRegistryFile(t *testing.T) {
+	concurrency := 2
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		want     *RegistryFile
+		wantErr  bool
+		noCreate bool
+	}{
+		{
+			name: "yaml",
+			file: "registry.yaml",
+			content: `
+endpoint: http://api-gateway:8080
+timeout: 30s
+functions:
+  connect:
+    name: on-connect
+    qualifier: live
+    timeout: 10s
+    reservedConcurrency: 2
+    environment:
+      TABLE: connections
+    upstream: on-connect:8080
+`,
+			want: &RegistryFile{
+				Endpoint: "http://api-gateway:8080",
+				Timeout:  "30s",
+				Functions: map[string]RegistryFileFunction{
+					"connect": {
+						Name:                "on-connect",
+						Qualifier:           "live",
+						Timeout:             "10s",
+						ReservedConcurrency: &concurrency,
+						Environment:         map[string]string{"TABLE": "connections"},
+						Upstream:            "on-connect:8080",
+					},
+				},
+			},
+		},
+		{
+			name:    "json",
+			file:    "registry.json",
+			content: `{"endpoint": "http://localhost:8080", "functions": {"function": {"runtime": "provided.al2", "memorySize": 128}}}`,
+			want: &RegistryFile{
+				Endpoint: "http://localhost:8080",
+				Functions: map[string]RegistryFileFunction{
+					"function": {Runtime: "provided.al2", MemorySize: 128},
+				},
+			},
+		},
+		{
+			name:    "empty",
+			file:    "registry.yaml",
+			content: "",
+			want:    &RegistryFile{},
+		},
+		{
+			name:    "invalid",
+			file:    "registry.yaml",
+			content: "functions: [",
+			wantErr: true,
+		},
+		{
+			name:     "missing",
+			file:     "registry.yaml",
+			noCreate: true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if !tt.noCreate {
+				path = writeRegistryFile(t, tt.file, tt.content)
+			}
+
+			got, err := ReadRegistryFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadRegistryFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadRegistryFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryFileDefinitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    RegistryFile
+		want    []FunctionDefinition
+		wantErr bool
+	}{
+		{
+			name: "name defaults to the key",
+			file: RegistryFile{Functions: map[string]RegistryFileFunction{
+				"hello": {Runtime: "provided.al2", Handler: "bootstrap", MemorySize: 256, Upstream: "hello:8080"},
+			}},
+			want: []FunctionDefinition{
+				{Name: "hello", Runtime: "provided.al2", Handler: "bootstrap", MemorySize: 256, Upstream: "hello:8080"},
+			},
+		},
+		{
+			name: "timeout defaults to the file timeout",
+			file: RegistryFile{Timeout: "30s", Functions: map[string]RegistryFileFunction{
+				"connect":    {Name: "on-connect", Timeout: "10s"},
+				"disconnect": {Name: "on-disconnect"},
+			}},
+			want: []FunctionDefinition{
+				{Name: "on-connect", Timeout: 10 * time.Second},
+				{Name: "on-disconnect", Timeout: 30 * time.Second},
+			},
+		},
+		{
+			name: "invalid timeout",
+			file: RegistryFile{Functions: map[string]RegistryFileFunction{
+				"hello": {Timeout: "soon"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "invalid file timeout",
+			file: RegistryFile{Timeout: "10", Functions: map[string]RegistryFileFunction{
+				"hello": {},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.file.Definitions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Definitions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Definitions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryFileFlagValues(t *testing.T) {
+	concurrency := 0
+	runtimeConcurrency := 5
+
+	tests := []struct {
+		name string
+		file RegistryFile
+		want map[string]string
+	}{
+		{
+			name: "empty",
+			file: RegistryFile{},
+			want: map[string]string{},
+		},
+		{
+			name: "default function",
+			file: RegistryFile{
+				Endpoint: "http://localhost:8080",
+				Functions: map[string]RegistryFileFunction{
+					FunctionNamePrefix: {Name: "hello", Qualifier: "2"},
+				},
+			},
+			want: map[string]string{
+				LambdaEndpointName:                           "http://localhost:8080",
+				FunctionNameForFunction(FunctionNamePrefix):  "hello",
+				QualifierNameForFunction(FunctionNamePrefix): "2",
+			},
+		},
+		{
+			name: "named function",
+			file: RegistryFile{Functions: map[string]RegistryFileFunction{
+				"connect": {
+					Endpoint:            "http://on-connect:8080/2015-03-31/functions/function/invocations",
+					ReservedConcurrency: &concurrency,
+				},
+			}},
+			want: map[string]string{
+				FunctionNameForFunction("connect"):            "connect",
+				InvokeEndpointNameForFunction("connect"):      "http://on-connect:8080/2015-03-31/functions/function/invocations",
+				ReservedConcurrencyNameForFunction("connect"): "0",
+			},
+		},
+		{
+			name: "runtime functions",
+			file: RegistryFile{
+				Timeout: "30s",
+				Functions: map[string]RegistryFileFunction{
+					FunctionNamePrefix: {
+						Name:                "hello",
+						Bootstrap:           "./bin/hello",
+						Timeout:             "3s",
+						MemorySize:          256,
+						ReservedConcurrency: &runtimeConcurrency,
+						Environment:         map[string]string{"B": "2", "A": "1"},
+					},
+					"connect": {Bootstrap: "./bin/connect", Handler: "connect"},
+				},
+			},
+			want: map[string]string{
+				FunctionNameForFunction(FunctionNamePrefix):            "hello",
+				ReservedConcurrencyNameForFunction(FunctionNamePrefix): "5",
+				FunctionNameForFunction("connect"):                     "connect",
+				RuntimeFunctionsName: "name=connect;bootstrap=./bin/connect;handler=connect;timeout=30s\n" +
+					"name=hello;bootstrap=./bin/hello;timeout=3s;memory=256;concurrency=5;env=A=1;env=B=2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.file.flagValues(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("flagValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package offline
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	LambdaFunctionsName   = "lambda-functions"
+	EnvVarLambdaFunctions = "LAMBDA_FUNCTIONS"
+)
+
+const (
+	defaultFunctionRuntime    = "provided.al2"
+	defaultFunctionHandler    = "bootstrap"
+	defaultFunctionTimeout    = 3 * time.Second
+	defaultFunctionMemorySize = 128
+	lastModifiedLayout        = "2006-01-02T15:04:05.000-0700"
+)
+
+// functionRegistryKey is the app metadata key of the registry built by FunctionRegistryFromCLI.
+const functionRegistryKey = "offline.functionRegistry"
+
+var registryMu sync.Mutex
+
+// FunctionDefinition describes a function of the emulated lambda service.
+type FunctionDefinition struct {
+	// Name of the function
+	Name string
+	// Runtime identifier, i.e. provided.al2
+	Runtime string
+	// Handler of the function
+	Handler string
+	// Maximum duration of an invocation, the timeout of the invoker when zero
+	Timeout time.Duration
+	// Memory size of the function, in MB
+	MemorySize int
+	// Environment variables of the function
+	Environment map[string]string
+	// host:port of the runtime interface emulator serving the function, empty to route by name
+	Upstream string
+
+	lastModified time.Time
+}
+
+// InvokeEndpoint is the endpoint to invoke the function at its upstream.
+func (d FunctionDefinition) InvokeEndpoint() string {
+	return lambdaInvokeEndpoint("http://"+d.Upstream, FunctionNamePrefix)
+}
+
+// FunctionConfiguration is the configuration of a function returned by the lambda API.
+type FunctionConfiguration struct {
+	FunctionName     string                 `json:"FunctionName"`
+	FunctionArn      string                 `json:"FunctionArn"`
+	Runtime          string                 `json:"Runtime"`
+	Role             string                 `json:"Role"`
+	Handler          string                 `json:"Handler"`
+	CodeSize         int64                  `json:"CodeSize"`
+	Description      string                 `json:"Description"`
+	Timeout          int                    `json:"Timeout"`
+	MemorySize       int                    `json:"MemorySize"`
+	LastModified     string                 `json:"LastModified"`
+	CodeSha256       string                 `json:"CodeSha256"`
+	Version          string                 `json:"Version"`
+	Environment      *FunctionEnvironment   `json:"Environment,omitempty"`
+	TracingConfig    map[string]string      `json:"TracingConfig"`
+	State            string                 `json:"State"`
+	LastUpdateStatus string                 `json:"LastUpdateStatus"`
+	PackageType      string                 `json:"PackageType"`
+	Architectures    []string               `json:"Architectures"`
+	EphemeralStorage map[string]interface{} `json:"EphemeralStorage"`
+}
+
+type FunctionEnvironment struct {
+	Variables map[string]string `json:"Variables"`
+}
+
+// Configuration describes the function the way the lambda API does.
+func (d FunctionDefinition) Configuration(region string) FunctionConfiguration {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = defaultFunctionTimeout
+	}
+
+	configuration := FunctionConfiguration{
+		FunctionName:     d.Name,
+		FunctionArn:      LambdaFunctionArn(region, d.Name),
+		Runtime:          d.Runtime,
+		Role:             fmt.Sprintf("arn:aws:iam::%s:role/canned-role", cannedAccountID),
+		Handler:          d.Handler,
+		Timeout:          int(timeout / time.Second),
+		MemorySize:       d.MemorySize,
+		LastModified:     d.lastModified.Format(lastModifiedLayout),
+		Version:          latestVersion,
+		TracingConfig:    map[string]string{"Mode": "PassThrough"},
+		State:            "Active",
+		LastUpdateStatus: "Successful",
+		PackageType:      "Zip",
+		Architectures:    []string{"x86_64"},
+		EphemeralStorage: map[string]interface{}{"Size": 512},
+	}
+	if len(d.Environment) > 0 {
+		configuration.Environment = &FunctionEnvironment{Variables: d.Environment}
+	}
+
+	return configuration
+}
+
+// ParseFunctionDefinition parses a function definition of the form
+// name=hello;runtime=provided.al2;handler=bootstrap;timeout=3s;memory=128;env=KEY=VALUE;upstream=hello:8080
+// where every field other than the name is optional and env may be repeated.
+func ParseFunctionDefinition(value string) (FunctionDefinition, error) {
+	definition := FunctionDefinition{}
+	for _, field := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return definition, fmt.Errorf("invalid function field %q", field)
+		}
+
+		var err error
+		switch key {
+		case "name":
+			definition.Name = val
+		case "runtime":
+			definition.Runtime = val
+		case "handler":
+			definition.Handler = val
+		case "timeout":
+			definition.Timeout, err = time.ParseDuration(val)
+		case "memory":
+			definition.MemorySize, err = strconv.Atoi(val)
+		case "env":
+			envKey, envVal, _ := strings.Cut(val, "=")
+			if definition.Environment == nil {
+				definition.Environment = make(map[string]string)
+			}
+			definition.Environment[envKey] = envVal
+		case "upstream":
+			definition.Upstream = val
+		default:
+			return definition, fmt.Errorf("unknown function field %q", key)
+		}
+		if err != nil {
+			return definition, fmt.Errorf("invalid function %s %q: %w", key, val, err)
+		}
+	}
+
+	if definition.Name == "" {
+		return definition, fmt.Errorf("function %q requires a name", value)
+	}
+	if definition.Upstream != "" {
+		if _, _, err := net.SplitHostPort(definition.Upstream); err != nil {
+			return definition, fmt.Errorf("invalid function upstream %q: %w", definition.Upstream, err)
+		}
+	}
+
+	return definition, nil
+}
+
+// FunctionRegistry holds the functions of the emulated lambda service.
+type FunctionRegistry struct {
+	mu        sync.RWMutex
+	functions map[string]FunctionDefinition
+}
+
+func NewFunctionRegistry() *FunctionRegistry {
+	return &FunctionRegistry{
+		functions: make(map[string]FunctionDefinition),
+	}
+}
+
+// Register adds the function to the registry, replacing any function of the same name.
+func (r *FunctionRegistry) Register(definition FunctionDefinition) {
+	if definition.Runtime == "" {
+		definition.Runtime = defaultFunctionRuntime
+	}
+	if definition.Handler == "" {
+		definition.Handler = defaultFunctionHandler
+	}
+	if definition.MemorySize <= 0 {
+		definition.MemorySize = defaultFunctionMemorySize
+	}
+	definition.lastModified = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions[definition.Name] = definition
+}
+
+// Lookup finds a function by its name, qualified name or ARN.
+func (r *FunctionRegistry) Lookup(nameOrArn string) (FunctionDefinition, bool) {
+	name, _ := SplitFunctionName(nameOrArn)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	definition, ok := r.functions[name]
+	return definition, ok
+}
+
+// List returns the functions of the registry ordered by name.
+func (r *FunctionRegistry) List() []FunctionDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definitions := make([]FunctionDefinition, 0, len(r.functions))
+	for _, definition := range r.functions {
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+
+	return definitions
+}
+
+// FunctionRegistryFromCLI returns the registry of the functions declared by the registry file and
+// the functions flag, which takes precedence over the file. The registry is built once per command
+// and shared by the invokers built from it.
+func FunctionRegistryFromCLI(cliCtx *cli.Context) (*FunctionRegistry, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if registry, ok := cliCtx.App.Metadata[functionRegistryKey].(*FunctionRegistry); ok {
+		return registry, nil
+	}
+	registry, err := newFunctionRegistryFromCLI(cliCtx)
+	if err != nil {
+		return nil, err
+	}
+	if cliCtx.App.Metadata == nil {
+		cliCtx.App.Metadata = make(map[string]interface{})
+	}
+	cliCtx.App.Metadata[functionRegistryKey] = registry
+
+	return registry, nil
+}
+
+func newFunctionRegistryFromCLI(cliCtx *cli.Context) (*FunctionRegistry, error) {
+	registry := NewFunctionRegistry()
+	if path := cliCtx.String(LambdaRegistryFileName); path != "" {
+		file, err := ReadRegistryFile(path)
+		if err != nil {
+			return nil, err
+		}
+		definitions, err := file.Definitions()
+		if err != nil {
+			return nil, err
+		}
+		for _, definition := range definitions {
+			registry.Register(definition)
+		}
+	}
+
+	for _, value := range DefinitionsFromCLI(cliCtx, LambdaFunctionsName) {
+		definition, err := ParseFunctionDefinition(value)
+		if err != nil {
+			return nil, err
+		}
+		registry.Register(definition)
+	}
+
+	return registry, nil
+}
+
+// LambdaRegistryFileFlags configure the registry file loaded by LoadRegistryFile, for emulators which
+// do not invoke functions by LambdaRegistryFlags.
+func LambdaRegistryFileFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    LambdaRegistryFileName,
+			EnvVars: []string{EnvVarLambdaRegistryFile},
+			Usage: "YAML or JSON file declaring the functions, their endpoints, qualifiers and timeouts. " +
+				"Flags and environment variables take precedence over the file",
+		},
+	}
+}
+
+func LambdaRegistryFlags() []cli.Flag {
+	return append(LambdaRegistryFileFlags(),
+		&cli.GenericFlag{
+			Name:    LambdaFunctionsName,
+			EnvVars: []string{EnvVarLambdaFunctions},
+			Value:   &DefinitionsValue{},
+			Usage: "Functions of the emulated lambda service, separated by newlines in the environment. " +
+				"i.e. name=hello;runtime=provided.al2;timeout=3s;memory=128;env=KEY=VALUE;upstream=hello:8080",
+		},
+	)
+}
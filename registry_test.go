@@ -0,0 +1,196 @@
+package offline
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFunctionDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    FunctionDefinition
+		wantErr bool
+	}{
+		{name: "name only", value: "name=hello", want: FunctionDefinition{Name: "hello"}},
+		{
+			name:  "every field",
+			value: "name=hello; runtime=go1.x;handler=main;timeout=10s;memory=256;env=A=1,2;env=B;upstream=hello-v1:8080",
+			want: FunctionDefinition{
+				Name:        "hello",
+				Runtime:     "go1.x",
+				Handler:     "main",
+				Timeout:     10 * time.Second,
+				MemorySize:  256,
+				Environment: map[string]string{"A": "1,2", "B": ""},
+				Upstream:    "hello-v1:8080",
+			},
+		},
+		{name: "without name", value: "timeout=3s", wantErr: true},
+		{name: "invalid field", value: "name=hello;debug", wantErr: true},
+		{name: "unknown field", value: "name=hello;role=admin", wantErr: true},
+		{name: "invalid timeout", value: "name=hello;timeout=3", wantErr: true},
+		{name: "invalid memory", value: "name=hello;memory=large", wantErr: true},
+		{name: "invalid upstream", value: "name=hello;upstream=hello", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFunctionDefinition(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFunctionDefinition(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFunctionDefinition(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitFunctionName(t *testing.T) {
+	tests := []struct {
+		nameOrArn     string
+		wantName      string
+		wantQualifier string
+	}{
+		{nameOrArn: "hello", wantName: "hello"},
+		{nameOrArn: "hello:live", wantName: "hello", wantQualifier: "live"},
+		{nameOrArn: "arn:aws:lambda:us-east-1:000000000000:function:hello", wantName: "hello"},
+		{nameOrArn: "arn:aws:lambda:us-east-1:000000000000:function:hello:2", wantName: "hello", wantQualifier: "2"},
+		{nameOrArn: "arn:aws:lambda:us-east-1", wantName: "arn:aws:lambda:us-east-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.nameOrArn, func(t *testing.T) {
+			name, qualifier := SplitFunctionName(tt.nameOrArn)
+			if name != tt.wantName || qualifier != tt.wantQualifier {
+				t.Errorf("SplitFunctionName(%q) = %q, %q, want %q, %q", tt.nameOrArn, name, qualifier, tt.wantName, tt.wantQualifier)
+			}
+		})
+	}
+}
+
+func TestFunctionRegistry(t *testing.T) {
+	registry := NewFunctionRegistry()
+	registry.Register(FunctionDefinition{Name: "world", Timeout: 10 * time.Second})
+	registry.Register(FunctionDefinition{Name: "hello"})
+
+	definition, ok := registry.Lookup("hello")
+	if !ok {
+		t.Fatal("Lookup(hello) found no function")
+	}
+	// the timeout is left to the invoker when the function does not declare one
+	want := FunctionDefinition{
+		Name:       "hello",
+		Runtime:    defaultFunctionRuntime,
+		Handler:    defaultFunctionHandler,
+		MemorySize: defaultFunctionMemorySize,
+	}
+	definition.lastModified = time.Time{}
+	if !reflect.DeepEqual(definition, want) {
+		t.Errorf("Lookup(hello) = %+v, want %+v", definition, want)
+	}
+
+	for _, nameOrArn := range []string{"world", "world:live", "arn:aws:lambda:us-east-1:000000000000:function:world:live"} {
+		if definition, ok := registry.Lookup(nameOrArn); !ok || definition.Name != "world" || definition.Timeout != 10*time.Second {
+			t.Errorf("Lookup(%s) = %+v, %v, want the world function", nameOrArn, definition, ok)
+		}
+	}
+	if _, ok := registry.Lookup("goodbye"); ok {
+		t.Error("Lookup(goodbye) found a function which is not registered")
+	}
+
+	var names []string
+	for _, definition := range registry.List() {
+		names = append(names, definition.Name)
+	}
+	if want := []string{"hello", "world"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() = %q, want %q", names, want)
+	}
+}
+
+func TestFunctionDefinitionConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		definition  FunctionDefinition
+		wantTimeout int
+	}{
+		{name: "default timeout", definition: FunctionDefinition{Name: "hello"}, wantTimeout: 3},
+		{name: "timeout", definition: FunctionDefinition{Name: "hello", Timeout: 30 * time.Second}, wantTimeout: 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configuration := tt.definition.Configuration("eu-west-1")
+			if configuration.Timeout != tt.wantTimeout {
+				t.Errorf("Timeout = %d, want %d", configuration.Timeout, tt.wantTimeout)
+			}
+			if configuration.FunctionArn != "arn:aws:lambda:eu-west-1:000000000000:function:hello" {
+				t.Errorf("FunctionArn = %s, want the ARN of the function in the region", configuration.FunctionArn)
+			}
+		})
+	}
+}
+
+func TestFunctionRegistryFromCLI(t *testing.T) {
+	flags := LambdaFlags()
+	cliCtx := newTestCLIContext(t, flags, "--lambda-functions", "name=hello;timeout=10s")
+
+	registry, err := FunctionRegistryFromCLI(cliCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if definition, ok := registry.Lookup("hello"); !ok || definition.Timeout != 10*time.Second {
+		t.Errorf("Lookup(hello) = %+v, %v, want the function of the flag", definition, ok)
+	}
+
+	// the registry is built once per command
+	again, err := FunctionRegistryFromCLI(cliCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != registry {
+		t.Error("FunctionRegistryFromCLI() built the registry again")
+	}
+
+	cliCtx = newTestCLIContext(t, flags, "--lambda-functions", "timeout=10s")
+	if _, err := FunctionRegistryFromCLI(cliCtx); err == nil {
+		t.Error("FunctionRegistryFromCLI() error = nil, want the invalid function reported")
+	}
+}
+
+func TestFunctionInvokerFromCLITimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want time.Duration
+	}{
+		{name: "unregistered", want: defaultLambdaTimeout},
+		{name: "registered without timeout", args: []string{"--lambda-functions", "name=hello"}, want: defaultLambdaTimeout},
+		{name: "registered timeout", args: []string{"--lambda-functions", "name=hello;timeout=10s"}, want: 10 * time.Second},
+		{
+			name: "timeout flag",
+			args: []string{"--lambda-functions", "name=hello;timeout=10s", "--lambda-timeout", "1m"},
+			want: time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cliCtx := newTestCLIContext(t, LambdaFlags(), tt.args...)
+
+			invoker, err := functionInvokerFromCLI(cliCtx, "hello", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			httpInvoker, ok := invoker.(*HTTPInvoker)
+			if !ok {
+				t.Fatalf("functionInvokerFromCLI() = %T, want an HTTP invoker", invoker)
+			}
+			if httpInvoker.Timeout != tt.want {
+				t.Errorf("timeout = %s, want %s", httpInvoker.Timeout, tt.want)
+			}
+		})
+	}
+}
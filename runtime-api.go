@@ -0,0 +1,586 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderRuntimeRequestID          = "Lambda-Runtime-Aws-Request-Id"
+	HeaderRuntimeDeadlineMs         = "Lambda-Runtime-Deadline-Ms"
+	HeaderRuntimeInvokedFunctionArn = "Lambda-Runtime-Invoked-Function-Arn"
+	HeaderRuntimeTraceID            = "Lambda-Runtime-Trace-Id"
+	HeaderRuntimeClientContext      = "Lambda-Runtime-Client-Context"
+	HeaderRuntimeFunctionErrorType  = "Lambda-Runtime-Function-Error-Type"
+)
+
+const (
+	// ErrorTypeRuntimeExit is the error type reported when the runtime exits during an invocation.
+	ErrorTypeRuntimeExit = "Runtime.ExitError"
+	// ErrorTypeRuntimeInit is the error type reported when the runtime fails to initialize.
+	ErrorTypeRuntimeInit = "Runtime.InitError"
+	// ErrorTypeRuntimeUnknown is the error type reported when the runtime reports an untyped error.
+	ErrorTypeRuntimeUnknown = "Runtime.Unknown"
+)
+
+const (
+	runtimeAPIVersion         = "2018-06-01"
+	defaultRuntimeMemorySize  = 128
+	defaultRuntimeConcurrency = 10
+
+	// Maximum duration of the initialization of a runtime, which does not count towards the timeout
+	// of its first invocation, like lambda.
+	runtimeInitTimeout = 10 * time.Second
+)
+
+// RuntimeFunctionConfig describes a function served by the built-in lambda runtime API.
+type RuntimeFunctionConfig struct {
+	// Name of the function
+	Name string
+	// Path of the bootstrap executable implementing the lambda runtime, i.e. a go handler binary
+	Bootstrap string
+	// Handler passed to the runtime in the _HANDLER environment variable
+	Handler string
+	// Maximum duration of an invocation before its sandbox is stopped
+	Timeout time.Duration
+	// Memory size reported to the runtime, in MB
+	MemorySize int
+	// Maximum number of sandboxes running the function at once, invocations beyond it are throttled
+	Concurrency int
+	// Extra environment variables of the function, as KEY=VALUE
+	Environment []string
+}
+
+// ParseRuntimeFunctionConfig parses a function definition of the form
+// name=hello;bootstrap=./bin/hello;handler=hello;timeout=3s;memory=128;concurrency=10;env=KEY=VALUE
+// where every field other than the name and bootstrap is optional and env may be repeated.
+func ParseRuntimeFunctionConfig(value string) (RuntimeFunctionConfig, error) {
+	config := RuntimeFunctionConfig{
+		Timeout:     defaultLambdaTimeout,
+		MemorySize:  defaultRuntimeMemorySize,
+		Concurrency: defaultRuntimeConcurrency,
+	}
+	for _, field := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return config, fmt.Errorf("invalid runtime function field %q", field)
+		}
+
+		var err error
+		switch key {
+		case "name":
+			config.Name = val
+		case "bootstrap":
+			config.Bootstrap = val
+		case "handler":
+			config.Handler = val
+		case "timeout":
+			config.Timeout, err = time.ParseDuration(val)
+		case "memory":
+			config.MemorySize, err = strconv.Atoi(val)
+		case "concurrency":
+			config.Concurrency, err = strconv.Atoi(val)
+		case "env":
+			config.Environment = append(config.Environment, val)
+		default:
+			return config, fmt.Errorf("unknown runtime function field %q", key)
+		}
+		if err != nil {
+			return config, fmt.Errorf("invalid runtime function %s %q: %w", key, val, err)
+		}
+	}
+
+	if config.Name == "" || config.Bootstrap == "" {
+		return config, fmt.Errorf("runtime function %q requires a name and bootstrap", value)
+	}
+	if config.Timeout <= 0 {
+		return config, fmt.Errorf("runtime function %q requires a positive timeout", value)
+	}
+	if config.Concurrency < 1 {
+		return config, fmt.Errorf("runtime function %q requires a positive concurrency", value)
+	}
+
+	return config, nil
+}
+
+// RuntimeFunction runs a function in sandboxes serving the lambda runtime API, keeping sandboxes
+// warm between invocations and starting new ones while all of them are busy.
+type RuntimeFunction struct {
+	config RuntimeFunctionConfig
+	region string
+
+	mu        sync.Mutex
+	idle      []*sandbox
+	sandboxes map[*sandbox]struct{}
+	// Sandboxes being started, which count towards the concurrency of the function.
+	starting int
+	closed   bool
+}
+
+func NewRuntimeFunction(config RuntimeFunctionConfig, region string) *RuntimeFunction {
+	return &RuntimeFunction{
+		config:    config,
+		region:    region,
+		sandboxes: make(map[*sandbox]struct{}),
+	}
+}
+
+func (f *RuntimeFunction) Name() string {
+	return f.config.Name
+}
+
+// Invoke runs the invocation in an idle sandbox of the function, starting one when none is idle.
+func (f *RuntimeFunction) Invoke(ctx context.Context, payload []byte) (*InvokeResult, error) {
+	for {
+		sb, err := f.acquire()
+		if err != nil {
+			return nil, err
+		}
+		if sb == nil {
+			return newThrottleResult()
+		}
+
+		result, healthy, err := sb.invoke(ctx, payload, f.config.Timeout)
+		f.release(sb, healthy)
+		// a warm runtime may exit after its last invocation, i.e. after a panic, in which case the
+		// invocation runs in a new sandbox
+		if errors.Is(err, errSandboxExited) {
+			continue
+		}
+
+		return result, err
+	}
+}
+
+// Close stops every sandbox of the function.
+func (f *RuntimeFunction) Close() {
+	f.mu.Lock()
+	f.closed = true
+	sandboxes := f.sandboxes
+	f.sandboxes = make(map[*sandbox]struct{})
+	f.idle = nil
+	f.mu.Unlock()
+
+	for sb := range sandboxes {
+		sb.stop()
+	}
+}
+
+// acquire returns an idle sandbox, or starts a new one, it returns nil when the function is at its
+// concurrency limit.
+func (f *RuntimeFunction) acquire() (*sandbox, error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("runtime function %s is closed", f.config.Name)
+	}
+	if n := len(f.idle); n > 0 {
+		sb := f.idle[n-1]
+		f.idle = f.idle[:n-1]
+		f.mu.Unlock()
+		return sb, nil
+	}
+	if len(f.sandboxes)+f.starting >= f.config.Concurrency {
+		f.mu.Unlock()
+		return nil, nil
+	}
+	f.starting++
+	f.mu.Unlock()
+
+	sb, err := startSandbox(f)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starting--
+	if err != nil {
+		return nil, err
+	}
+	if f.closed {
+		go sb.stop()
+		return nil, fmt.Errorf("runtime function %s is closed", f.config.Name)
+	}
+	f.sandboxes[sb] = struct{}{}
+
+	return sb, nil
+}
+
+// release returns a healthy sandbox to the warm pool, and stops a failed one.
+func (f *RuntimeFunction) release(sb *sandbox, healthy bool) {
+	f.mu.Lock()
+	if healthy && !f.closed {
+		f.idle = append(f.idle, sb)
+		f.mu.Unlock()
+		return
+	}
+	delete(f.sandboxes, sb)
+	f.mu.Unlock()
+
+	sb.stop()
+}
+
+func (f *RuntimeFunction) environment(runtimeAPI, taskRoot string) []string {
+	env := os.Environ()
+	env = append(env,
+		"AWS_LAMBDA_RUNTIME_API="+runtimeAPI,
+		"AWS_LAMBDA_FUNCTION_NAME="+f.config.Name,
+		"AWS_LAMBDA_FUNCTION_VERSION="+latestVersion,
+		"AWS_LAMBDA_FUNCTION_MEMORY_SIZE="+strconv.Itoa(f.config.MemorySize),
+		"AWS_LAMBDA_LOG_GROUP_NAME=/aws/lambda/"+f.config.Name,
+		"AWS_LAMBDA_LOG_STREAM_NAME="+logStreamName(),
+		"AWS_REGION="+f.region,
+		"AWS_DEFAULT_REGION="+f.region,
+		"LAMBDA_TASK_ROOT="+taskRoot,
+		"_HANDLER="+f.config.Handler,
+	)
+
+	return append(env, f.config.Environment...)
+}
+
+// logStreamName names the log stream of a new sandbox, like lambda.
+func logStreamName() string {
+	return fmt.Sprintf(
+		"%s/[%s]%s", time.Now().Format("2006/01/02"), latestVersion, strings.ReplaceAll(uuid.New().String(), "-", ""),
+	)
+}
+
+// errSandboxExited is returned when a warm sandbox exited before picking up an invocation.
+var errSandboxExited = errors.New("sandbox exited")
+
+// runtimeInvocation is an invocation waiting to be picked up, or being run, by a sandbox.
+type runtimeInvocation struct {
+	requestID     string
+	payload       []byte
+	timeout       time.Duration
+	traceID       string
+	clientContext string
+	done          chan *runtimeResponse
+}
+
+// runtimeResponse is the outcome of an invocation reported by the runtime.
+type runtimeResponse struct {
+	payload   []byte
+	errorType string
+	// the sandbox must not be reused, i.e. the runtime failed to initialize
+	fatal bool
+}
+
+// sandbox is a bootstrap process of a function, with the runtime API server it polls.
+type sandbox struct {
+	function    *RuntimeFunction
+	cmd         *exec.Cmd
+	server      *http.Server
+	invocations chan *runtimeInvocation
+	exited      chan struct{}
+	exitErr     error
+
+	// Whether the runtime picked up an invocation, after which it is done initializing.
+	warm bool
+
+	mu      sync.Mutex
+	current *runtimeInvocation
+	initErr *runtimeResponse
+}
+
+func startSandbox(function *RuntimeFunction) (*sandbox, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for runtime API: %w", err)
+	}
+
+	sb := &sandbox{
+		function:    function,
+		invocations: make(chan *runtimeInvocation),
+		exited:      make(chan struct{}),
+	}
+	sb.server = &http.Server{
+		Handler:           sb.router(),
+		ReadHeaderTimeout: time.Second * 1,
+	}
+	go func() {
+		if err := sb.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("failed to serve runtime API", zap.Error(err))
+		}
+	}()
+
+	bootstrap, err := filepath.Abs(function.config.Bootstrap)
+	if err != nil {
+		_ = sb.server.Close()
+		return nil, fmt.Errorf("invalid bootstrap of %s: %w", function.config.Name, err)
+	}
+	sb.cmd = exec.Command(bootstrap)
+	sb.cmd.Dir = filepath.Dir(bootstrap)
+	sb.cmd.Env = function.environment(listener.Addr().String(), sb.cmd.Dir)
+	sb.cmd.Stdout = os.Stdout
+	sb.cmd.Stderr = os.Stderr
+	if err := sb.cmd.Start(); err != nil {
+		_ = sb.server.Close()
+		return nil, fmt.Errorf("failed to start bootstrap of %s: %w", function.config.Name, err)
+	}
+
+	zap.L().Info("started lambda sandbox",
+		zap.String("lambda.function", function.config.Name),
+		zap.String("runtime.api", listener.Addr().String()),
+		zap.Int("process.id", sb.cmd.Process.Pid),
+	)
+
+	go func() {
+		sb.exitErr = sb.cmd.Wait()
+		close(sb.exited)
+	}()
+
+	return sb, nil
+}
+
+func (sb *sandbox) stop() {
+	_ = sb.cmd.Process.Kill()
+	<-sb.exited
+	_ = sb.server.Close()
+}
+
+// invoke hands the invocation to the runtime and waits for its outcome, it reports whether the
+// sandbox can be reused.
+func (sb *sandbox) invoke(
+	ctx context.Context,
+	payload []byte,
+	timeout time.Duration,
+) (*InvokeResult, bool, error) {
+	invocation := &runtimeInvocation{
+		requestID: uuid.New().String(),
+		payload:   payload,
+		timeout:   timeout,
+		done:      make(chan *runtimeResponse, 1),
+	}
+	traceID, ok := TraceIDFromContext(ctx)
+	if !ok {
+		traceID = NewTraceID()
+	}
+	invocation.traceID = traceID
+	if clientContext, ok := ClientContextFromContext(ctx); ok {
+		clientContextBytes, err := json.Marshal(clientContext)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to marshal client context: %w", err)
+		}
+		invocation.clientContext = base64.StdEncoding.EncodeToString(clientContextBytes)
+	}
+
+	initTimer := time.NewTimer(runtimeInitTimeout)
+	defer initTimer.Stop()
+
+	// the runtime picks up the invocation once it is done initializing or with the previous one
+	select {
+	case sb.invocations <- invocation:
+		sb.warm = true
+	case <-sb.exited:
+		if sb.warm {
+			return nil, false, errSandboxExited
+		}
+		result, err := sb.exitResult(invocation.requestID)
+		return result, false, err
+	case <-initTimer.C:
+		result, err := newTimeoutResult(runtimeInitTimeout)
+		return result, false, err
+	case <-ctx.Done():
+		return nil, true, fmt.Errorf("failed to invoke lambda: %w", ctx.Err())
+	}
+
+	// the invocation times out from the moment the runtime picks it up, like its deadline
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case response := <-invocation.done:
+		result, err := newRuntimeResult(invocation.requestID, response)
+		return result, !response.fatal, err
+	case <-sb.exited:
+		result, err := sb.exitResult(invocation.requestID)
+		return result, false, err
+	case <-timer.C:
+		result, err := newTimeoutResult(timeout)
+		return result, false, err
+	case <-ctx.Done():
+		// the runtime is still busy with the invocation, so the sandbox cannot be reused
+		return nil, false, fmt.Errorf("failed to invoke lambda: %w", ctx.Err())
+	}
+}
+
+func (sb *sandbox) exitResult(requestID string) (*InvokeResult, error) {
+	sb.mu.Lock()
+	initErr := sb.initErr
+	sb.mu.Unlock()
+	if initErr != nil {
+		return newRuntimeResult(requestID, initErr)
+	}
+
+	message := "Runtime exited without providing a reason"
+	if sb.exitErr != nil {
+		message = fmt.Sprintf("Runtime exited with error: %s", sb.exitErr)
+	}
+
+	return newRuntimeResult(requestID, &runtimeResponse{
+		payload: marshalErrorPayload(ErrorPayload{
+			ErrorType:    ErrorTypeRuntimeExit,
+			ErrorMessage: fmt.Sprintf("RequestId: %s Error: %s", requestID, message),
+		}),
+		errorType: ErrorTypeRuntimeExit,
+		fatal:     true,
+	})
+}
+
+// newRuntimeResult reports the outcome of an invocation the way the lambda invoke API does.
+func newRuntimeResult(requestID string, response *runtimeResponse) (*InvokeResult, error) {
+	result := &InvokeResult{
+		StatusCode:      http.StatusOK,
+		RequestID:       requestID,
+		ExecutedVersion: latestVersion,
+		Payload:         response.payload,
+	}
+	if response.errorType == "" {
+		return result, nil
+	}
+
+	result.FunctionError = FunctionErrorUnhandled
+	fnErr := &FunctionError{
+		Kind:   FunctionErrorUnhandled,
+		Result: result,
+	}
+	if err := json.Unmarshal(result.Payload, &fnErr.ErrorPayload); err != nil {
+		fnErr.ErrorMessage = strings.TrimSpace(string(result.Payload))
+	}
+	if fnErr.ErrorType == "" {
+		fnErr.ErrorType = response.errorType
+	}
+
+	return result, fnErr
+}
+
+func (sb *sandbox) router() http.Handler {
+	prefix := "/" + runtimeAPIVersion + "/runtime"
+	router := mux.NewRouter()
+	router.HandleFunc(prefix+"/invocation/next", sb.serveNext).Methods(http.MethodGet)
+	router.HandleFunc(prefix+"/invocation/{requestID}/response", sb.serveResponse).Methods(http.MethodPost)
+	router.HandleFunc(prefix+"/invocation/{requestID}/error", sb.serveError).Methods(http.MethodPost)
+	router.HandleFunc(prefix+"/init/error", sb.serveInitError).Methods(http.MethodPost)
+	return router
+}
+
+func (sb *sandbox) serveNext(w http.ResponseWriter, r *http.Request) {
+	var invocation *runtimeInvocation
+	select {
+	case invocation = <-sb.invocations:
+	case <-r.Context().Done():
+		return
+	}
+
+	deadline := time.Now().Add(invocation.timeout)
+
+	sb.mu.Lock()
+	sb.current = invocation
+	sb.mu.Unlock()
+
+	w.Header().Set(HeaderRuntimeRequestID, invocation.requestID)
+	w.Header().Set(HeaderRuntimeDeadlineMs, strconv.FormatInt(deadline.UnixMilli(), 10))
+	w.Header().Set(HeaderRuntimeInvokedFunctionArn, LambdaFunctionArn(sb.function.region, sb.function.config.Name))
+	w.Header().Set(HeaderRuntimeTraceID, invocation.traceID)
+	if invocation.clientContext != "" {
+		w.Header().Set(HeaderRuntimeClientContext, invocation.clientContext)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(invocation.payload)
+}
+
+func (sb *sandbox) serveResponse(w http.ResponseWriter, r *http.Request) {
+	sb.complete(w, r, "")
+}
+
+func (sb *sandbox) serveError(w http.ResponseWriter, r *http.Request) {
+	errorType := r.Header.Get(HeaderRuntimeFunctionErrorType)
+	if errorType == "" {
+		errorType = ErrorTypeRuntimeUnknown
+	}
+	sb.complete(w, r, errorType)
+}
+
+// complete reports the outcome of the current invocation.
+func (sb *sandbox) complete(w http.ResponseWriter, r *http.Request, errorType string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRuntimeAPIError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	sb.mu.Lock()
+	invocation := sb.current
+	if invocation == nil || invocation.requestID != mux.Vars(r)["requestID"] {
+		sb.mu.Unlock()
+		writeRuntimeAPIError(w, http.StatusBadRequest, "InvalidRequestID", "Invalid request ID")
+		return
+	}
+	sb.current = nil
+	sb.mu.Unlock()
+
+	invocation.done <- &runtimeResponse{payload: body, errorType: errorType}
+	writeRuntimeAPIStatus(w)
+}
+
+func (sb *sandbox) serveInitError(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeRuntimeAPIError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+
+	errorType := r.Header.Get(HeaderRuntimeFunctionErrorType)
+	if errorType == "" {
+		errorType = ErrorTypeRuntimeInit
+	}
+
+	zap.L().Error("lambda runtime failed to initialize",
+		zap.String("lambda.function", sb.function.config.Name),
+		zap.String("lambda.error.type", errorType),
+		zap.ByteString("lambda.error", body),
+	)
+
+	// fail the invocation waiting for the runtime to initialize, if any, or the next one once the
+	// runtime exits
+	response := &runtimeResponse{payload: body, errorType: errorType, fatal: true}
+	sb.mu.Lock()
+	sb.initErr = response
+	sb.mu.Unlock()
+	select {
+	case invocation := <-sb.invocations:
+		invocation.done <- response
+	default:
+	}
+
+	writeRuntimeAPIStatus(w)
+}
+
+func writeRuntimeAPIStatus(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte(`{"status":"OK"}`))
+}
+
+func writeRuntimeAPIError(w http.ResponseWriter, statusCode int, errorType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(marshalErrorPayload(ErrorPayload{ErrorType: errorType, ErrorMessage: message}))
+}
@@ -0,0 +1,411 @@
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/urfave/cli/v2"
+)
+
+// Environment variables turning the test binary into the bootstrap of a runtime function.
+const (
+	envVarTestBootstrap = "OFFLINE_TEST_BOOTSTRAP"
+	envVarTestInitDelay = "OFFLINE_TEST_INIT_DELAY"
+)
+
+// Timeout of the functions run by the test bootstrap.
+const testBootstrapTimeout = 500 * time.Millisecond
+
+func TestMain(m *testing.M) {
+	if os.Getenv(envVarTestBootstrap) != "" {
+		runTestBootstrap()
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// testBootstrapEvent tells the test bootstrap how to handle an invocation.
+type testBootstrapEvent struct {
+	Action  string        `json:"action"`
+	Message string        `json:"message"`
+	Sleep   time.Duration `json:"sleep"`
+}
+
+type testBootstrapResponse struct {
+	Message     string `json:"message"`
+	ProcessID   int    `json:"process_id"`
+	FunctionArn string `json:"function_arn"`
+	Remaining   int64  `json:"remaining_ms"`
+}
+
+func runTestBootstrap() {
+	if delay, err := time.ParseDuration(os.Getenv(envVarTestInitDelay)); err == nil {
+		time.Sleep(delay)
+	}
+
+	lambda.Start(func(ctx context.Context, event testBootstrapEvent) (*testBootstrapResponse, error) {
+		switch event.Action {
+		case "error":
+			return nil, errors.New(event.Message)
+		case "sleep":
+			time.Sleep(event.Sleep)
+		case "exit":
+			os.Exit(1)
+		}
+
+		lc, _ := lambdacontext.FromContext(ctx)
+		deadline, _ := ctx.Deadline()
+		return &testBootstrapResponse{
+			Message:     event.Message,
+			ProcessID:   os.Getpid(),
+			FunctionArn: lc.InvokedFunctionArn,
+			Remaining:   time.Until(deadline).Milliseconds(),
+		}, nil
+	})
+}
+
+// newTestRuntimeFunction runs the test binary as the bootstrap of a function.
+func newTestRuntimeFunction(t *testing.T, environment ...string) *RuntimeFunction {
+	t.Helper()
+
+	function := NewRuntimeFunction(RuntimeFunctionConfig{
+		Name:        "hello",
+		Bootstrap:   os.Args[0],
+		Timeout:     testBootstrapTimeout,
+		MemorySize:  defaultRuntimeMemorySize,
+		Concurrency: 2,
+		Environment: append([]string{envVarTestBootstrap + "=1"}, environment...),
+	}, "eu-west-1")
+	t.Cleanup(function.Close)
+
+	return function
+}
+
+func invokeTestRuntimeFunction(t *testing.T, function *RuntimeFunction, event testBootstrapEvent) (*testBootstrapResponse, error) {
+	t.Helper()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := function.Invoke(context.Background(), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var response testBootstrapResponse
+	if err := json.Unmarshal(result.Payload, &response); err != nil {
+		t.Fatalf("invalid response %s: %v", result.Payload, err)
+	}
+	return &response, nil
+}
+
+func TestParseRuntimeFunctionConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    RuntimeFunctionConfig
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			value: "name=hello;bootstrap=./bin/hello",
+			want: RuntimeFunctionConfig{
+				Name:        "hello",
+				Bootstrap:   "./bin/hello",
+				Timeout:     defaultLambdaTimeout,
+				MemorySize:  defaultRuntimeMemorySize,
+				Concurrency: defaultRuntimeConcurrency,
+			},
+		},
+		{
+			name:  "every field",
+			value: "name=hello; bootstrap=./bin/hello;handler=main;timeout=3s;memory=256;concurrency=1;env=A=1,2;env=B=",
+			want: RuntimeFunctionConfig{
+				Name:        "hello",
+				Bootstrap:   "./bin/hello",
+				Handler:     "main",
+				Timeout:     3 * time.Second,
+				MemorySize:  256,
+				Concurrency: 1,
+				Environment: []string{"A=1,2", "B="},
+			},
+		},
+		{name: "without bootstrap", value: "name=hello", wantErr: true},
+		{name: "without name", value: "bootstrap=./bin/hello", wantErr: true},
+		{name: "invalid field", value: "name=hello;bootstrap=./bin/hello;debug", wantErr: true},
+		{name: "unknown field", value: "name=hello;bootstrap=./bin/hello;runtime=go", wantErr: true},
+		{name: "invalid timeout", value: "name=hello;bootstrap=./bin/hello;timeout=3", wantErr: true},
+		{name: "zero timeout", value: "name=hello;bootstrap=./bin/hello;timeout=0s", wantErr: true},
+		{name: "negative timeout", value: "name=hello;bootstrap=./bin/hello;timeout=-1s", wantErr: true},
+		{name: "invalid memory", value: "name=hello;bootstrap=./bin/hello;memory=large", wantErr: true},
+		{name: "zero concurrency", value: "name=hello;bootstrap=./bin/hello;concurrency=0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRuntimeFunctionConfig(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRuntimeFunctionConfig(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRuntimeFunctionConfig(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeFunction(t *testing.T) {
+	function := newTestRuntimeFunction(t)
+
+	first, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{Message: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Message != "hello" || first.FunctionArn != LambdaFunctionArn("eu-west-1", "hello") {
+		t.Errorf("Invoke() = %+v, want the message from %s", first, LambdaFunctionArn("eu-west-1", "hello"))
+	}
+	if first.Remaining <= 0 || first.Remaining > testBootstrapTimeout.Milliseconds() {
+		t.Errorf("deadline in %dms, want within the timeout of %s", first.Remaining, testBootstrapTimeout)
+	}
+
+	// the sandbox is kept warm for the next invocation
+	second, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{Message: "again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ProcessID != first.ProcessID {
+		t.Errorf("second invocation ran in process %d, want the warm process %d", second.ProcessID, first.ProcessID)
+	}
+
+	// the runtime reports the handler error and keeps running
+	_, err = invokeTestRuntimeFunction(t, function, testBootstrapEvent{Action: "error", Message: "boom"})
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) || fnErr.Kind != FunctionErrorUnhandled || fnErr.ErrorMessage != "boom" || fnErr.ErrorType != "errorString" {
+		t.Fatalf("Invoke() error = %v, want the unhandled error of the handler", err)
+	}
+	third, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ProcessID != first.ProcessID {
+		t.Errorf("invocation after an error ran in process %d, want the warm process %d", third.ProcessID, first.ProcessID)
+	}
+}
+
+func TestRuntimeFunctionTimeout(t *testing.T) {
+	function := newTestRuntimeFunction(t)
+
+	warm, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the handler ignores its deadline, so the sandbox is stopped
+	_, err = invokeTestRuntimeFunction(t, function, testBootstrapEvent{Action: "sleep", Sleep: time.Minute})
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) || !fnErr.Timeout() {
+		t.Fatalf("Invoke() error = %v, want a timeout", err)
+	}
+
+	next, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.ProcessID == warm.ProcessID {
+		t.Errorf("invocation after a timeout ran in the stopped process %d", warm.ProcessID)
+	}
+}
+
+func TestRuntimeFunctionInitDuration(t *testing.T) {
+	// the runtime initializes for longer than the timeout, which only starts once it picks up the
+	// invocation
+	function := newTestRuntimeFunction(t, envVarTestInitDelay+"="+(2*testBootstrapTimeout).String())
+
+	response, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{Message: "hello"})
+	if err != nil {
+		t.Fatalf("Invoke() error = %v, want the initialization excluded from the timeout", err)
+	}
+	if response.Remaining < testBootstrapTimeout.Milliseconds()/2 {
+		t.Errorf("deadline in %dms, want it to start when the invocation is picked up", response.Remaining)
+	}
+}
+
+func TestRuntimeFunctionExit(t *testing.T) {
+	function := newTestRuntimeFunction(t)
+
+	_, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{Action: "exit"})
+	var fnErr *FunctionError
+	if !errors.As(err, &fnErr) || fnErr.ErrorType != ErrorTypeRuntimeExit {
+		t.Fatalf("Invoke() error = %v, want %s", err, ErrorTypeRuntimeExit)
+	}
+
+	// the next invocation starts a new sandbox
+	if _, err := invokeTestRuntimeFunction(t, function, testBootstrapEvent{Message: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuntimeInvokeServer(t *testing.T) {
+	server := NewRuntimeInvokeServer("eu-west-1", AsyncInvokerConfig{MaximumEventAge: minAsyncEventAge})
+	server.AddFunction(RuntimeFunctionConfig{
+		Name:        "hello",
+		Bootstrap:   os.Args[0],
+		Timeout:     testBootstrapTimeout,
+		MemorySize:  defaultRuntimeMemorySize,
+		Concurrency: 1,
+		Environment: []string{envVarTestBootstrap + "=1"},
+	})
+	defer server.Close()
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	tests := []struct {
+		name         string
+		functionName string
+		event        testBootstrapEvent
+		wantStatus   int
+		wantErrType  string
+	}{
+		{name: "response", functionName: "hello", event: testBootstrapEvent{Message: "hello"}, wantStatus: http.StatusOK},
+		{name: "reserved name", functionName: FunctionNamePrefix, event: testBootstrapEvent{Message: "hello"}, wantStatus: http.StatusOK},
+		{name: "error", functionName: "hello", event: testBootstrapEvent{Action: "error", Message: "boom"}, wantStatus: http.StatusOK, wantErrType: "errorString"},
+		{name: "timeout", functionName: "hello", event: testBootstrapEvent{Action: "sleep", Sleep: time.Minute}, wantStatus: http.StatusOK, wantErrType: "Sandbox.Timedout"},
+		{name: "unknown function", functionName: "goodbye", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := json.Marshal(tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			invoker := NewHTTPInvoker(httpServer.URL+"/2015-03-31/functions/"+tt.functionName+"/invocations", time.Minute)
+
+			result, err := invoker.Invoke(context.Background(), payload)
+			var fnErr *FunctionError
+			var svcErr *ServiceError
+			switch {
+			case errors.As(err, &svcErr):
+				if svcErr.StatusCode != tt.wantStatus || svcErr.Code != ErrorCodeResourceNotFound {
+					t.Errorf("Invoke() error = %v, want %d %s", err, tt.wantStatus, ErrorCodeResourceNotFound)
+				}
+			case errors.As(err, &fnErr):
+				if fnErr.ErrorType != tt.wantErrType || result.StatusCode != tt.wantStatus {
+					t.Errorf("Invoke() error = %s %v, want %d %s", fnErr.ErrorType, err, tt.wantStatus, tt.wantErrType)
+				}
+			case err != nil:
+				t.Fatal(err)
+			default:
+				var response testBootstrapResponse
+				if err := json.Unmarshal(result.Payload, &response); err != nil || response.Message != tt.event.Message {
+					t.Errorf("Invoke() = %s, want the message %q", result.Payload, tt.event.Message)
+				}
+				if tt.wantErrType != "" || result.StatusCode != tt.wantStatus {
+					t.Errorf("Invoke() = %d, want %d %s", result.StatusCode, tt.wantStatus, tt.wantErrType)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeInvokeServerEvent(t *testing.T) {
+	destination := &recordingDestination{}
+	server := NewRuntimeInvokeServer("eu-west-1", AsyncInvokerConfig{
+		MaximumEventAge: minAsyncEventAge,
+		OnSuccess:       destination,
+		OnFailure:       destination,
+	})
+	server.AddFunction(RuntimeFunctionConfig{
+		Name:        "hello",
+		Bootstrap:   os.Args[0],
+		Timeout:     testBootstrapTimeout,
+		MemorySize:  defaultRuntimeMemorySize,
+		Concurrency: 1,
+		Environment: []string{envVarTestBootstrap + "=1"},
+	})
+	defer server.Close()
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	req, err := http.NewRequest(
+		http.MethodPost, httpServer.URL+"/2015-03-31/functions/hello/invocations", strings.NewReader(`{"message":"hello"}`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderInvocationType, string(InvocationTypeEvent))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	requestID := resp.Header.Get(HeaderRequestID)
+	if resp.StatusCode != http.StatusAccepted || requestID == "" {
+		t.Errorf("Event invocation = %d %q, want 202 with a request ID", resp.StatusCode, requestID)
+	}
+
+	// the event is queued like lambda does, reporting its outcome to the destination
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.async["hello"].Wait(ctx); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if conditions := destination.conditions(); !reflect.DeepEqual(conditions, []DestinationCondition{DestinationConditionSuccess}) {
+		t.Fatalf("destination conditions = %v, want a success", conditions)
+	}
+	record := destination.records[0]
+	if record.RequestContext.RequestID != requestID {
+		t.Errorf("record request ID = %q, want %q", record.RequestContext.RequestID, requestID)
+	}
+	if want := "arn:aws:lambda:eu-west-1:000000000000:function:hello:$LATEST"; record.RequestContext.FunctionArn != want {
+		t.Errorf("record function ARN = %q, want %q", record.RequestContext.FunctionArn, want)
+	}
+}
+
+func TestRuntimeInvokeServerFromCLIFunctionDestination(t *testing.T) {
+	var flags []cli.Flag
+	flags = append(flags, KinesisFlags()...)
+	flags = append(flags, LambdaRuntimeFlags()...)
+	flags = append(flags, LambdaAsyncFlags()...)
+	flags = append(flags, LambdaDestinationFlags()...)
+	function := "bootstrap=" + os.Args[0] + ";timeout=" + testBootstrapTimeout.String() + ";env=" + envVarTestBootstrap + "=1"
+	cliCtx := newTestCLIContext(t, flags,
+		"--aws-region", "eu-west-1",
+		"--runtime-functions", "name=hello;"+function,
+		"--runtime-functions", "name=audit;"+function,
+		"--on-success-destination", "arn:aws:lambda:eu-west-1:000000000000:function:audit",
+		"--on-failure-destination", "arn:aws:lambda:eu-west-1:000000000000:function:missing",
+	)
+
+	server, err := RuntimeInvokeServerFromCLI(cliCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// the destination functions are invoked in-process rather than at a lambda endpoint
+	record := NewDestinationRecord(LambdaFunctionArn("eu-west-1", "hello"), &AsyncEvent{
+		RequestID:  "request",
+		Payload:    []byte(`{}`),
+		ReceivedAt: time.Now(),
+		Result:     &InvokeResult{StatusCode: http.StatusOK, Payload: []byte(`{}`)},
+	}, DestinationConditionSuccess)
+	if err := server.asyncConfig.OnSuccess.Send(context.Background(), record); err != nil {
+		t.Errorf("on-success Send() error = %v, want the record sent to the audit function", err)
+	}
+	if err := server.asyncConfig.OnFailure.Send(context.Background(), record); err == nil {
+		t.Error("on-failure Send() error = nil, want the missing function to fail the record")
+	}
+}
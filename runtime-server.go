@@ -0,0 +1,303 @@
+package offline
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/gorilla/mux"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	RuntimeFunctionsName      = "runtime-functions"
+	RuntimeAPIPortName        = "runtime-api-port"
+	EnvVarRuntimeFunctions    = "LAMBDA_RUNTIME_FUNCTIONS"
+	EnvVarRuntimeAPIPort      = "LAMBDA_RUNTIME_API_PORT"
+	ErrorCodeResourceNotFound = "ResourceNotFoundException"
+)
+
+// RuntimeInvokeServer serves the lambda invoke API for functions run by the built-in runtime API,
+// standing in for the lambda runtime interface emulator.
+type RuntimeInvokeServer struct {
+	functions map[string]*RuntimeFunction
+	region    string
+
+	// Configuration of the Event invocations of every function.
+	asyncConfig AsyncInvokerConfig
+	// Queues of the Event invocations of each function.
+	async map[string]*AsyncInvoker
+	// Stops the queues when the server is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRuntimeInvokeServer builds a server which queues the Event invocations of its functions with
+// the retries, maximum event age and destinations of the async config.
+func NewRuntimeInvokeServer(region string, asyncConfig AsyncInvokerConfig) *RuntimeInvokeServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RuntimeInvokeServer{
+		functions:   make(map[string]*RuntimeFunction),
+		region:      region,
+		asyncConfig: asyncConfig,
+		async:       make(map[string]*AsyncInvoker),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// AddFunction serves the function defined by the config.
+func (s *RuntimeInvokeServer) AddFunction(config RuntimeFunctionConfig) *RuntimeFunction {
+	function := NewRuntimeFunction(config, s.region)
+	s.functions[config.Name] = function
+
+	asyncConfig := s.asyncConfig
+	asyncConfig.FunctionArn = LambdaFunctionArn(s.region, config.Name)
+	asyncInvoker := NewAsyncInvoker(function, asyncConfig)
+	s.async[config.Name] = asyncInvoker
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		asyncInvoker.Run(s.ctx)
+	}()
+
+	return function
+}
+
+// Function returns the function served under the name, like the runtime interface emulator the
+// reserved name "function" refers to the only function when a single one is served.
+func (s *RuntimeInvokeServer) Function(name string) (*RuntimeFunction, bool) {
+	if function, ok := s.functions[name]; ok {
+		return function, true
+	}
+	if name == FunctionNamePrefix && len(s.functions) == 1 {
+		for _, function := range s.functions {
+			return function, true
+		}
+	}
+
+	return nil, false
+}
+
+// Close discards the queued Event invocations and stops the sandboxes of every function, once the
+// invocations in flight were completed or discarded.
+func (s *RuntimeInvokeServer) Close() {
+	s.cancel()
+	s.wg.Wait()
+
+	for _, function := range s.functions {
+		function.Close()
+	}
+	for _, asyncInvoker := range s.async {
+		_ = asyncInvoker.Wait(context.Background())
+	}
+}
+
+func (s *RuntimeInvokeServer) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/2015-03-31/functions/{functionName}/invocations", s.serveInvoke).Methods(http.MethodPost)
+	return router
+}
+
+func (s *RuntimeInvokeServer) serveInvoke(w http.ResponseWriter, r *http.Request) {
+	functionName := mux.Vars(r)["functionName"]
+	// the lambda router forwards every function to the reserved name, and the function it routes to
+	// in a header, so that the runtime interface emulator can be swapped for this server. A single
+	// function keeps serving the reserved name whatever the router calls it.
+	if target := r.Header.Get(HeaderTargetFunction); functionName == FunctionNamePrefix && target != "" {
+		targetName, _ := SplitFunctionName(target)
+		if _, ok := s.functions[targetName]; ok || len(s.functions) > 1 {
+			functionName = targetName
+		}
+	}
+	function, ok := s.Function(functionName)
+	if !ok {
+		writeServiceError(w, &ServiceError{
+			StatusCode: http.StatusNotFound,
+			Code:       ErrorCodeResourceNotFound,
+			Message:    fmt.Sprintf("Function not found: %s", LambdaFunctionArn(s.region, functionName)),
+		})
+		return
+	}
+
+	invocationType, err := ParseInvocationType(r.Header.Get(HeaderInvocationType))
+	if err != nil {
+		writeServiceError(w, &ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InvalidParameterValueException",
+			Message:    err.Error(),
+		})
+		return
+	}
+
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx, err := invokeContextFromHeaders(r)
+	if err != nil {
+		writeServiceError(w, &ServiceError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InvalidRequestContentException",
+			Message:    err.Error(),
+		})
+		return
+	}
+
+	switch invocationType {
+	case InvocationTypeDryRun:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case InvocationTypeEvent:
+		// the caller does not wait for the function, so neither does the invocation
+		result, err := s.async[function.Name()].Invoke(context.WithoutCancel(ctx), payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(HeaderRequestID, result.RequestID)
+		w.WriteHeader(result.StatusCode)
+		return
+	case InvocationTypeRequestResponse:
+	}
+
+	result, err := function.Invoke(ctx, payload)
+	var svcErr *ServiceError
+	switch {
+	case errors.As(err, &svcErr):
+		writeServiceError(w, svcErr)
+		return
+	case result == nil:
+		writeServiceError(w, &ServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Code:       "ServiceException",
+			Message:    err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set(HeaderRequestID, result.RequestID)
+	w.Header().Set(HeaderExecutedVersion, result.ExecutedVersion)
+	if result.FunctionError != "" {
+		w.Header().Set(HeaderFunctionError, string(result.FunctionError))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(result.StatusCode)
+	_, _ = w.Write(result.Payload)
+}
+
+// invokeContextFromHeaders forwards the trace and client context of the invocation request.
+func invokeContextFromHeaders(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	if traceID := r.Header.Get(HeaderTraceID); traceID != "" {
+		ctx = WithTraceID(ctx, traceID)
+	}
+
+	if encoded := r.Header.Get(HeaderClientContext); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client context: %w", err)
+		}
+		clientContext := &lambdacontext.ClientContext{}
+		if err := json.Unmarshal(decoded, clientContext); err != nil {
+			return nil, fmt.Errorf("invalid client context: %w", err)
+		}
+		ctx = WithClientContext(ctx, clientContext)
+	}
+
+	return ctx, nil
+}
+
+// writeServiceError responds with an error of the lambda service, like the invoke API.
+func writeServiceError(w http.ResponseWriter, svcErr *ServiceError) {
+	body, err := json.Marshal(map[string]string{
+		"Type":    "User",
+		"message": svcErr.Message,
+	})
+	if err != nil {
+		http.Error(w, svcErr.Message, svcErr.StatusCode)
+		return
+	}
+
+	w.Header().Set(HeaderErrorType, svcErr.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(svcErr.StatusCode)
+	_, _ = w.Write(body)
+}
+
+// RuntimeInvokeServerFromCLI builds a server for the functions configured by LambdaRuntimeFlags.
+func RuntimeInvokeServerFromCLI(cliCtx *cli.Context) (*RuntimeInvokeServer, error) {
+	server := NewRuntimeInvokeServer(cliCtx.String(AwsRegionName), AsyncInvokerConfig{})
+
+	// Event invocations are retried and sent to destinations as configured by LambdaAsyncFlags, the
+	// destination functions are served by the server itself
+	asyncConfig, err := asyncInvokerConfigFromCLI(cliCtx, server.destinationFromCLI)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	server.asyncConfig = asyncConfig
+
+	for _, value := range DefinitionsFromCLI(cliCtx, RuntimeFunctionsName) {
+		config, err := ParseRuntimeFunctionConfig(value)
+		if err != nil {
+			server.Close()
+			return nil, err
+		}
+		server.AddFunction(config)
+	}
+
+	return server, nil
+}
+
+// destinationFromCLI builds the destination configured by the named flag like DestinationFromCLI,
+// sending the records of function destinations to the functions served by the server.
+func (s *RuntimeInvokeServer) destinationFromCLI(cliCtx *cli.Context, name string) (Destination, error) {
+	return destinationFromCLI(cliCtx, name, func(functionArn string) (Destination, error) {
+		functionName, _ := SplitFunctionName(functionArn)
+		return &runtimeFunctionDestination{server: s, functionName: functionName}, nil
+	})
+}
+
+// runtimeFunctionDestination invokes a function served by the server with the invocation record,
+// looked up when the record is sent since the destinations are configured before the functions.
+type runtimeFunctionDestination struct {
+	server       *RuntimeInvokeServer
+	functionName string
+}
+
+func (d *runtimeFunctionDestination) Send(ctx context.Context, record *DestinationRecord) error {
+	function, ok := d.server.Function(d.functionName)
+	if !ok {
+		return fmt.Errorf("destination function not found: %s", LambdaFunctionArn(d.server.region, d.functionName))
+	}
+
+	return NewFunctionDestination(function).Send(ctx, record)
+}
+
+func LambdaRuntimeFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    RuntimeAPIPortName,
+			EnvVars: []string{EnvVarRuntimeAPIPort},
+			Value:   8080,
+			Usage:   "Port to listen on for lambda invocations",
+		},
+		&cli.GenericFlag{
+			Name:    RuntimeFunctionsName,
+			EnvVars: []string{EnvVarRuntimeFunctions},
+			Value:   &DefinitionsValue{},
+			Usage: "Functions to run with the built-in lambda runtime API, separated by newlines in the environment. " +
+				"i.e. name=hello;bootstrap=./bin/hello;timeout=3s;memory=128;concurrency=10;env=KEY=VALUE",
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package offline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	LambdaSignRequestsName      = "lambda-sign-requests"
+	LambdaSigningRegionName     = "lambda-signing-region"
+	LambdaAccessKeyIDName       = "lambda-access-key-id"
+	LambdaSecretAccessKeyName   = "lambda-secret-access-key"
+	LambdaSessionTokenName      = "lambda-session-token"
+	EnvVarLambdaSignRequests    = "LAMBDA_SIGN_REQUESTS"
+	EnvVarLambdaSigningRegion   = "LAMBDA_SIGNING_REGION"
+	EnvVarLambdaAccessKeyID     = "LAMBDA_ACCESS_KEY_ID"
+	EnvVarLambdaSecretAccessKey = "LAMBDA_SECRET_ACCESS_KEY"
+	EnvVarLambdaSessionToken    = "LAMBDA_SESSION_TOKEN"
+)
+
+const (
+	lambdaSigningName               = "lambda"
+	defaultLambdaSigningCredentials = "canned"
+	defaultLambdaSigningRegion      = "us-east-1"
+)
+
+// RequestSigner signs lambda invocation requests with AWS signature version 4, like the AWS SDK.
+type RequestSigner struct {
+	credentials aws.CredentialsProvider
+	region      string
+	signer      *v4.Signer
+}
+
+func NewRequestSigner(credentials aws.CredentialsProvider, region string) *RequestSigner {
+	return &RequestSigner{
+		credentials: credentials,
+		region:      region,
+		signer:      v4.NewSigner(),
+	}
+}
+
+// Sign signs the request with the given payload, it must be called once all headers are set.
+func (s *RequestSigner) Sign(ctx context.Context, req *http.Request, payload []byte) error {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve signing credentials: %w", err)
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	err = s.signer.SignHTTP(
+		ctx,
+		creds,
+		req,
+		hex.EncodeToString(payloadHash[:]),
+		lambdaSigningName,
+		s.region,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to sign lambda invocation request: %w", err)
+	}
+
+	return nil
+}
+
+// RequestSignerFromCLI builds a signer with the static credentials configured by LambdaSigningFlags,
+// it returns nil when signing is disabled.
+func RequestSignerFromCLI(cliCtx *cli.Context) *RequestSigner {
+	if !cliCtx.Bool(LambdaSignRequestsName) {
+		return nil
+	}
+
+	return NewRequestSigner(
+		credentials.NewStaticCredentialsProvider(
+			cliCtx.String(LambdaAccessKeyIDName),
+			cliCtx.String(LambdaSecretAccessKeyName),
+			cliCtx.String(LambdaSessionTokenName),
+		),
+		cliCtx.String(LambdaSigningRegionName),
+	)
+}
+
+func LambdaSigningFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    LambdaSignRequestsName,
+			EnvVars: []string{EnvVarLambdaSignRequests},
+			Usage:   "Sign lambda invocation requests with AWS signature version 4",
+		},
+		&cli.StringFlag{
+			Name:    LambdaSigningRegionName,
+			EnvVars: []string{EnvVarLambdaSigningRegion, EnvVarAwsRegion},
+			Value:   defaultLambdaSigningRegion,
+			Usage:   "Region to sign lambda invocation requests for",
+		},
+		&cli.StringFlag{
+			Name:    LambdaAccessKeyIDName,
+			EnvVars: []string{EnvVarLambdaAccessKeyID, "AWS_ACCESS_KEY_ID"},
+			Value:   defaultLambdaSigningCredentials,
+			Usage:   "Access key id to sign lambda invocation requests with",
+		},
+		&cli.StringFlag{
+			Name:    LambdaSecretAccessKeyName,
+			EnvVars: []string{EnvVarLambdaSecretAccessKey, "AWS_SECRET_ACCESS_KEY"},
+			Value:   defaultLambdaSigningCredentials,
+			Usage:   "Secret access key to sign lambda invocation requests with",
+		},
+		&cli.StringFlag{
+			Name:    LambdaSessionTokenName,
+			EnvVars: []string{EnvVarLambdaSessionToken, "AWS_SESSION_TOKEN"},
+			Usage:   "Session token of temporary credentials to sign lambda invocation requests with",
+		},
+	}
+}
@@ -0,0 +1,79 @@
+package offline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestSignerFromCLI(t *testing.T) {
+	tests := []struct {
+		name              string
+		args              []string
+		wantSigned        bool
+		wantSecurityToken string
+	}{
+		{name: "disabled"},
+		{
+			name:       "static credentials",
+			args:       []string{"--lambda-sign-requests", "--lambda-access-key-id", "AKID", "--lambda-secret-access-key", "secret"},
+			wantSigned: true,
+		},
+		{
+			name: "session token",
+			args: []string{
+				"--lambda-sign-requests", "--lambda-access-key-id", "AKID", "--lambda-secret-access-key", "secret",
+				"--lambda-session-token", "token",
+			},
+			wantSigned:        true,
+			wantSecurityToken: "token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var header http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header
+			}))
+			defer server.Close()
+
+			cliCtx := newTestCLIContext(t, LambdaSigningFlags(), append(tt.args, "--lambda-signing-region", "eu-west-1")...)
+			invoker := NewHTTPInvoker(server.URL, time.Minute)
+			invoker.Signer = RequestSignerFromCLI(cliCtx)
+			if (invoker.Signer != nil) != tt.wantSigned {
+				t.Fatalf("RequestSignerFromCLI() = %v, want signed %v", invoker.Signer, tt.wantSigned)
+			}
+
+			if _, err := invoker.Invoke(context.Background(), []byte(`{}`)); err != nil {
+				t.Fatal(err)
+			}
+
+			authorization := header.Get("Authorization")
+			if !tt.wantSigned {
+				if authorization != "" {
+					t.Errorf("Authorization = %q, want an unsigned request", authorization)
+				}
+				return
+			}
+
+			credential := "Credential=AKID/" + time.Now().UTC().Format("20060102") + "/eu-west-1/lambda/aws4_request"
+			if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") || !strings.Contains(authorization, credential) {
+				t.Errorf("Authorization = %q, want a signature with %s", authorization, credential)
+			}
+			// the headers set for the invocation are covered by the signature
+			if !strings.Contains(authorization, "x-amz-invocation-type") {
+				t.Errorf("Authorization = %q, want the invocation type header signed", authorization)
+			}
+			if header.Get("X-Amz-Date") == "" {
+				t.Error("X-Amz-Date header is not set")
+			}
+			if got := header.Get("X-Amz-Security-Token"); got != tt.wantSecurityToken {
+				t.Errorf("X-Amz-Security-Token = %q, want %q", got, tt.wantSecurityToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	policyEffectAllow = "Allow"
+	policyEffectDeny  = "Deny"
+
+	// unauthorizedMessage is the error message of authorizers refusing a request with a 401.
+	unauthorizedMessage = "Unauthorized"
+)
+
+// stringList is an IAM policy value, which may be a string or a list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*l = stringList{value}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+type policyStatement struct {
+	Action   stringList `json:"Action"`
+	Effect   string     `json:"Effect"`
+	Resource stringList `json:"Resource"`
+}
+
+// statementList is the statement of an IAM policy, which may be a statement or a list of them.
+type statementList []policyStatement
+
+func (l *statementList) UnmarshalJSON(data []byte) error {
+	var statement policyStatement
+	if err := json.Unmarshal(data, &statement); err == nil {
+		*l = statementList{statement}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]policyStatement)(l))
+}
+
+// authorizerResponse is the response of a REQUEST authorizer, like the aws-lambda-go
+// APIGatewayCustomAuthorizerResponse but accepting the shorthands of IAM policies which
+// authorizers in other languages return.
+type authorizerResponse struct {
+	PrincipalID    string `json:"principalId"`
+	PolicyDocument struct {
+		Statement statementList `json:"Statement"`
+	} `json:"policyDocument"`
+	Context map[string]interface{} `json:"context"`
+}
+
+// allows evaluates the policy like IAM, an explicit deny wins over an allow and the resource is
+// denied unless a statement allows it.
+func (r authorizerResponse) allows(resource string) bool {
+	allowed := false
+	for _, statement := range r.PolicyDocument.Statement {
+		if !statement.matches(resource) {
+			continue
+		}
+		switch statement.Effect {
+		case policyEffectDeny:
+			return false
+		case policyEffectAllow:
+			allowed = true
+		}
+	}
+
+	return allowed
+}
+
+func (s policyStatement) matches(resource string) bool {
+	actionMatches := false
+	for _, action := range s.Action {
+		if matchWildcard(strings.ToLower(action), "execute-api:invoke") {
+			actionMatches = true
+			break
+		}
+	}
+	if !actionMatches {
+		return false
+	}
+
+	for _, pattern := range s.Resource {
+		if matchWildcard(pattern, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchWildcard matches a value to an IAM pattern, where * matches any characters and ? a single one.
+func matchWildcard(pattern, value string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+
+	matched, err := regexp.MatchString("^"+expression+"$", value)
+	return err == nil && matched
+}
+
+// routeARN is the ARN of a route of the emulated API, which authorizer policies allow or deny.
+func routeARN(region string, connCtx *ConnectionContext, routeKey string) string {
+	return fmt.Sprintf("arn:aws:execute-api:%s:%s:%s/%s/%s", region, cannedAccountID, connCtx.APIID, connCtx.Stage, routeKey)
+}
+
+// NewLambdaAuthorizerHook builds a connect hook which invokes a REQUEST authorizer lambda with the
+// headers and query string of the upgrade request, refusing the connection with a 403 unless the
+// returned policy allows the $connect route. The principal ID and context of the response are
+// passed to the integrations of the routes of the connection as the authorizer.
+func NewLambdaAuthorizerHook(authorizer offline.Invoker, region string) ConnectHook {
+	return func(ctx context.Context, request ConnectRequest) ConnectResponse {
+		methodARN := routeARN(region, request.Context, RouteConnect)
+		payload, err := json.Marshal(newAuthorizerRequest(methodARN, request.Context))
+		if err != nil {
+			zap.L().Error("failed to marshal authorizer payload", zap.Error(err))
+			return ConnectResponse{StatusCode: http.StatusInternalServerError}
+		}
+
+		zap.L().Info("invoking authorizer lambda", zap.String("connection.id", request.ConnectionID))
+		result, err := authorizer.Invoke(offline.WithTraceID(ctx, request.TraceID), payload)
+		if err != nil {
+			zap.L().Error("failed to invoke authorizer lambda",
+				append(offline.LambdaErrorFields(err), zap.String("connection.id", request.ConnectionID))...,
+			)
+			// authorizers refuse unauthenticated requests by failing with Unauthorized
+			var fnErr *offline.FunctionError
+			if errors.As(err, &fnErr) && fnErr.ErrorMessage == unauthorizedMessage {
+				return ConnectResponse{StatusCode: http.StatusUnauthorized}
+			}
+			return ConnectResponse{StatusCode: http.StatusInternalServerError}
+		}
+
+		var response authorizerResponse
+		if err := json.Unmarshal(result.Payload, &response); err != nil {
+			zap.L().Error("invalid authorizer response",
+				zap.String("connection.id", request.ConnectionID),
+				zap.Error(err),
+			)
+			return ConnectResponse{StatusCode: http.StatusInternalServerError}
+		}
+		if !response.allows(methodARN) {
+			zap.L().Info("authorizer denied websocket connection",
+				zap.String("connection.id", request.ConnectionID),
+				zap.String("authorizer.principal_id", response.PrincipalID),
+			)
+			return ConnectResponse{StatusCode: http.StatusForbidden}
+		}
+
+		// API gateway flattens the context of the authorizer next to the principal ID
+		authorizerContext := make(map[string]interface{}, len(response.Context)+1)
+		for key, value := range response.Context {
+			authorizerContext[key] = value
+		}
+		authorizerContext["principalId"] = response.PrincipalID
+		request.Context.Authorizer = authorizerContext
+
+		return AcceptConnection
+	}
+}
+
+// newAuthorizerRequest builds the REQUEST authorizer event of the upgrade request.
+func newAuthorizerRequest(methodARN string, connCtx *ConnectionContext) events.APIGatewayCustomAuthorizerRequestTypeRequest {
+	connect := newConnectRequest("", connCtx)
+	return events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		Type:                            "REQUEST",
+		MethodArn:                       methodARN,
+		Headers:                         connect.Headers,
+		MultiValueHeaders:               connect.MultiValueHeaders,
+		QueryStringParameters:           connect.QueryStringParameters,
+		MultiValueQueryStringParameters: connect.MultiValueQueryStringParameters,
+		StageVariables:                  map[string]string{},
+		RequestContext: events.APIGatewayCustomAuthorizerRequestTypeRequestContext{
+			AccountID: cannedAccountID,
+			Stage:     connCtx.Stage,
+			RequestID: uuid.New().String(),
+			Identity: events.APIGatewayCustomAuthorizerRequestTypeRequestIdentity{
+				SourceIP: connCtx.SourceIP,
+			},
+			APIID: connCtx.APIID,
+		},
+	}
+}
@@ -0,0 +1,226 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const testConnectARN = "arn:aws:execute-api:us-east-1:000000000000:api/dev/$connect"
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: testConnectARN, value: testConnectARN, want: true},
+		{pattern: "*", value: testConnectARN, want: true},
+		{pattern: "arn:aws:execute-api:*:*:api/*/$connect", value: testConnectARN, want: true},
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/*", value: testConnectARN, want: true},
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/de?/$connect", value: testConnectARN, want: true},
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/d?/$connect", value: testConnectARN, want: false},
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/prod/*", value: testConnectARN, want: false},
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/dev/$default", value: testConnectARN, want: false},
+		// regular expression characters of the pattern are literals
+		{pattern: "arn:aws:execute-api:us-east-1:000000000000:api/dev/.connect", value: testConnectARN, want: false},
+		{pattern: "", value: testConnectARN, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := matchWildcard(tt.pattern, tt.value); got != tt.want {
+				t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizerResponseAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     bool
+		wantErr  bool
+	}{
+		{
+			name:     "allow statement",
+			response: `{"policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"` + testConnectARN + `"}]}}`,
+			want:     true,
+		},
+		{
+			name:     "single statement and lists",
+			response: `{"policyDocument":{"Statement":{"Action":["execute-api:Invoke"],"Effect":"Allow","Resource":["arn:aws:execute-api:*:*:api/*/$connect"]}}}`,
+			want:     true,
+		},
+		{
+			name:     "action wildcard",
+			response: `{"policyDocument":{"Statement":[{"Action":"execute-api:*","Effect":"Allow","Resource":"*"}]}}`,
+			want:     true,
+		},
+		{
+			name:     "action case",
+			response: `{"policyDocument":{"Statement":[{"Action":"Execute-API:invoke","Effect":"Allow","Resource":"*"}]}}`,
+			want:     true,
+		},
+		{
+			name:     "other action",
+			response: `{"policyDocument":{"Statement":[{"Action":"execute-api:ManageConnections","Effect":"Allow","Resource":"*"}]}}`,
+			want:     false,
+		},
+		{
+			name:     "other resource",
+			response: `{"policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"arn:aws:execute-api:*:*:api/prod/*"}]}}`,
+			want:     false,
+		},
+		{
+			name:     "deny statement",
+			response: `{"policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Deny","Resource":"*"}]}}`,
+			want:     false,
+		},
+		{
+			name: "explicit deny wins",
+			response: `{"policyDocument":{"Statement":[` +
+				`{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"*"},` +
+				`{"Action":"execute-api:Invoke","Effect":"Deny","Resource":"` + testConnectARN + `"}]}}`,
+			want: false,
+		},
+		{
+			name: "deny of another resource",
+			response: `{"policyDocument":{"Statement":[` +
+				`{"Action":"execute-api:Invoke","Effect":"Deny","Resource":"arn:aws:execute-api:*:*:api/dev/$default"},` +
+				`{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"*"}]}}`,
+			want: true,
+		},
+		{
+			name:     "no statements",
+			response: `{"policyDocument":{"Statement":[]}}`,
+			want:     false,
+		},
+		{
+			name:     "no policy",
+			response: `{"principalId":"user"}`,
+			want:     false,
+		},
+		{
+			name:     "invalid statement",
+			response: `{"policyDocument":{"Statement":"allow"}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response authorizerResponse
+			err := json.Unmarshal([]byte(tt.response), &response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("json.Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := response.allows(testConnectARN); got != tt.want {
+				t.Errorf("allows(%s) = %v, want %v", testConnectARN, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteARN(t *testing.T) {
+	connCtx := &ConnectionContext{APIID: "api", Stage: "dev"}
+	if got := routeARN("us-east-1", connCtx, RouteConnect); got != testConnectARN {
+		t.Errorf("routeARN() = %q, want %q", got, testConnectARN)
+	}
+}
+
+func TestLambdaAuthorizerHook(t *testing.T) {
+	allow := `{"principalId":"user","context":{"tenant":"acme"},` +
+		`"policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Allow","Resource":"*"}]}}`
+	deny := `{"principalId":"user",` +
+		`"policyDocument":{"Statement":[{"Action":"execute-api:Invoke","Effect":"Deny","Resource":"*"}]}}`
+
+	tests := []struct {
+		name           string
+		payload        string
+		err            error
+		wantStatusCode int
+		wantAuthorizer map[string]interface{}
+	}{
+		{
+			name:           "allowed",
+			payload:        allow,
+			wantStatusCode: http.StatusOK,
+			wantAuthorizer: map[string]interface{}{"principalId": "user", "tenant": "acme"},
+		},
+		{
+			name:           "denied",
+			payload:        deny,
+			wantStatusCode: http.StatusForbidden,
+		},
+		{
+			name:           "invalid response",
+			payload:        `"allow"`,
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "unauthorized",
+			err: &offline.FunctionError{
+				ErrorPayload: offline.ErrorPayload{ErrorMessage: unauthorizedMessage},
+				Kind:         offline.FunctionErrorHandled,
+			},
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name: "function error",
+			err: &offline.FunctionError{
+				ErrorPayload: offline.ErrorPayload{ErrorMessage: "boom"},
+				Kind:         offline.FunctionErrorUnhandled,
+			},
+			wantStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name:           "invocation error",
+			err:            errors.New("connection refused"),
+			wantStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var event map[string]interface{}
+			authorizer := offline.InvokeFunc(func(_ context.Context, payload []byte) (*offline.InvokeResult, error) {
+				if err := json.Unmarshal(payload, &event); err != nil {
+					t.Errorf("invalid authorizer event: %v", err)
+				}
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &offline.InvokeResult{StatusCode: http.StatusOK, Payload: []byte(tt.payload)}, nil
+			})
+
+			connCtx := &ConnectionContext{
+				APIID:    "api",
+				Stage:    "dev",
+				SourceIP: "127.0.0.1",
+				Header:   http.Header{"Authorization": {"token"}},
+			}
+			hook := NewLambdaAuthorizerHook(authorizer, "us-east-1")
+			response := hook(context.Background(), ConnectRequest{ConnectionID: "connection", Context: connCtx})
+
+			if response.StatusCode != tt.wantStatusCode {
+				t.Errorf("status code = %d, want %d", response.StatusCode, tt.wantStatusCode)
+			}
+			if !reflect.DeepEqual(connCtx.Authorizer, tt.wantAuthorizer) {
+				t.Errorf("authorizer = %v, want %v", connCtx.Authorizer, tt.wantAuthorizer)
+			}
+			if event["type"] != "REQUEST" || event["methodArn"] != testConnectARN {
+				t.Errorf("authorizer event type %v of %v, want REQUEST of %s", event["type"], event["methodArn"], testConnectARN)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+)
+
+// ConnectRequest is a connection waiting for its upgrade request to be accepted.
+type ConnectRequest struct {
+	ConnectionID string
+	TraceID      string
+	Context      *ConnectionContext
+}
+
+// ConnectResponse accepts the upgrade of a connection when its status code is 2xx, and refuses it
+// with the status code otherwise, like the response of the $connect route of API gateway.
+type ConnectResponse struct {
+	StatusCode int
+	// Headers of the response to the upgrade request, i.e. Sec-WebSocket-Protocol
+	Header http.Header
+}
+
+func (r ConnectResponse) Accepted() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// ConnectHook runs before the upgrade of a connection, to accept or refuse it.
+type ConnectHook func(ctx context.Context, request ConnectRequest) ConnectResponse
+
+// AcceptConnection is the response of connections without a $connect integration.
+var AcceptConnection = ConnectResponse{StatusCode: http.StatusOK}
+
+// connect runs the connect hooks of the hub in turn until one refuses the connection, merging the
+// headers of their responses.
+func (h *Hub) connect(ctx context.Context, request ConnectRequest) ConnectResponse {
+	response := ConnectResponse{StatusCode: http.StatusOK, Header: http.Header{}}
+	for _, hook := range h.connectHooks {
+		hookResponse := hook(ctx, request)
+		for key, values := range hookResponse.Header {
+			response.Header[key] = values
+		}
+		response.StatusCode = hookResponse.StatusCode
+		if !hookResponse.Accepted() {
+			break
+		}
+	}
+
+	return response
+}
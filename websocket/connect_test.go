@@ -0,0 +1,69 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectHookRefusesUpgrade(t *testing.T) {
+	hub := NewHub()
+	var connectionID string
+	hub.AddConnectHook(func(_ context.Context, request ConnectRequest) ConnectResponse {
+		connectionID = request.ConnectionID
+		return ConnectResponse{StatusCode: http.StatusTooManyRequests}
+	})
+	hub.AddConnectHook(func(context.Context, ConnectRequest) ConnectResponse {
+		t.Error("the hooks after a refusal must not run")
+		return AcceptConnection
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeRequest))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err == nil {
+		conn.Close()
+		t.Fatal("Dial() error = nil, want the upgrade to be refused")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if connectionID == "" {
+		t.Error("the hook was not given the ID of the connection")
+	}
+	if len(hub.connections) != 0 {
+		t.Errorf("connections = %d, want the refused connection not to be registered", len(hub.connections))
+	}
+}
+
+func TestConnectHookAcceptsUpgrade(t *testing.T) {
+	hub := NewHub()
+	hub.AddConnectHook(func(context.Context, ConnectRequest) ConnectResponse {
+		return AcceptConnection
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeRequest))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Close()
+}
@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -9,6 +10,8 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
+
+	offline "github.com/geode-io/aws-emulators"
 )
 
 const (
@@ -39,12 +42,23 @@ var upgrader = websocket.Upgrader{
 type Connection struct {
 	// ID of the connection in the emulated API gateway
 	ID string
+	// X-Ray trace header shared by every invocation made on behalf of the connection
+	TraceID string
+	// Context of the connection passed to the integrations of its routes
+	Context *ConnectionContext
 	// The websocket hub that the client is connected to.
 	hub *Hub
 	// The websocket connection.
 	ws *websocket.Conn
 	// Buffered channel of outbound messages.
 	send chan []byte
+	// Status the connection closed with, reported by the $disconnect route.
+	closed *closeStatus
+}
+
+// CloseStatus returns the status code and reason the connection closed with, or 0 while it is open.
+func (c *Connection) CloseStatus() (int, string) {
+	return c.closed.get()
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -71,11 +85,19 @@ func (c *Connection) readPump() {
 				zap.L().Error("websocket connection closed unexpectedly", zap.Error(err))
 				// will be unregistered in defer
 			}
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				c.closed.set(closeErr.Code, closeErr.Text)
+			} else {
+				c.closed.set(websocket.CloseAbnormalClosure, "")
+			}
 			break
 		}
 		message = bytes.TrimSpace(bytes.ReplaceAll(message, newline, space))
 		c.hub.inbound <- &Msg{
 			ConnectionID: c.ID,
+			TraceID:      c.TraceID,
+			Context:      c.Context,
 			Data:         message,
 		}
 	}
@@ -160,16 +182,44 @@ func (c *Connection) writePump() {
 func serveWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	connectionID := uuid.New().String()
 	zap.L().Info("received websocket connection", zap.String("connection.id", connectionID))
-	ws, err := upgrader.Upgrade(w, r, nil)
+	// continue the trace of the client when it sent one, like API gateway
+	traceID := r.Header.Get(offline.HeaderTraceID)
+	if traceID == "" {
+		traceID = offline.NewTraceID()
+	}
+	connCtx := newConnectionContext(hub, r)
+
+	// the upgrade is refused unless the connect hooks accept it, like the $connect route
+	response := hub.connect(r.Context(), ConnectRequest{
+		ConnectionID: connectionID,
+		TraceID:      traceID,
+		Context:      connCtx,
+	})
+	if !response.Accepted() {
+		zap.L().Info("refused websocket connection",
+			zap.String("connection.id", connectionID),
+			zap.Int("http.status_code", response.StatusCode),
+		)
+		for key, values := range response.Header {
+			w.Header()[key] = values
+		}
+		http.Error(w, http.StatusText(response.StatusCode), response.StatusCode)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, response.Header)
 	if err != nil {
 		zap.L().Error("failed to upgrade websocket connection", zap.Error(err))
 		return
 	}
 	conn := &Connection{
-		ID:   connectionID,
-		hub:  hub,
-		ws:   ws,
-		send: make(chan []byte, 256),
+		ID:      connectionID,
+		TraceID: traceID,
+		Context: connCtx,
+		hub:     hub,
+		ws:      ws,
+		send:    make(chan []byte, 256),
+		closed:  &closeStatus{},
 	}
 	conn.hub.register <- conn
 
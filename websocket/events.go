@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+const (
+	EventTypeConnect    = "CONNECT"
+	EventTypeDisconnect = "DISCONNECT"
+	EventTypeMessage    = "MESSAGE"
+)
+
+const (
+	requestTimeLayout = "02/Jan/2006:15:04:05 -0700"
+	// cannedAccountID is the account of the emulated API.
+	cannedAccountID = "000000000000"
+)
+
+// ConnectionContext is what API gateway knows of a connection from its upgrade request, which it
+// passes to the integrations of the routes of the connection.
+type ConnectionContext struct {
+	// ID and stage of the emulated API
+	APIID string
+	Stage string
+	// Host the client connected to
+	DomainName  string
+	ConnectedAt time.Time
+	SourceIP    string
+	UserAgent   string
+	// Headers and query string of the upgrade request
+	Header http.Header
+	Query  url.Values
+	// Principal ID and context returned by the authorizer of the connection, if any
+	Authorizer map[string]interface{}
+}
+
+func newConnectionContext(hub *Hub, r *http.Request) *ConnectionContext {
+	// net/http moves the Host header to the request, API gateway reports it with the others
+	header := r.Header.Clone()
+	header.Set("Host", r.Host)
+
+	return &ConnectionContext{
+		APIID:       hub.APIID,
+		Stage:       hub.Stage,
+		DomainName:  r.Host,
+		ConnectedAt: time.Now(),
+		SourceIP:    sourceIP(r),
+		UserAgent:   r.UserAgent(),
+		Header:      header,
+		Query:       r.URL.Query(),
+	}
+}
+
+// sourceIP is the address of the client, or of the first proxy which forwarded the request.
+func sourceIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// closeStatus is the status code and reason a connection closed with, the first one wins when
+// both ends close it.
+type closeStatus struct {
+	mu     sync.Mutex
+	code   int
+	reason string
+}
+
+func (s *closeStatus) set(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.code == 0 {
+		s.code = code
+		s.reason = reason
+	}
+}
+
+func (s *closeStatus) get() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.code, s.reason
+}
+
+// proxyRequestContext adds the fields of $disconnect events which the aws-lambda-go events lack.
+type proxyRequestContext struct {
+	events.APIGatewayWebsocketProxyRequestContext
+	DisconnectStatusCode int    `json:"disconnectStatusCode,omitempty"`
+	DisconnectReason     string `json:"disconnectReason,omitempty"`
+}
+
+// proxyRequest is the event API gateway invokes the lambda integrations of websocket routes with.
+type proxyRequest struct {
+	events.APIGatewayWebsocketProxyRequest
+	RequestContext proxyRequestContext `json:"requestContext"`
+}
+
+// newProxyRequest builds the event of a route of the connection, connCtx may be nil for
+// connections API gateway knows nothing of.
+func newProxyRequest(connectionID string, connCtx *ConnectionContext, routeKey, eventType string) proxyRequest {
+	now := time.Now()
+	request := proxyRequest{
+		RequestContext: proxyRequestContext{
+			APIGatewayWebsocketProxyRequestContext: events.APIGatewayWebsocketProxyRequestContext{
+				RequestID:         uuid.New().String(),
+				ExtendedRequestID: uuid.New().String(),
+				ConnectionID:      connectionID,
+				EventType:         eventType,
+				MessageDirection:  "IN",
+				RequestTime:       now.Format(requestTimeLayout),
+				RequestTimeEpoch:  now.UnixMilli(),
+				RouteKey:          routeKey,
+			},
+		},
+	}
+	if connCtx == nil {
+		return request
+	}
+
+	requestContext := &request.RequestContext
+	requestContext.AccountID = cannedAccountID
+	requestContext.APIID = connCtx.APIID
+	requestContext.Stage = connCtx.Stage
+	requestContext.DomainName = connCtx.DomainName
+	requestContext.ConnectedAt = connCtx.ConnectedAt.UnixMilli()
+	requestContext.Identity = events.APIGatewayRequestIdentity{
+		SourceIP:  connCtx.SourceIP,
+		UserAgent: connCtx.UserAgent,
+	}
+	if connCtx.Authorizer != nil {
+		requestContext.Authorizer = connCtx.Authorizer
+	}
+
+	return request
+}
+
+// newConnectRequest builds the $connect event, which alone carries the upgrade request.
+func newConnectRequest(connectionID string, connCtx *ConnectionContext) proxyRequest {
+	request := newProxyRequest(connectionID, connCtx, RouteConnect, EventTypeConnect)
+	if connCtx == nil {
+		return request
+	}
+
+	request.Headers = make(map[string]string, len(connCtx.Header))
+	request.MultiValueHeaders = make(map[string][]string, len(connCtx.Header))
+	for key, values := range connCtx.Header {
+		request.Headers[key] = strings.Join(values, ",")
+		request.MultiValueHeaders[key] = values
+	}
+	if len(connCtx.Query) > 0 {
+		request.QueryStringParameters = make(map[string]string, len(connCtx.Query))
+		request.MultiValueQueryStringParameters = make(map[string][]string, len(connCtx.Query))
+		for key, values := range connCtx.Query {
+			request.QueryStringParameters[key] = values[len(values)-1]
+			request.MultiValueQueryStringParameters[key] = values
+		}
+	}
+
+	return request
+}
+
+// newDisconnectRequest builds the $disconnect event of a connection closed with the status.
+func newDisconnectRequest(connectionID string, connCtx *ConnectionContext, code int, reason string) proxyRequest {
+	request := newProxyRequest(connectionID, connCtx, RouteDisconnect, EventTypeDisconnect)
+	request.RequestContext.DisconnectStatusCode = code
+	request.RequestContext.DisconnectReason = reason
+
+	return request
+}
+
+// newMessageRequest builds the event of a message routed to the route key.
+func newMessageRequest(msg Msg, routeKey string) proxyRequest {
+	request := newProxyRequest(msg.ConnectionID, msg.Context, routeKey, EventTypeMessage)
+	request.RequestContext.MessageID = uuid.New().String()
+	request.Body = string(msg.Data)
+
+	return request
+}
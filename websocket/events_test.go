@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		forwardedFor  string
+		wantIPAddress string
+	}{
+		{name: "client", remoteAddr: "192.0.2.1:54321", wantIPAddress: "192.0.2.1"},
+		{name: "forwarded", remoteAddr: "10.0.0.1:54321", forwardedFor: "198.51.100.7, 10.0.0.1", wantIPAddress: "198.51.100.7"},
+		{name: "address without port", remoteAddr: "192.0.2.1", wantIPAddress: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if got := sourceIP(r); got != tt.wantIPAddress {
+				t.Errorf("sourceIP() = %s, want %s", got, tt.wantIPAddress)
+			}
+		})
+	}
+}
+
+func newTestConnectionContext(t *testing.T) *ConnectionContext {
+	t.Helper()
+
+	hub := NewHub()
+	hub.APIID = "api"
+	hub.Stage = "local"
+	r := httptest.NewRequest(http.MethodGet, "http://chat.example.com/?room=a&room=b&token=secret", nil)
+	r.RemoteAddr = "192.0.2.1:54321"
+	r.Header.Set("User-Agent", "wscat")
+	r.Header.Add("Sec-WebSocket-Protocol", "chat")
+	r.Header.Add("Sec-WebSocket-Protocol", "json")
+
+	return newConnectionContext(hub, r)
+}
+
+func TestNewConnectionContext(t *testing.T) {
+	connCtx := newTestConnectionContext(t)
+
+	if connCtx.APIID != "api" || connCtx.Stage != "local" {
+		t.Errorf("API = %s/%s, want the API of the hub", connCtx.APIID, connCtx.Stage)
+	}
+	if connCtx.DomainName != "chat.example.com" || connCtx.Header.Get("Host") != "chat.example.com" {
+		t.Errorf("domain = %s with Host header %q, want chat.example.com", connCtx.DomainName, connCtx.Header.Get("Host"))
+	}
+	if connCtx.SourceIP != "192.0.2.1" || connCtx.UserAgent != "wscat" {
+		t.Errorf("identity = %s %s, want the client", connCtx.SourceIP, connCtx.UserAgent)
+	}
+	if time.Since(connCtx.ConnectedAt) > time.Minute {
+		t.Errorf("connected at %s, want now", connCtx.ConnectedAt)
+	}
+}
+
+func TestNewConnectRequest(t *testing.T) {
+	connCtx := newTestConnectionContext(t)
+	request := newConnectRequest("connection", connCtx)
+
+	requestContext := request.RequestContext
+	if requestContext.RouteKey != RouteConnect || requestContext.EventType != EventTypeConnect {
+		t.Errorf("route = %s %s, want the $connect route", requestContext.RouteKey, requestContext.EventType)
+	}
+	if requestContext.ConnectionID != "connection" || requestContext.AccountID != cannedAccountID ||
+		requestContext.APIID != "api" || requestContext.Stage != "local" || requestContext.DomainName != "chat.example.com" {
+		t.Errorf("request context = %+v, want the connection and its API", requestContext)
+	}
+	if requestContext.ConnectedAt != connCtx.ConnectedAt.UnixMilli() || requestContext.RequestTimeEpoch < requestContext.ConnectedAt {
+		t.Errorf("connected at %d, requested at %d, want the times of the connection", requestContext.ConnectedAt, requestContext.RequestTimeEpoch)
+	}
+	if requestContext.Identity.SourceIP != "192.0.2.1" || requestContext.Identity.UserAgent != "wscat" {
+		t.Errorf("identity = %+v, want the client", requestContext.Identity)
+	}
+
+	if got := request.Headers["Sec-Websocket-Protocol"]; got != "chat,json" {
+		t.Errorf("Sec-WebSocket-Protocol header = %q, want the values joined", got)
+	}
+	if got := request.MultiValueHeaders["Sec-Websocket-Protocol"]; !reflect.DeepEqual(got, []string{"chat", "json"}) {
+		t.Errorf("Sec-WebSocket-Protocol values = %q, want both", got)
+	}
+	if request.Headers["Host"] != "chat.example.com" {
+		t.Errorf("headers = %v, want the Host header", request.Headers)
+	}
+	if request.QueryStringParameters["room"] != "b" || request.QueryStringParameters["token"] != "secret" {
+		t.Errorf("query = %v, want the last value of each parameter", request.QueryStringParameters)
+	}
+	if got := request.MultiValueQueryStringParameters["room"]; !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("room values = %q, want both", got)
+	}
+}
+
+func TestNewDisconnectRequest(t *testing.T) {
+	request := newDisconnectRequest("connection", newTestConnectionContext(t), 1001, "going away")
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event struct {
+		Headers        map[string]string `json:"headers"`
+		RequestContext struct {
+			RouteKey             string `json:"routeKey"`
+			EventType            string `json:"eventType"`
+			DisconnectStatusCode int    `json:"disconnectStatusCode"`
+			DisconnectReason     string `json:"disconnectReason"`
+		} `json:"requestContext"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.RequestContext.RouteKey != RouteDisconnect || event.RequestContext.EventType != EventTypeDisconnect {
+		t.Errorf("route = %s %s, want the $disconnect route", event.RequestContext.RouteKey, event.RequestContext.EventType)
+	}
+	if event.RequestContext.DisconnectStatusCode != 1001 || event.RequestContext.DisconnectReason != "going away" {
+		t.Errorf("disconnect = %d %q, want the close status", event.RequestContext.DisconnectStatusCode, event.RequestContext.DisconnectReason)
+	}
+	// only the $connect event carries the upgrade request
+	if event.Headers != nil {
+		t.Errorf("headers = %v, want none", event.Headers)
+	}
+}
+
+func TestNewMessageRequest(t *testing.T) {
+	request := newMessageRequest(Msg{ConnectionID: "connection", Data: []byte(`{"action":"send"}`)}, "send")
+
+	if request.Body != `{"action":"send"}` {
+		t.Errorf("body = %s, want the message", request.Body)
+	}
+	requestContext := request.RequestContext
+	if requestContext.RouteKey != "send" || requestContext.EventType != EventTypeMessage || requestContext.MessageID == "" {
+		t.Errorf("request context = %+v, want a message of the send route", requestContext)
+	}
+	// API gateway knows nothing else of connections without a context
+	if requestContext.AccountID != "" || requestContext.Identity != (events.APIGatewayRequestIdentity{}) {
+		t.Errorf("request context = %+v, want the connection alone", requestContext)
+	}
+}
+
+func TestCloseStatus(t *testing.T) {
+	var status closeStatus
+	if code, reason := status.get(); code != 0 || reason != "" {
+		t.Errorf("get() = %d %q, want 0 while open", code, reason)
+	}
+
+	// the first end to close the connection wins
+	status.set(1000, "bye")
+	status.set(1006, "")
+	if code, reason := status.get(); code != 1000 || reason != "bye" {
+		t.Errorf("get() = %d %q, want 1000 bye", code, reason)
+	}
+}
@@ -7,16 +7,26 @@ import (
 
 type Msg struct {
 	ConnectionID string
-	Data         []byte
+	TraceID      string
+	// Context of the connection of inbound messages
+	Context *ConnectionContext
+	Data    []byte
 }
 
 type Hub struct {
+	// ID and stage of the emulated API, reported to the integrations of the routes.
+	APIID string
+	Stage string
+
 	// Registered connections.
 	connections map[string]*Connection
 
 	// Registered listeners.
 	listeners []*Listener
 
+	// Hooks run before the upgrade of connections.
+	connectHooks []ConnectHook
+
 	// Inbound messages from the connections.
 	inbound chan *Msg
 
@@ -31,6 +41,9 @@ type Hub struct {
 
 	// Inbound listen requests from new listeners.
 	listen chan *Listener
+
+	// Closed when the hub stops running.
+	done chan struct{}
 }
 
 func NewHub() *Hub {
@@ -41,6 +54,7 @@ func NewHub() *Hub {
 		unregister:  make(chan *Connection),
 		connections: make(map[string]*Connection),
 		listen:      make(chan *Listener),
+		done:        make(chan struct{}),
 	}
 }
 
@@ -48,8 +62,18 @@ func (h *Hub) RegisterListener(listener *Listener) {
 	h.listen <- listener
 }
 
+// AddConnectHook runs the hook before the upgrade of each connection, it must be added before the
+// hub serves requests. Hooks run in the order they were added until one refuses the connection.
+func (h *Hub) AddConnectHook(hook ConnectHook) {
+	h.connectHooks = append(h.connectHooks, hook)
+}
+
+// SendOutboundMessage sends the message to its connection, it is dropped once the hub stopped.
 func (h *Hub) SendOutboundMessage(msg *Msg) {
-	h.outbound <- msg
+	select {
+	case h.outbound <- msg:
+	case <-h.done:
+	}
 }
 
 func (h *Hub) HasConnection(connectionID string) bool {
@@ -63,6 +87,7 @@ func (h *Hub) ServeRequest(w http.ResponseWriter, req *http.Request) {
 
 //nolint:funlen,gocognit
 func (h *Hub) Run(ctx context.Context) {
+	defer close(h.done)
 	for {
 		select {
 		case <-ctx.Done():
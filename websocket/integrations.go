@@ -0,0 +1,162 @@
+package websocket
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+const (
+	IntegrationLambda  = "lambda"
+	IntegrationKinesis = "kinesis"
+	IntegrationMock    = "mock"
+)
+
+// RouteDefinition declares the integration of a route of the emulated API gateway.
+type RouteDefinition struct {
+	// Key of the route, i.e. sendMessage or $default
+	RouteKey string
+	// Kind of integration, lambda, kinesis or mock
+	Integration string
+	// Name, qualified name or ARN of the function of a lambda integration
+	Function string
+	// Stream of a kinesis integration, defaults to the stream of the emulator
+	Stream string
+	// Response of a mock integration
+	Response string
+	// Whether the integration response is sent back to the connection, like a route response
+	Reply bool
+}
+
+// ParseRouteDefinition parses a route of the form
+// route=sendMessage;integration=lambda;function=send-message
+// route=$default;integration=kinesis;stream=messages
+// route=ping;integration=mock;reply=true;response={"action":"pong"}
+// where the integration defaults to lambda when a function is given, and reply sends the response
+// of the integration back to the connection. The response takes the rest of the definition, so
+// that it may contain semicolons, and comes last.
+func ParseRouteDefinition(value string) (RouteDefinition, error) {
+	var definition RouteDefinition
+	for fields := value; fields != ""; {
+		var field string
+		field, fields, _ = strings.Cut(fields, ";")
+		key, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return definition, fmt.Errorf("invalid route field %q", field)
+		}
+		if key == "response" && fields != "" {
+			val += ";" + fields
+			fields = ""
+		}
+
+		switch key {
+		case "route":
+			definition.RouteKey = val
+		case "integration":
+			definition.Integration = val
+		case "function":
+			definition.Function = val
+		case "stream":
+			definition.Stream = val
+		case "response":
+			definition.Response = val
+		case "reply":
+			reply, err := strconv.ParseBool(val)
+			if err != nil {
+				return definition, fmt.Errorf("invalid route reply %q", val)
+			}
+			definition.Reply = reply
+		default:
+			return definition, fmt.Errorf("unknown route field %q", key)
+		}
+	}
+
+	if definition.Integration == "" && definition.Function != "" {
+		definition.Integration = IntegrationLambda
+	}
+
+	switch {
+	case definition.RouteKey == "":
+		return definition, fmt.Errorf("route %q requires a route key", value)
+	case definition.RouteKey == RouteConnect || definition.RouteKey == RouteDisconnect:
+		return definition, fmt.Errorf("route %s is integrated by the connect and disconnect functions", definition.RouteKey)
+	case definition.Integration == IntegrationLambda && definition.Function == "":
+		return definition, fmt.Errorf("lambda route %s requires a function", definition.RouteKey)
+	case definition.Integration != IntegrationLambda &&
+		definition.Integration != IntegrationKinesis &&
+		definition.Integration != IntegrationMock:
+		return definition, fmt.Errorf("unknown integration %q of route %s", definition.Integration, definition.RouteKey)
+	}
+
+	return definition, nil
+}
+
+// NewLambdaIntegration builds an integration which invokes a lambda function with the API gateway
+// websocket event of the message, returning the response of the function.
+func NewLambdaIntegration(invoker offline.Invoker) Integration {
+	return IntegrationFunc(func(ctx context.Context, request RouteRequest) ([]byte, error) {
+		payload, err := json.Marshal(newMessageRequest(request.Msg, request.RouteKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal payload: %w", err)
+		}
+
+		result, err := invoker.Invoke(offline.WithTraceID(ctx, request.TraceID), payload)
+		if err != nil {
+			return nil, err
+		}
+
+		return result.Payload, nil
+	})
+}
+
+// NewKinesisIntegration builds an integration which puts the messages to a kinesis stream,
+// partitioned by connection.
+func NewKinesisIntegration(client *kinesis.Client, streamName string) Integration {
+	return IntegrationFunc(func(ctx context.Context, request RouteRequest) ([]byte, error) {
+		// TODO: generate the following from the api gateway request template
+		templatedData := struct {
+			ConnectionID string `json:"connection_id"`
+			SentAtMillis int64  `json:"sent_at_millis"`
+			TraceID      string `json:"trace_id,omitempty"`
+			Data         []byte `json:"data"`
+		}{
+			ConnectionID: request.ConnectionID,
+			SentAtMillis: time.Now().UnixNano() / int64(time.Millisecond),
+			TraceID:      request.TraceID,
+			Data:         request.Data,
+		}
+
+		templatedDataBytes, err := json.Marshal(templatedData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal templated data: %w", err)
+		}
+
+		_, err = client.PutRecord(ctx, &kinesis.PutRecordInput{
+			Data:         []byte(base64.StdEncoding.EncodeToString(templatedDataBytes)),
+			StreamName:   aws.String(streamName),
+			PartitionKey: aws.String(request.ConnectionID),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to put record to kinesis stream %s: %w", streamName, err)
+		}
+
+		return nil, nil
+	})
+}
+
+// NewMockIntegration builds an integration which responds to every message with the response,
+// without a backend.
+func NewMockIntegration(response []byte) Integration {
+	return IntegrationFunc(func(context.Context, RouteRequest) ([]byte, error) {
+		return response, nil
+	})
+}
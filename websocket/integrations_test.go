@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"testing"
+)
+
+func TestParseRouteDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    RouteDefinition
+		wantErr bool
+	}{
+		{
+			name:  "lambda",
+			value: "route=sendMessage;integration=lambda;function=send-message",
+			want:  RouteDefinition{RouteKey: "sendMessage", Integration: IntegrationLambda, Function: "send-message"},
+		},
+		{
+			name:  "lambda by function",
+			value: "route=sendMessage;function=arn:aws:lambda:us-east-1:000000000000:function:send-message:live",
+			want: RouteDefinition{
+				RouteKey:    "sendMessage",
+				Integration: IntegrationLambda,
+				Function:    "arn:aws:lambda:us-east-1:000000000000:function:send-message:live",
+			},
+		},
+		{
+			name:  "kinesis",
+			value: "route=$default;integration=kinesis;stream=messages",
+			want:  RouteDefinition{RouteKey: RouteDefault, Integration: IntegrationKinesis, Stream: "messages"},
+		},
+		{
+			name:  "kinesis without stream",
+			value: "route=$default;integration=kinesis",
+			want:  RouteDefinition{RouteKey: RouteDefault, Integration: IntegrationKinesis},
+		},
+		{
+			name:  "mock with JSON response",
+			value: `route=ping;integration=mock;reply=true;response={"action":"pong","ids":[1,2]}`,
+			want:  RouteDefinition{RouteKey: "ping", Integration: IntegrationMock, Response: `{"action":"pong","ids":[1,2]}`, Reply: true},
+		},
+		{
+			name:  "response with semicolons",
+			value: `route=ping;integration=mock;response={"text":"a;b=c"};reply=true`,
+			want:  RouteDefinition{RouteKey: "ping", Integration: IntegrationMock, Response: `{"text":"a;b=c"};reply=true`},
+		},
+		{
+			name:  "spaces around fields",
+			value: " route=ping ; integration=mock ; reply=false ",
+			want:  RouteDefinition{RouteKey: "ping", Integration: IntegrationMock},
+		},
+		{name: "missing route", value: "integration=lambda;function=send-message", wantErr: true},
+		{name: "connect route", value: "route=$connect;function=on-connect", wantErr: true},
+		{name: "disconnect route", value: "route=$disconnect;function=on-disconnect", wantErr: true},
+		{name: "lambda without function", value: "route=sendMessage;integration=lambda", wantErr: true},
+		{name: "missing integration", value: "route=sendMessage", wantErr: true},
+		{name: "unknown integration", value: "route=sendMessage;integration=http", wantErr: true},
+		{name: "unknown field", value: "route=sendMessage;function=send-message;timeout=3s", wantErr: true},
+		{name: "invalid reply", value: "route=ping;integration=mock;reply=maybe", wantErr: true},
+		{name: "field without value", value: "route=ping;integration=mock;reply", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRouteDefinition(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRouteDefinition(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseRouteDefinition(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
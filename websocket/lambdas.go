@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// NewLambdaConnectHook builds a connect hook which invokes the $connect route lambda of the
+// emulated API gateway, accepting the connection when the lambda returns a 2xx status code, or no
+// API gateway response at all. The headers of the response are returned with the upgrade.
+func NewLambdaConnectHook(connect offline.Invoker) ConnectHook {
+	return func(ctx context.Context, request ConnectRequest) ConnectResponse {
+		result, err := invokeRouteLambda(
+			ctx, "connect", connect, request.ConnectionID, request.TraceID,
+			newConnectRequest(request.ConnectionID, request.Context),
+		)
+		if err != nil {
+			// a throttled $connect route asks the client to try again, other failures are a bad gateway
+			var svcErr *offline.ServiceError
+			if errors.As(err, &svcErr) && svcErr.Throttled() {
+				return ConnectResponse{StatusCode: http.StatusTooManyRequests}
+			}
+			return ConnectResponse{StatusCode: http.StatusBadGateway}
+		}
+
+		return connectResponse(result.Payload)
+	}
+}
+
+// upgradeHeaders are set by the upgrade of the connection, so the $connect route cannot set them.
+// Extensions are not negotiated by the emulator, which refuses to upgrade with them.
+var upgradeHeaders = []string{
+	"Connection",
+	"Upgrade",
+	"Sec-WebSocket-Accept",
+	"Sec-WebSocket-Extensions",
+	"Keep-Alive",
+	"Transfer-Encoding",
+	"TE",
+	"Trailer",
+}
+
+// upgradeHeader reports whether the header is set by the upgrade or a hop-by-hop header.
+func upgradeHeader(key string) bool {
+	if len(key) >= len("Proxy-") && strings.EqualFold(key[:len("Proxy-")], "Proxy-") {
+		return true
+	}
+	for _, upgradeHeader := range upgradeHeaders {
+		if strings.EqualFold(key, upgradeHeader) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// connectResponse reads the API gateway proxy response of a $connect route lambda, leaving out the
+// headers of the upgrade.
+func connectResponse(payload []byte) ConnectResponse {
+	var response events.APIGatewayProxyResponse
+	if err := json.Unmarshal(payload, &response); err != nil || response.StatusCode == 0 {
+		return AcceptConnection
+	}
+
+	ignored := func(key string) bool {
+		if !upgradeHeader(key) {
+			return false
+		}
+		zap.L().Warn("ignoring header of connect lambda response set by the upgrade", zap.String("http.header", key))
+		return true
+	}
+
+	header := http.Header{}
+	for key, value := range response.Headers {
+		if !ignored(key) {
+			header.Set(key, value)
+		}
+	}
+	for key, values := range response.MultiValueHeaders {
+		if ignored(key) {
+			continue
+		}
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	return ConnectResponse{StatusCode: response.StatusCode, Header: header}
+}
+
+// NewLambdaListener builds a listener which invokes the $disconnect route lambda of the emulated
+// API gateway. The invocations run outside of the hub and are cancelled with the context.
+func NewLambdaListener(ctx context.Context, id string, disconnect offline.Invoker) *Listener {
+	return &Listener{
+		ID: id,
+		OnDisconnect: func(connection Connection) {
+			code, reason := connection.CloseStatus()
+			request := newDisconnectRequest(connection.ID, connection.Context, code, reason)
+			go func() {
+				_, _ = invokeRouteLambda(ctx, "disconnect", disconnect, connection.ID, connection.TraceID, request)
+			}()
+		},
+	}
+}
+
+func invokeRouteLambda(
+	ctx context.Context,
+	route string,
+	invoker offline.Invoker,
+	connectionID, traceID string,
+	request proxyRequest,
+) (*offline.InvokeResult, error) {
+	zap.L().Info("invoking "+route+" lambda",
+		zap.String("connection.id", connectionID),
+	)
+
+	payloadBytes, err := json.Marshal(request)
+	if err != nil {
+		zap.L().Error("failed to marshal payload", zap.Error(err))
+		return nil, err
+	}
+
+	result, err := invoker.Invoke(offline.WithTraceID(ctx, traceID), payloadBytes)
+	if err != nil {
+		zap.L().Error("failed to invoke "+route+" lambda",
+			append(offline.LambdaErrorFields(err), zap.String("connection.id", connectionID))...,
+		)
+	}
+
+	return result, err
+}
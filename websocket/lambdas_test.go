@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	offline "github.com/geode-io/aws-emulators"
+)
+
+// invokerFunc adapts a function to an offline.Invoker.
+type invokerFunc func(ctx context.Context, payload []byte) (*offline.InvokeResult, error)
+
+func (f invokerFunc) Invoke(ctx context.Context, payload []byte) (*offline.InvokeResult, error) {
+	return f(ctx, payload)
+}
+
+// respondWith returns an invoker responding to every invocation with the payload.
+func respondWith(payload string) offline.Invoker {
+	return invokerFunc(func(context.Context, []byte) (*offline.InvokeResult, error) {
+		return &offline.InvokeResult{StatusCode: http.StatusOK, Payload: []byte(payload)}, nil
+	})
+}
+
+func TestConnectResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    ConnectResponse
+	}{
+		{name: "no response", payload: `null`, want: AcceptConnection},
+		{name: "not a proxy response", payload: `{"ok":true}`, want: AcceptConnection},
+		{name: "refused", payload: `{"statusCode":401}`, want: ConnectResponse{StatusCode: http.StatusUnauthorized, Header: http.Header{}}},
+		{
+			name: "headers",
+			payload: `{"statusCode":200,"headers":{"Sec-WebSocket-Protocol":"chat","X-Custom":"a"},` +
+				`"multiValueHeaders":{"X-Custom":["b","c"],"Set-Cookie":["a=1","b=2"]}}`,
+			want: ConnectResponse{StatusCode: http.StatusOK, Header: http.Header{
+				"Sec-Websocket-Protocol": {"chat"},
+				"X-Custom":               {"a", "b", "c"},
+				"Set-Cookie":             {"a=1", "b=2"},
+			}},
+		},
+		{
+			name: "upgrade headers",
+			payload: `{"statusCode":200,"headers":{"Sec-WebSocket-Protocol":"chat","sec-websocket-extensions":"permessage-deflate",` +
+				`"Connection":"close","Upgrade":"h2c","Sec-WebSocket-Accept":"x","Keep-Alive":"timeout=5",` +
+				`"Transfer-Encoding":"chunked","TE":"trailers","Trailer":"Expires","Proxy-Authenticate":"Basic"},` +
+				`"multiValueHeaders":{"proxy-connection":["keep-alive"],"X-Custom":["a"]}}`,
+			want: ConnectResponse{StatusCode: http.StatusOK, Header: http.Header{
+				"Sec-Websocket-Protocol": {"chat"},
+				"X-Custom":               {"a"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := connectResponse([]byte(tt.payload)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("connectResponse(%s) = %+v, want %+v", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLambdaConnectHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{name: "accepted", wantStatus: http.StatusOK},
+		{
+			name:       "throttled",
+			err:        &offline.ServiceError{StatusCode: http.StatusTooManyRequests, Code: offline.ErrorCodeTooManyRequests},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{name: "failed", err: errors.New("connection refused"), wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var event proxyRequest
+			hook := NewLambdaConnectHook(invokerFunc(func(ctx context.Context, payload []byte) (*offline.InvokeResult, error) {
+				if err := json.Unmarshal(payload, &event); err != nil {
+					t.Error(err)
+				}
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &offline.InvokeResult{StatusCode: http.StatusOK, Payload: []byte(`{"statusCode":200}`)}, nil
+			}))
+
+			response := hook(context.Background(), ConnectRequest{ConnectionID: "connection", TraceID: offline.NewTraceID()})
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			if event.RequestContext.RouteKey != RouteConnect || event.RequestContext.ConnectionID != "connection" {
+				t.Errorf("event = %+v, want the $connect event of the connection", event.RequestContext)
+			}
+		})
+	}
+}
+
+func TestLambdaConnectHookUpgrade(t *testing.T) {
+	hub := NewHub()
+	// the extension would make the upgrade fail, were it not left out
+	hub.AddConnectHook(NewLambdaConnectHook(respondWith(
+		`{"statusCode":200,"headers":{"Sec-WebSocket-Protocol":"chat","Sec-WebSocket-Extensions":"permessage-deflate","X-Custom":"a"}}`,
+	)))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeRequest))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"chat"}, HandshakeTimeout: 5 * time.Second}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if conn.Subprotocol() != "chat" {
+		t.Errorf("subprotocol = %q, want chat", conn.Subprotocol())
+	}
+	if resp.Header.Get("X-Custom") != "a" || resp.Header.Get("Sec-WebSocket-Extensions") != "" {
+		t.Errorf("upgrade headers = %v, want the custom header without the extension", resp.Header)
+	}
+}
+
+func TestLambdaListener(t *testing.T) {
+	events := make(chan proxyRequest, 1)
+	listener := NewLambdaListener(context.Background(), "disconnect-lambda", invokerFunc(
+		func(_ context.Context, payload []byte) (*offline.InvokeResult, error) {
+			var event proxyRequest
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Error(err)
+			}
+			events <- event
+			return &offline.InvokeResult{StatusCode: http.StatusOK}, nil
+		},
+	))
+
+	connection := Connection{ID: "connection", closed: &closeStatus{}}
+	connection.closed.set(websocket.CloseGoingAway, "bye")
+	listener.OnDisconnect(connection)
+
+	select {
+	case event := <-events:
+		requestContext := event.RequestContext
+		if requestContext.RouteKey != RouteDisconnect || requestContext.ConnectionID != "connection" ||
+			requestContext.DisconnectStatusCode != websocket.CloseGoingAway || requestContext.DisconnectReason != "bye" {
+			t.Errorf("event = %+v, want the $disconnect event of the closed connection", requestContext)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the disconnect lambda was not invoked")
+	}
+}
@@ -0,0 +1,343 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	RouteConnect    = "$connect"
+	RouteDisconnect = "$disconnect"
+	RouteDefault    = "$default"
+
+	// DefaultRouteSelectionExpression is the route selection expression of API gateway examples.
+	DefaultRouteSelectionExpression = "$request.body.action"
+)
+
+const routeSelectionBodyPrefix = "$request.body."
+
+// internalServerError is the message API gateway sends to a connection when an integration fails.
+const internalServerError = "Internal server error"
+
+// RouteSelectionExpression selects the route key of a message from a field of its JSON body, like
+// the route selection expression of an API gateway websocket API.
+type RouteSelectionExpression struct {
+	expression string
+	path       []string
+}
+
+// ParseRouteSelectionExpression parses an expression of the form $request.body.action, where
+// the field may be nested, i.e. $request.body.message.type, and the expression may be wrapped in
+// braces, i.e. ${request.body.action}.
+func ParseRouteSelectionExpression(expression string) (RouteSelectionExpression, error) {
+	selector := expression
+	if strings.HasPrefix(selector, "${") && strings.HasSuffix(selector, "}") {
+		selector = "$" + strings.TrimSuffix(strings.TrimPrefix(selector, "${"), "}")
+	}
+	if !strings.HasPrefix(selector, routeSelectionBodyPrefix) {
+		return RouteSelectionExpression{}, fmt.Errorf(
+			"invalid route selection expression %q, expected a field of %s", expression, strings.TrimSuffix(routeSelectionBodyPrefix, "."),
+		)
+	}
+
+	path := strings.Split(strings.TrimPrefix(selector, routeSelectionBodyPrefix), ".")
+	for _, key := range path {
+		if key == "" {
+			return RouteSelectionExpression{}, fmt.Errorf("invalid route selection expression %q", expression)
+		}
+	}
+
+	return RouteSelectionExpression{expression: expression, path: path}, nil
+}
+
+func (e RouteSelectionExpression) String() string {
+	return e.expression
+}
+
+// Select returns the route key of the message body, or false when the body is not JSON or does not
+// have the field, in which case API gateway falls back to the $default route.
+func (e RouteSelectionExpression) Select(body []byte) (string, bool) {
+	// numbers are kept as sent, i.e. large integers are not rounded to a float64
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return "", false
+	}
+
+	for _, key := range e.path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return fmt.Sprint(value), true
+	default:
+		return "", false
+	}
+}
+
+// RouteRequest is a message routed to the integration of a route.
+type RouteRequest struct {
+	// Key of the route selected for the message
+	RouteKey string
+	Msg
+}
+
+// Integration is the backend of a route, which returns the response of the integration.
+type Integration interface {
+	Integrate(ctx context.Context, request RouteRequest) ([]byte, error)
+}
+
+// IntegrationFunc adapts a function to an Integration.
+type IntegrationFunc func(ctx context.Context, request RouteRequest) ([]byte, error)
+
+func (f IntegrationFunc) Integrate(ctx context.Context, request RouteRequest) ([]byte, error) {
+	return f(ctx, request)
+}
+
+// Route is the integration of a route key.
+type Route struct {
+	Integration Integration
+	// Whether the response of the integration is sent back to the connection, like a route response
+	RouteResponse bool
+}
+
+// RouteTable routes the messages of the connections to the integrations of their routes, selected
+// by the route selection expression, falling back to the $default route.
+type RouteTable struct {
+	expression RouteSelectionExpression
+	routes     map[string]Route
+}
+
+func NewRouteTable(expression RouteSelectionExpression) *RouteTable {
+	return &RouteTable{
+		expression: expression,
+		routes:     make(map[string]Route),
+	}
+}
+
+// AddRoute integrates the route key, replacing the integration it had.
+func (t *RouteTable) AddRoute(routeKey string, route Route) {
+	t.routes[routeKey] = route
+}
+
+// Route returns the route key and route of the message body, or false when neither its route nor
+// the $default route is integrated.
+func (t *RouteTable) Route(body []byte) (string, Route, bool) {
+	if routeKey, ok := t.expression.Select(body); ok {
+		if route, ok := t.routes[routeKey]; ok {
+			return routeKey, route, true
+		}
+	}
+
+	route, ok := t.routes[RouteDefault]
+	return RouteDefault, route, ok
+}
+
+// Listener builds a listener which sends the messages of the hub to the integrations of their
+// routes. Messages without a route and failed integrations are answered with the errors API
+// gateway sends, and the integration responses of routes with a route response are sent back to
+// the connection. The messages of a connection are integrated in the order they were received,
+// while connections are integrated in parallel.
+func (t *RouteTable) Listener(ctx context.Context, id string, hub *Hub) *Listener {
+	// queues are only accessed by the hub, which runs the callbacks of its listeners in turn
+	queues := make(map[string]*messageQueue)
+
+	return &Listener{
+		ID: id,
+		OnMessage: func(msg Msg) {
+			queue, ok := queues[msg.ConnectionID]
+			if !ok {
+				queue = &messageQueue{}
+				queues[msg.ConnectionID] = queue
+			}
+			if queue.push(msg) {
+				// integrations run outside of the hub, which would deadlock on the messages they send
+				go t.drain(ctx, hub, queue)
+			}
+		},
+		OnDisconnect: func(connection Connection) {
+			// the messages left in the queue have no connection to reply to anymore
+			if queue, ok := queues[connection.ID]; ok {
+				queue.stop()
+				delete(queues, connection.ID)
+			}
+		},
+	}
+}
+
+// drain integrates the messages of the queue until it is empty or stopped, or the context is done.
+func (t *RouteTable) drain(ctx context.Context, hub *Hub, queue *messageQueue) {
+	for ctx.Err() == nil {
+		msg, ok := queue.pop()
+		if !ok {
+			return
+		}
+		t.integrate(ctx, hub, msg)
+	}
+}
+
+// messageQueue holds the messages of a connection waiting for the integration of the previous ones.
+type messageQueue struct {
+	mu       sync.Mutex
+	messages []Msg
+	draining bool
+	stopped  bool
+}
+
+// push queues the message, returning true when the queue needs a worker to drain it.
+func (q *messageQueue) push(msg Msg) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.messages = append(q.messages, msg)
+	if q.draining {
+		return false
+	}
+	q.draining = true
+
+	return true
+}
+
+// stop drops the messages of the queue, releasing its worker once the current message is integrated.
+func (q *messageQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stopped = true
+	q.messages = nil
+}
+
+// pop dequeues the next message, returning false and releasing the worker when the queue is empty
+// or stopped.
+func (q *messageQueue) pop() (Msg, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped || len(q.messages) == 0 {
+		q.draining = false
+		return Msg{}, false
+	}
+	msg := q.messages[0]
+	q.messages[0] = Msg{}
+	q.messages = q.messages[1:]
+
+	return msg, true
+}
+
+func (t *RouteTable) integrate(ctx context.Context, hub *Hub, msg Msg) {
+	reply := func(data []byte) {
+		hub.SendOutboundMessage(&Msg{ConnectionID: msg.ConnectionID, Data: data})
+	}
+
+	routeKey, route, ok := t.Route(msg.Data)
+	if !ok {
+		zap.L().Warn("no route for websocket message",
+			zap.String("connection.id", msg.ConnectionID),
+			zap.String("route.selection_expression", t.expression.String()),
+		)
+		reply(errorResponse(http.StatusText(http.StatusForbidden), msg.ConnectionID))
+		return
+	}
+
+	zap.L().Info("routing websocket message",
+		zap.String("connection.id", msg.ConnectionID),
+		zap.String("route.key", routeKey),
+	)
+	response, err := route.Integration.Integrate(ctx, RouteRequest{RouteKey: routeKey, Msg: msg})
+	if err != nil {
+		zap.L().Error("failed to integrate websocket message",
+			zap.String("connection.id", msg.ConnectionID),
+			zap.String("route.key", routeKey),
+			zap.Error(err),
+		)
+		// API gateway reports failed integrations whether or not the route has a route response
+		reply(errorResponse(internalServerError, msg.ConnectionID))
+		return
+	}
+
+	if !route.RouteResponse {
+		return
+	}
+	if data, ok := routeResponse(response, msg.ConnectionID); ok {
+		reply(data)
+	}
+}
+
+// routeResponse is the message of an integration response, the body of an API gateway proxy
+// response or the response itself otherwise. It returns false when there is nothing to send.
+func routeResponse(response []byte, connectionID string) ([]byte, bool) {
+	var proxyResponse events.APIGatewayProxyResponse
+	if err := json.Unmarshal(response, &proxyResponse); err != nil || proxyResponse.StatusCode == 0 {
+		trimmed := bytes.TrimSpace(response)
+		if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+			return nil, false
+		}
+		return response, true
+	}
+
+	if proxyResponse.Body == "" {
+		// failed integrations without a body are reported like API gateway reports errors
+		switch {
+		case proxyResponse.StatusCode >= http.StatusInternalServerError:
+			return errorResponse(internalServerError, connectionID), true
+		case proxyResponse.StatusCode >= http.StatusBadRequest:
+			return errorResponse(http.StatusText(proxyResponse.StatusCode), connectionID), true
+		}
+		return nil, false
+	}
+	if proxyResponse.IsBase64Encoded {
+		body, err := base64.StdEncoding.DecodeString(proxyResponse.Body)
+		if err != nil {
+			zap.L().Error("invalid base64 body of integration response",
+				zap.String("connection.id", connectionID),
+				zap.Error(err),
+			)
+			return errorResponse(internalServerError, connectionID), true
+		}
+		return body, true
+	}
+
+	return []byte(proxyResponse.Body), true
+}
+
+// errorResponse is the message API gateway sends to a connection when it fails to handle one of
+// its messages, i.e. when the message matches no route.
+func errorResponse(message, connectionID string) []byte {
+	response, _ := json.Marshal(struct {
+		Message      string `json:"message"`
+		ConnectionID string `json:"connectionId"`
+		RequestID    string `json:"requestId"`
+	}{
+		Message:      message,
+		ConnectionID: connectionID,
+		RequestID:    uuid.New().String(),
+	})
+
+	return response
+}
@@ -0,0 +1,437 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestParseRouteSelectionExpression(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []string
+		wantErr    bool
+	}{
+		{expression: "$request.body.action", want: []string{"action"}},
+		{expression: "${request.body.action}", want: []string{"action"}},
+		{expression: "$request.body.message.type", want: []string{"message", "type"}},
+		{expression: "$request.header.action", wantErr: true},
+		{expression: "action", wantErr: true},
+		{expression: "$request.body.", wantErr: true},
+		{expression: "$request.body.message..type", wantErr: true},
+		{expression: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := ParseRouteSelectionExpression(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRouteSelectionExpression(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got.path, tt.want) {
+				t.Errorf("ParseRouteSelectionExpression(%q) path = %q, want %q", tt.expression, got.path, tt.want)
+			}
+			if got.String() != tt.expression {
+				t.Errorf("String() = %q, want %q", got.String(), tt.expression)
+			}
+		})
+	}
+}
+
+func TestRouteSelectionExpressionSelect(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		body       string
+		want       string
+		wantOK     bool
+	}{
+		{name: "string", expression: "$request.body.action", body: `{"action":"sendMessage"}`, want: "sendMessage", wantOK: true},
+		{name: "nested", expression: "$request.body.message.type", body: `{"message":{"type":"ping"}}`, want: "ping", wantOK: true},
+		{name: "number", expression: "$request.body.action", body: `{"action":2}`, want: "2", wantOK: true},
+		{
+			name:       "large integer",
+			expression: "$request.body.action",
+			body:       `{"action":12345678901234567890}`,
+			want:       "12345678901234567890",
+			wantOK:     true,
+		},
+		{name: "bool", expression: "$request.body.action", body: `{"action":true}`, want: "true", wantOK: true},
+		{name: "missing field", expression: "$request.body.action", body: `{"type":"ping"}`},
+		{name: "object field", expression: "$request.body.action", body: `{"action":{"type":"ping"}}`},
+		{name: "null field", expression: "$request.body.action", body: `{"action":null}`},
+		{name: "not an object", expression: "$request.body.message.type", body: `{"message":"ping"}`},
+		{name: "array body", expression: "$request.body.action", body: `["ping"]`},
+		{name: "text body", expression: "$request.body.action", body: `ping`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := ParseRouteSelectionExpression(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := expression.Select([]byte(tt.body))
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Select(%s) = %q, %v, want %q, %v", tt.body, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRouteTableRoute(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes []string
+		body   string
+		want   string
+		wantOK bool
+	}{
+		{name: "selected route", routes: []string{"ping", RouteDefault}, body: `{"action":"ping"}`, want: "ping", wantOK: true},
+		{name: "unknown route", routes: []string{"ping", RouteDefault}, body: `{"action":"pong"}`, want: RouteDefault, wantOK: true},
+		{name: "unselected route", routes: []string{"ping", RouteDefault}, body: `ping`, want: RouteDefault, wantOK: true},
+		{name: "without default route", routes: []string{"ping"}, body: `{"action":"pong"}`, want: RouteDefault},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table := NewRouteTable(expression)
+			for _, routeKey := range tt.routes {
+				table.AddRoute(routeKey, Route{Integration: NewMockIntegration([]byte(routeKey))})
+			}
+
+			got, route, ok := table.Route([]byte(tt.body))
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("Route(%s) = %q, %v, want %q, %v", tt.body, got, ok, tt.want, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if response, _ := route.Integration.Integrate(context.Background(), RouteRequest{}); string(response) != got {
+				t.Errorf("Route(%s) integrated route %s, want %s", tt.body, response, got)
+			}
+		})
+	}
+}
+
+func TestRouteResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+		wantOK   bool
+		// whether the response is an API gateway error, whose request ID changes
+		wantError bool
+	}{
+		{name: "raw response", response: `{"action":"pong"}`, want: `{"action":"pong"}`, wantOK: true},
+		{name: "text response", response: `pong`, want: `pong`, wantOK: true},
+		{name: "empty response", response: ``},
+		{name: "null response", response: "null\n"},
+		{name: "proxy response", response: `{"statusCode":200,"body":"pong"}`, want: `pong`, wantOK: true},
+		{name: "base64 proxy response", response: `{"statusCode":200,"body":"cG9uZw==","isBase64Encoded":true}`, want: `pong`, wantOK: true},
+		{name: "proxy response without body", response: `{"statusCode":204}`},
+		{name: "client error without body", response: `{"statusCode":404}`, want: "Not Found", wantOK: true, wantError: true},
+		{name: "server error without body", response: `{"statusCode":502}`, want: internalServerError, wantOK: true, wantError: true},
+		{
+			name:      "invalid base64 body",
+			response:  `{"statusCode":200,"body":"not base64!","isBase64Encoded":true}`,
+			want:      internalServerError,
+			wantOK:    true,
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := routeResponse([]byte(tt.response), "connection")
+			if ok != tt.wantOK {
+				t.Fatalf("routeResponse(%s) = %s, %v, want ok %v", tt.response, got, ok, tt.wantOK)
+			}
+			if !tt.wantError {
+				if string(got) != tt.want {
+					t.Errorf("routeResponse(%s) = %s, want %s", tt.response, got, tt.want)
+				}
+				return
+			}
+
+			var message struct {
+				Message      string `json:"message"`
+				ConnectionID string `json:"connectionId"`
+			}
+			if err := json.Unmarshal(got, &message); err != nil {
+				t.Fatalf("routeResponse(%s) = %s, want an error message", tt.response, got)
+			}
+			if message.Message != tt.want || message.ConnectionID != "connection" {
+				t.Errorf("routeResponse(%s) = %s, want message %q", tt.response, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTableListenerOrder(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		integrated = make(map[string][]string)
+		done       sync.WaitGroup
+	)
+	// the first message of each connection is slower to integrate than the next ones
+	integration := IntegrationFunc(func(_ context.Context, request RouteRequest) ([]byte, error) {
+		defer done.Done()
+		if string(request.Data) == "1" {
+			time.Sleep(50 * time.Millisecond)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		integrated[request.ConnectionID] = append(integrated[request.ConnectionID], string(request.Data))
+		return nil, nil
+	})
+
+	expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewRouteTable(expression)
+	table.AddRoute(RouteDefault, Route{Integration: integration})
+	listener := table.Listener(context.Background(), "routes", NewHub())
+
+	want := []string{"1", "2", "3"}
+	connections := []string{"a", "b"}
+	done.Add(len(want) * len(connections))
+	start := time.Now()
+	for _, data := range want {
+		for _, connectionID := range connections {
+			listener.OnMessage(Msg{ConnectionID: connectionID, Data: []byte(data)})
+		}
+	}
+	done.Wait()
+
+	for _, connectionID := range connections {
+		if got := integrated[connectionID]; !reflect.DeepEqual(got, want) {
+			t.Errorf("messages of connection %s integrated in the order %q, want %q", connectionID, got, want)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("connections were integrated one after the other in %s", elapsed)
+	}
+}
+
+func TestRouteTableListenerReplies(t *testing.T) {
+	expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := IntegrationFunc(func(context.Context, RouteRequest) ([]byte, error) {
+		return nil, errors.New("function failed")
+	})
+	table := NewRouteTable(expression)
+	table.AddRoute("ping", Route{Integration: NewMockIntegration([]byte(`{"action":"pong"}`)), RouteResponse: true})
+	table.AddRoute("send", Route{Integration: NewMockIntegration([]byte(`{"action":"sent"}`))})
+	table.AddRoute("fail", Route{Integration: failing})
+	table.AddRoute("failReply", Route{Integration: failing, RouteResponse: true})
+
+	tests := []struct {
+		name string
+		data string
+		// the message sent back, or the message of an API gateway error
+		want      string
+		wantError bool
+	}{
+		{name: "route response", data: `{"action":"ping"}`, want: `{"action":"pong"}`},
+		{name: "without route response", data: `{"action":"send"}`},
+		{name: "no route", data: `{"action":"unknown"}`, want: "Forbidden", wantError: true},
+		{name: "failed integration", data: `{"action":"fail"}`, want: internalServerError, wantError: true},
+		{name: "failed integration with route response", data: `{"action":"failReply"}`, want: internalServerError, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the hub does not run, so that the replies are read from it
+			hub := NewHub()
+			table.Listener(context.Background(), "routes", hub).OnMessage(Msg{ConnectionID: "connection", Data: []byte(tt.data)})
+
+			var reply *Msg
+			select {
+			case reply = <-hub.outbound:
+			case <-time.After(100 * time.Millisecond):
+			}
+			if tt.want == "" {
+				if reply != nil {
+					t.Errorf("reply = %s, want none", reply.Data)
+				}
+				return
+			}
+			if reply == nil {
+				t.Fatal("no reply, want one")
+			}
+			if reply.ConnectionID != "connection" {
+				t.Errorf("reply sent to %s, want connection", reply.ConnectionID)
+			}
+			if !tt.wantError {
+				if string(reply.Data) != tt.want {
+					t.Errorf("reply = %s, want %s", reply.Data, tt.want)
+				}
+				return
+			}
+			var message struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(reply.Data, &message); err != nil || message.Message != tt.want {
+				t.Errorf("reply = %s, want the error %q", reply.Data, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteTableListenerDisconnect(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		integrated []string
+	)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	integration := IntegrationFunc(func(_ context.Context, request RouteRequest) ([]byte, error) {
+		mu.Lock()
+		integrated = append(integrated, string(request.Data))
+		mu.Unlock()
+		if string(request.Data) == "1" {
+			close(started)
+			<-release
+		}
+		return nil, nil
+	})
+
+	expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewRouteTable(expression)
+	table.AddRoute(RouteDefault, Route{Integration: integration})
+	listener := table.Listener(context.Background(), "routes", NewHub())
+
+	for _, data := range []string{"1", "2", "3"} {
+		listener.OnMessage(Msg{ConnectionID: "connection", Data: []byte(data)})
+	}
+	<-started
+	// the messages queued behind the first one are dropped with the connection
+	listener.OnDisconnect(Connection{ID: "connection"})
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"1"}; !reflect.DeepEqual(integrated, want) {
+		t.Errorf("integrated %q, want %q", integrated, want)
+	}
+}
+
+func TestRouteTableListenerHubStopped(t *testing.T) {
+	var integrated sync.WaitGroup
+	expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewRouteTable(expression)
+	// failed integrations are replied to
+	table.AddRoute(RouteDefault, Route{
+		Integration: IntegrationFunc(func(context.Context, RouteRequest) ([]byte, error) {
+			defer integrated.Done()
+			return nil, errors.New("function failed")
+		}),
+	})
+
+	hub := NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		hub.Run(ctx)
+	}()
+	cancel()
+	<-stopped
+
+	// the replies are dropped rather than blocking the messages behind them
+	listener := table.Listener(context.Background(), "routes", hub)
+	integrated.Add(2)
+	listener.OnMessage(Msg{ConnectionID: "connection", Data: []byte("1")})
+	listener.OnMessage(Msg{ConnectionID: "connection", Data: []byte("2")})
+
+	done := make(chan struct{})
+	go func() {
+		integrated.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the reply to the first message blocked the second one")
+	}
+}
+
+func TestRouteTableRouteResponses(t *testing.T) {
+	expression, err := ParseRouteSelectionExpression(DefaultRouteSelectionExpression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := NewRouteTable(expression)
+	table.AddRoute("ping", Route{
+		Integration:   NewLambdaIntegration(respondWith(`{"statusCode":200,"body":"{\"action\":\"pong\"}"}`)),
+		RouteResponse: true,
+	})
+	table.AddRoute("echo", Route{Integration: NewMockIntegration([]byte(`{"action":"echo"}`)), RouteResponse: true})
+	table.AddRoute(RouteDefault, Route{Integration: NewMockIntegration([]byte(`{"action":"ignored"}`))})
+
+	hub := NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+	hub.RegisterListener(table.Listener(ctx, "routes", hub))
+
+	server := httptest.NewServer(http.HandlerFunc(hub.ServeRequest))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the message of the $default route has no route response, so the next message answers the ping
+	for _, message := range []string{`{"action":"ping"}`, `{"action":"other"}`, `{"action":"echo"}`} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var received []string
+	for len(received) < 2 {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v after %q", err, received)
+		}
+		// queued messages are sent together, separated by newlines
+		received = append(received, strings.Split(string(data), "\n")...)
+	}
+	sort.Strings(received)
+	if want := []string{`{"action":"echo"}`, `{"action":"pong"}`}; !reflect.DeepEqual(received, want) {
+		t.Errorf("received %q, want %q", received, want)
+	}
+}